@@ -0,0 +1,244 @@
+// Lets applications register their own actions to be run inside other Linux
+// kernel namespaces, with typed arguments and results.
+
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lxkns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+
+	"github.com/thediveo/gons/reexec"
+)
+
+// registeredAction is a user-defined action registered with RegisterAction,
+// together with the types of its argument and results.
+type registeredAction struct {
+	fn      reflect.Value // func(A, func(R) error) error
+	argtype reflect.Type  // A
+	restype reflect.Type  // R
+}
+
+// actions maps the names of registered user-defined actions to their
+// implementations.
+var actions = map[string]*registeredAction{}
+
+// actionEnvelope wraps the individual results of an action as sent back from
+// the re-executed child as JSON lines. The final envelope marks the end of
+// the results and carries the action's error message, if any.
+type actionEnvelope struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Done   bool            `json:"done,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// RegisterAction registers a user-defined action under the specified name, so
+// that it can later be run inside other namespaces using RunAction. The action
+// function must have the signature:
+//
+//     func(args A, emit func(result R) error) error
+//
+// where A and R are types which can be (de)serialized as JSON. The action gets
+// passed the arguments given to RunAction and then emits as many results as
+// it likes; results are streamed back to the caller of RunAction while the
+// action is still running. As the arguments are passed on stdin and the
+// results sent back on stdout, actions must neither read from stdin nor write
+// to stdout themselves.
+//
+// Applications must register their actions before calling
+// reexec.CheckAction(), such as in init(). RegisterAction panics if the action
+// function doesn't have the required signature, or if an action of the same
+// name has already been registered.
+func RegisterAction(name string, fn interface{}) {
+	fnv := reflect.ValueOf(fn)
+	fnt := fnv.Type()
+	if fnt.Kind() != reflect.Func || fnt.NumIn() != 2 || fnt.NumOut() != 1 ||
+		fnt.Out(0) != errorType || !isEmitFunc(fnt.In(1)) {
+		panic(fmt.Sprintf(
+			"lxkns: RegisterAction: action %q must be func(A, func(R) error) error, not %s",
+			name, fnt))
+	}
+	if _, ok := actions[name]; ok {
+		panic(fmt.Sprintf("lxkns: RegisterAction: action %q already registered", name))
+	}
+	action := &registeredAction{
+		fn:      fnv,
+		argtype: fnt.In(0),
+		restype: fnt.In(1).In(0),
+	}
+	actions[name] = action
+	reexec.Register(name, func() {
+		action.run(os.Stdin, os.Stdout)
+		// Terminate immediately, so nothing else gets written to stdout,
+		// such as test runner chatter when under test.
+		os.Exit(0)
+	})
+}
+
+// isEmitFunc returns true if the specified type is a func(R) error.
+func isEmitFunc(t reflect.Type) bool {
+	return t.Kind() == reflect.Func && t.NumIn() == 1 &&
+		t.NumOut() == 1 && t.Out(0) == errorType
+}
+
+// run runs the action inside the re-executed child, passing it the JSON
+// arguments read from argsin and streaming its results as JSON lines to
+// results.
+func (a *registeredAction) run(argsin io.Reader, results io.Writer) {
+	enc := json.NewEncoder(results)
+	args := reflect.New(a.argtype)
+	err := json.NewDecoder(argsin).Decode(args.Interface())
+	if err == nil {
+		emit := reflect.MakeFunc(a.fn.Type().In(1), func(in []reflect.Value) []reflect.Value {
+			return []reflect.Value{errorValue(emitResult(enc, in[0].Interface()))}
+		})
+		if out := a.fn.Call([]reflect.Value{args.Elem(), emit}); !out[0].IsNil() {
+			err = out[0].Interface().(error)
+		}
+	}
+	done := actionEnvelope{Done: true}
+	if err != nil {
+		done.Error = err.Error()
+	}
+	_ = enc.Encode(done)
+}
+
+// emitResult sends a single result back to the parent.
+func emitResult(enc *json.Encoder, result interface{}) error {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return enc.Encode(actionEnvelope{Result: raw})
+}
+
+// errorValue returns the specified error as a reflect.Value of type error,
+// even if the error is nil.
+func errorValue(err error) reflect.Value {
+	if err == nil {
+		return reflect.Zero(errorType)
+	}
+	return reflect.ValueOf(&err).Elem()
+}
+
+// RunAction forks and re-executes this process in order to run the
+// user-defined action registered under the specified name inside the
+// specified namespaces. User namespaces get entered first, so that the
+// re-executed child gains the capabilities required for entering the other
+// namespaces. The arguments are passed to the action, and its results are
+// either appended to the slice referenced by results (a *[]R), or passed one
+// by one to results when it is a func(R) error, while the action is still
+// running. When such a result function returns an error, then RunAction
+// returns this error after the child has terminated, without passing any
+// further results.
+//
+// Failures of the re-executed child are reported as *ReexecError; an error
+// returned by the action itself is reported as a ReexecActionFailure.
+func RunAction(ctx context.Context, name string, namespaces []Namespace, args interface{}, results interface{}) error {
+	action, ok := actions[name]
+	if !ok {
+		return &ReexecError{
+			Action: name,
+			Kind:   ReexecStartFailure,
+			Err:    errors.New("unregistered action"),
+		}
+	}
+	yield, err := action.yielder(results)
+	if err != nil {
+		return &ReexecError{Action: name, Kind: ReexecStartFailure, Err: err}
+	}
+	argsjson, err := json.Marshal(args)
+	if err != nil {
+		return &ReexecError{Action: name, Kind: ReexecStartFailure, Err: err}
+	}
+	// The arguments are passed to the child on its stdin, while the child
+	// streams back the results on its stdout.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var actionerr, yielderr error
+	err = forkReexec(ctx, name, namespaces, nil, bytes.NewReader(argsjson),
+		func(r io.Reader) error {
+			dec := json.NewDecoder(r)
+			for {
+				var envelope actionEnvelope
+				if err := dec.Decode(&envelope); err != nil {
+					if err == io.EOF {
+						err = io.ErrUnexpectedEOF
+					}
+					return err
+				}
+				if envelope.Done {
+					if envelope.Error != "" {
+						actionerr = errors.New(envelope.Error)
+					}
+					return nil
+				}
+				result := reflect.New(action.restype)
+				if err := json.Unmarshal(envelope.Result, result.Interface()); err != nil {
+					return err
+				}
+				if yielderr = yield(result.Elem()); yielderr != nil {
+					// Stop the child, as we aren't interested in any more
+					// results.
+					cancel()
+					return yielderr
+				}
+			}
+		})
+	switch {
+	case yielderr != nil:
+		return yielderr
+	case err != nil:
+		return err
+	case actionerr != nil:
+		return &ReexecError{Action: name, Kind: ReexecActionFailure, Err: actionerr}
+	}
+	return nil
+}
+
+// yielder returns a function passing on a single result to the caller of
+// RunAction, depending on whether the caller wants to collect the results in
+// a slice or get them passed one by one.
+func (a *registeredAction) yielder(results interface{}) (func(reflect.Value) error, error) {
+	rv := reflect.ValueOf(results)
+	switch {
+	case rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Slice &&
+		rv.Elem().Type().Elem() == a.restype:
+		slice := rv.Elem()
+		return func(result reflect.Value) error {
+			slice.Set(reflect.Append(slice, result))
+			return nil
+		}, nil
+	case rv.Kind() == reflect.Func && isEmitFunc(rv.Type()) &&
+		rv.Type().In(0) == a.restype:
+		return func(result reflect.Value) error {
+			if out := rv.Call([]reflect.Value{result}); !out[0].IsNil() {
+				return out[0].Interface().(error)
+			}
+			return nil
+		}, nil
+	}
+	return nil, fmt.Errorf("results must be *[]%s or func(%s) error, not %T",
+		a.restype, a.restype, results)
+}
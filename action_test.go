@@ -0,0 +1,146 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lxkns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thediveo/lxkns/ops"
+	"github.com/thediveo/lxkns/species"
+)
+
+type countArgs struct {
+	From, To int
+}
+
+type countResult struct {
+	N     int                 `json:"n"`
+	Netns species.NamespaceID `json:"netns"`
+}
+
+func init() {
+	RegisterAction("lxkns-test-count", func(args countArgs, emit func(countResult) error) error {
+		netns, _ := ops.NamespacePath("/proc/self/ns/net").ID()
+		for n := args.From; n <= args.To; n++ {
+			if err := emit(countResult{N: n, Netns: netns}); err != nil {
+				return err
+			}
+		}
+		if args.From > args.To {
+			return fmt.Errorf("cannot count from %d down to %d", args.From, args.To)
+		}
+		return nil
+	})
+	RegisterAction("lxkns-test-quit", func(args countArgs, emit func(countResult) error) error {
+		_ = emit(countResult{N: args.From})
+		os.Exit(0)
+		return nil
+	})
+}
+
+var _ = Describe("actions", func() {
+
+	It("rejects invalid registrations", func() {
+		Expect(func() { RegisterAction("lxkns-test-invalid", func() {}) }).To(Panic())
+		Expect(func() {
+			RegisterAction("lxkns-test-invalid", func(int, func(int)) error { return nil })
+		}).To(Panic())
+		Expect(func() {
+			RegisterAction("lxkns-test-count", func(int, func(int) error) error { return nil })
+		}).To(Panic())
+	})
+
+	It("enters user namespaces first", func() {
+		netns := NewNamespace(species.CLONE_NEWNET, species.NamespaceID{Ino: 1}, "")
+		mntns := NewNamespace(species.CLONE_NEWNS, species.NamespaceID{Ino: 2}, "")
+		userns := NewNamespace(species.CLONE_NEWUSER, species.NamespaceID{Ino: 3}, "")
+		Expect(enterOrder([]Namespace{netns, userns, mntns})).To(Equal(
+			[]Namespace{userns, netns, mntns}))
+	})
+
+	It("collects typed results", func() {
+		ownnetnsid, _ := ops.NamespacePath("/proc/self/ns/net").ID()
+		netns := NewNamespace(species.CLONE_NEWNET, ownnetnsid, "/proc/self/ns/net")
+		var results []countResult
+		Expect(RunAction(context.Background(), "lxkns-test-count", []Namespace{netns},
+			countArgs{From: 1, To: 3}, &results)).To(Succeed())
+		Expect(results).To(ConsistOf(
+			countResult{1, ownnetnsid}, countResult{2, ownnetnsid}, countResult{3, ownnetnsid}))
+	})
+
+	It("streams typed results", func() {
+		var ns []int
+		Expect(RunAction(context.Background(), "lxkns-test-count", nil,
+			countArgs{From: 1, To: 1000}, func(r countResult) error {
+				ns = append(ns, r.N)
+				return nil
+			})).To(Succeed())
+		Expect(ns).To(HaveLen(1000))
+		Expect(ns[999]).To(Equal(1000))
+
+		stop := errors.New("stop")
+		ns = nil
+		Expect(RunAction(context.Background(), "lxkns-test-count", nil,
+			countArgs{From: 1, To: 1000}, func(r countResult) error {
+				ns = append(ns, r.N)
+				if r.N == 10 {
+					return stop
+				}
+				return nil
+			})).To(Equal(stop))
+		Expect(ns).To(HaveLen(10))
+	})
+
+	It("reports action errors", func() {
+		var results []countResult
+		err := RunAction(context.Background(), "lxkns-test-count", nil,
+			countArgs{From: 2, To: 1}, &results)
+		var rerr *ReexecError
+		Expect(errors.As(err, &rerr)).To(BeTrue())
+		Expect(rerr.Kind).To(Equal(ReexecActionFailure))
+		Expect(rerr.Err).To(MatchError("cannot count from 2 down to 1"))
+	})
+
+	It("reports children terminating without final results", func() {
+		var results []countResult
+		err := RunAction(context.Background(), "lxkns-test-quit", nil,
+			countArgs{From: 42}, &results)
+		var rerr *ReexecError
+		Expect(errors.As(err, &rerr)).To(BeTrue())
+		Expect(rerr.Kind).To(Equal(ReexecDecodeFailure))
+		Expect(rerr.Err).To(Equal(io.ErrUnexpectedEOF))
+		Expect(results).To(ConsistOf(countResult{N: 42}))
+	})
+
+	It("rejects unknown actions and unfitting results", func() {
+		var rerr *ReexecError
+		err := RunAction(context.Background(), "lxkns-test-nada", nil, nil, nil)
+		Expect(errors.As(err, &rerr)).To(BeTrue())
+		Expect(rerr.Kind).To(Equal(ReexecStartFailure))
+
+		var results []int
+		err = RunAction(context.Background(), "lxkns-test-count", nil, nil, &results)
+		Expect(errors.As(err, &rerr)).To(BeTrue())
+		Expect(rerr.Kind).To(Equal(ReexecStartFailure))
+		Expect(err.Error()).To(ContainSubstring("*[]lxkns.countResult"))
+	})
+
+})
@@ -0,0 +1,452 @@
+// Captures the process and namespace state needed for namespace discovery into
+// bundles, and discovers namespaces offline from such bundles.
+
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// +build linux
+
+package lxkns
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/thediveo/lxkns/species"
+)
+
+// BundleVersion is the version of the bundle format written by Capture.
+const BundleVersion = 1
+
+// BundleInfo describes where and when a bundle has been captured.
+type BundleInfo struct {
+	Version  int       `json:"version"`  // version of the bundle format.
+	PID      PIDType   `json:"pid"`      // PID of the capturing process.
+	Hostname string    `json:"hostname"` // name of the host captured.
+	Time     time.Time `json:"time"`     // time of capture.
+}
+
+// bundleMeta is the part of a bundle which cannot be captured in form of
+// proc filesystem files, as it has been gathered using namespace ioctl()s,
+// from mount namespaces other than the capturing one, or from decorators.
+// Additionally, it keeps the namespaced PIDs of the processes, as they might
+// need to be looked up from inside PID namespaces.
+type bundleMeta struct {
+	Info          BundleInfo                    `json:"info"`
+	Namespaces    []bundleNamespace             `json:"namespaces"`
+	ProcessLabels map[PIDType]map[string]string `json:"processlabels,omitempty"`
+	NSpids        map[PIDType][]PIDType         `json:"nspids,omitempty"`
+}
+
+// bundleNamespace describes a single namespace, together with its relations
+// to other namespaces.
+type bundleNamespace struct {
+	Type   string             `json:"type"`             // type name, such as "net".
+	ID     bundleNamespaceID  `json:"id"`               // identifier of this namespace.
+	Ref    string             `json:"ref,omitempty"`    // reference path on the captured host.
+	Parent *bundleNamespaceID `json:"parent,omitempty"` // parent PID or user namespace, if any.
+	Owner  *bundleNamespaceID `json:"owner,omitempty"`  // owning user namespace, if any.
+	UID    *int               `json:"uid,omitempty"`    // owner UID of a user namespace.
+	Labels map[string]string  `json:"labels,omitempty"` // labels of this namespace.
+}
+
+// bundleNamespaceID is the JSON representation of a namespace identifier.
+type bundleNamespaceID struct {
+	Dev uint64 `json:"dev"`
+	Ino uint64 `json:"ino"`
+}
+
+func newBundleNamespaceID(nsid species.NamespaceID) *bundleNamespaceID {
+	return &bundleNamespaceID{Dev: nsid.Dev, Ino: nsid.Ino}
+}
+
+func (id bundleNamespaceID) nsid() species.NamespaceID {
+	return species.NamespaceID{Dev: id.Dev, Ino: id.Ino}
+}
+
+// bundleMetaName is the name of the bundle entry describing the namespaces
+// and their relations.
+const bundleMetaName = "lxkns.json"
+
+// Only these entries are extracted from bundles; all other entries are
+// silently ignored. This especially ensures that extracting bundles never
+// writes outside the extraction directory, neither directly nor via symbolic
+// links.
+var (
+	bundleFiles = regexp.MustCompile(
+		`^(lxkns\.json|proc/sys/kernel/random/boot_id|proc/[0-9]+/(stat|cmdline|status))$`)
+	bundleLinks = regexp.MustCompile(
+		`^proc/[0-9]+/(exe|cwd|root|ns/[a-z_]+)$`)
+)
+
+// Capture runs a namespace discovery using the specified options and writes a
+// bundle of the process and namespace state found to w, for discovering the
+// namespaces later and elsewhere using DiscoverBundle. The bundle is a tar
+// archive containing exactly the proc filesystem files the discovery needs,
+// such as the stat, cmdline, and status files of processes, as well as their
+// namespace links. A separate lxkns.json entry describes the namespaces found
+// together with their hierarchy and ownership, the labels attached by
+// decorators, and the namespaced PIDs of the processes. Capture returns the
+// discovery result the bundle was taken from.
+func Capture(w io.Writer, opts DiscoverOpts) (*DiscoveryResult, error) {
+	result := Discover(opts)
+	procroot := result.Options.ProcRoot
+	hostname, _ := os.Hostname()
+	meta := bundleMeta{
+		Info: BundleInfo{
+			Version:  BundleVersion,
+			PID:      PIDType(os.Getpid()),
+			Hostname: hostname,
+			Time:     time.Now(),
+		},
+		Namespaces:    []bundleNamespace{},
+		ProcessLabels: map[PIDType]map[string]string{},
+		NSpids:        map[PIDType][]PIDType{},
+	}
+	for nsidx := range result.Namespaces {
+		for _, ns := range result.SortedNamespaces(NamespaceTypeIndex(nsidx)) {
+			meta.Namespaces = append(meta.Namespaces, newBundleNamespace(ns))
+		}
+	}
+	for pid, proc := range result.Processes {
+		if len(proc.Labels) > 0 {
+			meta.ProcessLabels[pid] = proc.Labels
+		}
+		if pids, err := NSpid(proc, procroot); err == nil {
+			meta.NSpids[pid] = pids
+		}
+	}
+	metajson, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return result, err
+	}
+
+	bw := &bundleWriter{tw: tar.NewWriter(w), procroot: procroot, mtime: meta.Info.Time}
+	bw.data(bundleMetaName, metajson)
+	bw.file("sys/kernel/random/boot_id")
+	for _, proc := range result.Processes.Sorted() {
+		base := strconv.Itoa(int(proc.PID))
+		for _, name := range []string{"stat", "cmdline", "status"} {
+			bw.file(base + "/" + name)
+		}
+		for _, name := range []string{"exe", "cwd", "root"} {
+			bw.link(base + "/" + name)
+		}
+		for _, nstype := range TypesByIndex {
+			if result.Options.NamespaceTypes&nstype != 0 {
+				bw.link(base + "/ns/" + nstype.Name())
+			}
+		}
+	}
+	if bw.err != nil {
+		return result, bw.err
+	}
+	return result, bw.tw.Close()
+}
+
+// newBundleNamespace returns the bundle description of the specified
+// namespace.
+func newBundleNamespace(ns Namespace) bundleNamespace {
+	bns := bundleNamespace{
+		Type:   ns.Type().Name(),
+		ID:     *newBundleNamespaceID(ns.ID()),
+		Ref:    ns.Ref(),
+		Labels: ns.Labels(),
+	}
+	if hns, ok := ns.(Hierarchy); ok {
+		if parent, ok := hns.Parent().(Namespace); ok && parent != nil {
+			bns.Parent = newBundleNamespaceID(parent.ID())
+		}
+	}
+	if ns.Type() == species.CLONE_NEWUSER {
+		uid := ns.(Ownership).UID()
+		bns.UID = &uid
+	} else if owner, ok := ns.Owner().(Namespace); ok && owner != nil {
+		bns.Owner = newBundleNamespaceID(owner.ID())
+	}
+	return bns
+}
+
+// bundleWriter writes the entries of a bundle, skipping proc filesystem
+// entries which cannot be read (anymore), such as when processes have
+// terminated in the meantime. The first write error sticks and all further
+// writes are then skipped.
+type bundleWriter struct {
+	tw       *tar.Writer
+	procroot string
+	mtime    time.Time
+	err      error
+}
+
+// data writes the specified data as a regular file.
+func (bw *bundleWriter) data(name string, data []byte) {
+	if bw.err != nil {
+		return
+	}
+	if bw.err = bw.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  bw.mtime,
+	}); bw.err != nil {
+		return
+	}
+	_, bw.err = bw.tw.Write(data)
+}
+
+// file copies the specified file from the proc filesystem.
+func (bw *bundleWriter) file(name string) {
+	data, err := ioutil.ReadFile(bw.procroot + "/" + name)
+	if err != nil {
+		return
+	}
+	bw.data("proc/"+name, data)
+}
+
+// link copies the specified symbolic link from the proc filesystem.
+func (bw *bundleWriter) link(name string) {
+	if bw.err != nil {
+		return
+	}
+	target, err := os.Readlink(bw.procroot + "/" + name)
+	if err != nil {
+		return
+	}
+	bw.err = bw.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeSymlink,
+		Name:     "proc/" + name,
+		Linkname: target,
+		Mode:     0777,
+		ModTime:  bw.mtime,
+	})
+}
+
+// DiscoverBundle discovers the namespaces offline from a bundle written by
+// Capture, reproducing the discovery result of the capture. Bundles may also
+// be gzip'ed. Additionally, DiscoverBundle returns the information about
+// where and when the bundle has been captured.
+//
+// Only the NamespaceTypes, SkipHierarchy, SkipOwnership, and
+// WithProcessStatus discovery options are taken into account. Decorators are
+// not run, as they would decorate using the state of the host running the
+// offline discovery; instead, the labels attached by the decorators during
+// capture are restored. Please note that the namespace references are the
+// ones from the captured host and thus cannot be used to enter namespaces.
+// For the same reason, NewPIDMap maps the processes only using the namespaced
+// PIDs captured, but neither their tasks nor processes for which the captured
+// host didn't tell the namespaced PIDs. The processes discovered offline are
+// never valid, and process file descriptors cannot be opened for them.
+func DiscoverBundle(r io.Reader, opts DiscoverOpts) (*DiscoveryResult, *BundleInfo, error) {
+	start := time.Now()
+	tmpdir, err := ioutil.TempDir("", "lxkns-bundle-")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(tmpdir)
+	meta, err := extractBundle(r, tmpdir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if opts.NamespaceTypes == 0 {
+		opts.NamespaceTypes = allNamespaceTypes
+	}
+	procroot := tmpdir + "/proc"
+	result := &DiscoveryResult{
+		Options:   opts,
+		Processes: newProcessTable(procroot),
+		nspids:    meta.NSpids,
+	}
+	if result.Processes == nil {
+		result.Processes = ProcessTable{}
+	}
+	if result.nspids == nil {
+		result.nspids = map[PIDType][]PIDType{}
+	}
+	for _, proc := range result.Processes {
+		proc.offline = true
+	}
+	for idx := range result.Namespaces {
+		result.Namespaces[idx] = NamespaceMap{}
+	}
+	if opts.WithProcessStatus {
+		for pid, proc := range result.Processes {
+			proc.Status, _ = NewProcessStatus(pid, procroot)
+		}
+	}
+	// Restore the namespaces first, and only then their relations, as we
+	// need the namespace objects to relate them.
+	for _, bns := range meta.Namespaces {
+		nstype := species.NameToType(bns.Type)
+		if TypeIndex(nstype) < 0 || opts.NamespaceTypes&nstype == 0 {
+			continue
+		}
+		ns := NewNamespace(nstype, bns.ID.nsid(), bns.Ref)
+		for name, value := range bns.Labels {
+			ns.(NamespaceConfigurer).SetLabel(name, value)
+		}
+		if bns.UID != nil && nstype == species.CLONE_NEWUSER {
+			ns.(*userNamespace).owneruid = *bns.UID
+		}
+		result.Namespaces[TypeIndex(nstype)][bns.ID.nsid()] = ns
+	}
+	for nsidx, nsmap := range result.Namespaces {
+		if len(nsmap) > 0 {
+			joinBundleNamespaces(NamespaceTypeIndex(nsidx), procroot, result)
+		}
+	}
+	for _, bns := range meta.Namespaces {
+		nstype := species.NameToType(bns.Type)
+		if TypeIndex(nstype) < 0 {
+			continue
+		}
+		ns := result.Namespaces[TypeIndex(nstype)][bns.ID.nsid()]
+		if ns == nil {
+			continue
+		}
+		if bns.Parent != nil && !opts.SkipHierarchy {
+			if parent, ok := result.Namespaces[TypeIndex(nstype)][bns.Parent.nsid()]; ok {
+				parent.(HierarchyConfigurer).AddChild(ns.(Hierarchy))
+			}
+		}
+		if bns.Owner != nil && !opts.SkipOwnership {
+			ns.(NamespaceConfigurer).SetOwner(bns.Owner.nsid())
+			ns.(NamespaceConfigurer).ResolveOwner(result.Namespaces[UserNS])
+		}
+	}
+	for pid, labels := range meta.ProcessLabels {
+		if proc, ok := result.Processes[pid]; ok {
+			for name, value := range labels {
+				proc.SetLabel(name, value)
+			}
+		}
+	}
+	if opts.NamespaceTypes&species.CLONE_NEWUSER != 0 {
+		result.UserNSRoots = rootNamespaces(result.Namespaces[UserNS])
+	}
+	if opts.NamespaceTypes&species.CLONE_NEWPID != 0 {
+		result.PIDNSRoots = rootNamespaces(result.Namespaces[PIDNS])
+	}
+	result.Stats.Duration = time.Since(start)
+	return result, &meta.Info, nil
+}
+
+// joinBundleNamespaces relates the processes from an extracted bundle to the
+// namespaces of the specified type they are joined to, and then finds the
+// leader processes.
+func joinBundleNamespaces(nstypeidx NamespaceTypeIndex, procroot string, result *DiscoveryResult) {
+	nstype := TypesByIndex[nstypeidx]
+	// Namespace links only tell us the inode numbers of namespaces, but not
+	// their device IDs.
+	namespaces := map[uint64]Namespace{}
+	for nsid, ns := range result.Namespaces[nstypeidx] {
+		namespaces[nsid.Ino] = ns
+	}
+	for pid, proc := range result.Processes {
+		target, err := os.Readlink(fmt.Sprintf("%s/%d/ns/%s", procroot, pid, nstype.Name()))
+		if err != nil {
+			continue
+		}
+		if nsid, t := species.IDwithType(target); t == nstype {
+			if ns, ok := namespaces[nsid.Ino]; ok {
+				proc.Namespaces[nstypeidx] = ns
+			}
+		}
+	}
+	findLeaders(nstypeidx, result)
+}
+
+// ErrInvalidBundle indicates that a bundle lacks the namespace information
+// or otherwise cannot be read.
+var ErrInvalidBundle = errors.New("lxkns: invalid bundle")
+
+// extractBundle extracts the (optionally gzip'ed) bundle into the specified
+// directory and returns the bundle's namespace information.
+func extractBundle(r io.Reader, dir string) (*bundleMeta, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+		}
+		defer gzr.Close()
+		r = gzr
+	} else {
+		r = br
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+		}
+		name := path.Clean(hdr.Name)
+		switch {
+		case hdr.Typeflag == tar.TypeReg && bundleFiles.MatchString(name):
+			err = extractBundleFile(tr, filepath.Join(dir, name))
+		case hdr.Typeflag == tar.TypeSymlink && bundleLinks.MatchString(name):
+			dest := filepath.Join(dir, name)
+			if err = os.MkdirAll(filepath.Dir(dest), 0700); err == nil {
+				err = os.Symlink(hdr.Linkname, dest)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+		}
+	}
+	metajson, err := ioutil.ReadFile(filepath.Join(dir, bundleMetaName))
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing %s", ErrInvalidBundle, bundleMetaName)
+	}
+	meta := &bundleMeta{}
+	if err := json.Unmarshal(metajson, meta); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+	if meta.Info.Version != BundleVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidBundle, meta.Info.Version)
+	}
+	return meta, nil
+}
+
+// extractBundleFile extracts the current bundle entry into a new regular file
+// with the specified path.
+func extractBundleFile(r io.Reader, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,267 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package lxkns
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thediveo/lxkns/ops"
+	"github.com/thediveo/lxkns/species"
+)
+
+// nsid returns the identifier of the specified namespace, or NoneID for nil.
+func nsid(ns interface{}) species.NamespaceID {
+	if ns, ok := ns.(Namespace); ok && ns != nil {
+		return ns.ID()
+	}
+	return species.NoneID
+}
+
+// labellingDecorator labels all network namespaces, as well as the process
+// running the tests.
+type labellingDecorator struct{}
+
+func (d *labellingDecorator) Decorate(result *DiscoveryResult) {
+	for _, ns := range result.Namespaces[NetNS] {
+		ns.(NamespaceConfigurer).SetLabel("net", "work")
+	}
+	result.Processes[PIDType(os.Getpid())].SetLabel("self", "ish")
+}
+
+var _ = Describe("Bundles", func() {
+
+	It("captures and discovers offline", func() {
+		sleepy := exec.Command("unshare", "-Urn", "sleep", "60")
+		Expect(sleepy.Start()).To(Succeed())
+		defer func() {
+			_ = sleepy.Process.Kill()
+			_ = sleepy.Wait()
+		}()
+		sleepypid := PIDType(sleepy.Process.Pid)
+		Eventually(func() error {
+			usernsid, err := ops.NamespacePath(fmt.Sprintf("/proc/%d/ns/user", sleepypid)).ID()
+			if err != nil {
+				return err
+			}
+			myusernsid, _ := ops.NamespacePath("/proc/self/ns/user").ID()
+			if usernsid == myusernsid {
+				return fmt.Errorf("user namespace not yet created")
+			}
+			return nil
+		}).Should(Succeed())
+
+		opts := FullDiscovery
+		opts.WithProcessStatus = true
+		var bundle bytes.Buffer
+		live, err := Capture(&bundle, opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(live.Processes).To(HaveKey(sleepypid))
+
+		offline, info, err := DiscoverBundle(bytes.NewReader(bundle.Bytes()), opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Version).To(Equal(BundleVersion))
+		Expect(info.PID).To(Equal(PIDType(os.Getpid())))
+		Expect(info.Time).NotTo(BeZero())
+
+		for nsidx := range live.Namespaces {
+			Expect(offline.Namespaces[nsidx]).To(HaveLen(len(live.Namespaces[nsidx])))
+			for id, livens := range live.Namespaces[nsidx] {
+				Expect(offline.Namespaces[nsidx]).To(HaveKey(id))
+				ns := offline.Namespaces[nsidx][id]
+				Expect(ns.Ref()).To(Equal(livens.Ref()))
+				Expect(nsid(ns.Owner())).To(Equal(nsid(livens.Owner())))
+				if hns, ok := ns.(Hierarchy); ok {
+					Expect(nsid(hns.Parent())).To(Equal(nsid(livens.(Hierarchy).Parent())))
+				}
+				if uns, ok := ns.(Ownership); ok {
+					Expect(uns.UID()).To(Equal(livens.(Ownership).UID()))
+				}
+			}
+		}
+		Expect(offline.UserNSRoots).To(HaveLen(len(live.UserNSRoots)))
+		Expect(offline.PIDNSRoots).To(HaveLen(len(live.PIDNSRoots)))
+
+		// Processes might have terminated in between discovering and
+		// capturing them, so the offline processes are only a subset.
+		Expect(len(offline.Processes)).To(BeNumerically("<=", len(live.Processes)))
+		for pid, proc := range offline.Processes {
+			liveproc := live.Processes[pid]
+			Expect(liveproc).NotTo(BeNil())
+			Expect(proc.ID()).To(Equal(liveproc.ID()))
+			Expect(proc.Status).NotTo(BeNil())
+			Expect(SameNamespaces(proc.Namespaces, liveproc.Namespaces)).To(BeTrue())
+		}
+		Expect(offline.Processes).To(HaveKey(sleepypid))
+		for _, nsidx := range []NamespaceTypeIndex{UserNS, NetNS} {
+			Expect(offline.Processes[sleepypid].Namespaces[nsidx].LeaderPIDs()).To(
+				ConsistOf(sleepypid))
+		}
+		// Only check the names of our own processes, as other processes,
+		// such as kernel workers, might have changed their names since.
+		Expect(offline.Processes[sleepypid].Name).To(Equal("sleep"))
+		Expect(offline.Processes[sleepypid].Cmdline).To(Equal([]string{"sleep", "60"}))
+		Expect(offline.Processes[sleepypid].Status.CapEff).To(
+			Equal(live.Processes[sleepypid].Status.CapEff))
+
+		// Gzip'ed bundles are fine too, and namespace types can still be
+		// filtered.
+		var gzbundle bytes.Buffer
+		gzw := gzip.NewWriter(&gzbundle)
+		_, _ = gzw.Write(bundle.Bytes())
+		Expect(gzw.Close()).To(Succeed())
+		opts.NamespaceTypes = species.CLONE_NEWUSER
+		offline, _, err = DiscoverBundle(&gzbundle, opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(offline.Namespaces[UserNS]).To(HaveLen(len(live.Namespaces[UserNS])))
+		Expect(offline.Namespaces[NetNS]).To(BeEmpty())
+		Expect(offline.Processes[sleepypid].Namespaces[NetNS]).To(BeNil())
+	})
+
+	It("maps PIDs offline", func() {
+		unshare := exec.Command("unshare", "-Upfr", "sleep", "60")
+		Expect(unshare.Start()).To(Succeed())
+		defer func() {
+			_ = unshare.Process.Kill()
+			_ = unshare.Wait()
+		}()
+		unsharepid := PIDType(unshare.Process.Pid)
+		var sleepypid PIDType
+		Eventually(func() PIDType {
+			for _, proc := range NewProcessTable() {
+				if proc.PPID == unsharepid && proc.Name == "sleep" {
+					sleepypid = proc.PID
+				}
+			}
+			return sleepypid
+		}).ShouldNot(BeZero())
+
+		var bundle bytes.Buffer
+		live, err := Capture(&bundle, FullDiscovery)
+		Expect(err).NotTo(HaveOccurred())
+		offline, _, err := DiscoverBundle(&bundle, FullDiscovery)
+		Expect(err).NotTo(HaveOccurred())
+
+		livepids := NewPIDMap(live).ProcessPIDs(live.Processes[sleepypid])
+		Expect(livepids).To(HaveLen(2))
+		pidmap := NewPIDMap(offline)
+		offlinepids := pidmap.ProcessPIDs(offline.Processes[sleepypid])
+		Expect(offlinepids).To(HaveLen(2))
+		for idx, el := range offlinepids {
+			Expect(el.PID).To(Equal(livepids[idx].PID))
+			Expect(el.PIDNS.ID()).To(Equal(livepids[idx].PIDNS.ID()))
+		}
+		Expect(offlinepids[1].PID).To(Equal(PIDType(1)))
+		// There are no tasks in bundles, so we must not map tasks from the
+		// host's proc filesystem instead.
+		Expect(pidmap.TIDProcess(sleepypid, offlinepids[0].PIDNS)).To(BeNil())
+
+		// Processes for which there are no captured namespaced PIDs must not
+		// be looked up using the namespace references of the captured host.
+		delete(offline.nspids, sleepypid)
+		pidmap = NewPIDMap(offline)
+		Expect(pidmap.ProcessPIDs(offline.Processes[sleepypid])).To(BeNil())
+		Expect(pidmap.Unmapped()[sleepypid]).To(MatchError(ErrNoNSpid))
+	})
+
+	It("never validates offline processes", func() {
+		opts := NoDiscovery
+		opts.SkipProcs = false
+		var bundle bytes.Buffer
+		_, err := Capture(&bundle, opts)
+		Expect(err).NotTo(HaveOccurred())
+		offline, _, err := DiscoverBundle(&bundle, opts)
+		Expect(err).NotTo(HaveOccurred())
+		proc := offline.Processes[PIDType(os.Getpid())]
+		Expect(proc).NotTo(BeNil())
+		Expect(proc.Valid()).To(BeFalse())
+		Expect(proc.OpenPIDFD()).To(MatchError(ErrForeignProcRoot))
+	})
+
+	It("restores labels", func() {
+		opts := NoDiscovery
+		opts.SkipProcs = false
+		opts.NamespaceTypes = species.CLONE_NEWNET
+		opts.Decorators = []Decorator{&labellingDecorator{}}
+		var bundle bytes.Buffer
+		_, err := Capture(&bundle, opts)
+		Expect(err).NotTo(HaveOccurred())
+		offline, _, err := DiscoverBundle(&bundle, NoDiscovery)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(offline.Namespaces[NetNS]).NotTo(BeEmpty())
+		for _, ns := range offline.Namespaces[NetNS] {
+			Expect(ns.Labels()).To(HaveKeyWithValue("net", "work"))
+		}
+		Expect(offline.Processes[PIDType(os.Getpid())].Labels).To(
+			HaveKeyWithValue("self", "ish"))
+	})
+
+	It("rejects invalid bundles", func() {
+		_, _, err := DiscoverBundle(bytes.NewReader([]byte("garbage")), FullDiscovery)
+		Expect(errors.Is(err, ErrInvalidBundle)).To(BeTrue())
+
+		var bundle bytes.Buffer
+		tw := tar.NewWriter(&bundle)
+		Expect(tw.Close()).To(Succeed())
+		_, _, err = DiscoverBundle(&bundle, FullDiscovery)
+		Expect(errors.Is(err, ErrInvalidBundle)).To(BeTrue())
+	})
+
+	It("doesn't extract outside the bundle", func() {
+		outside := fmt.Sprintf("/tmp/lxkns-bundle-test-%d", os.Getpid())
+		defer os.Remove(outside)
+		var bundle bytes.Buffer
+		tw := tar.NewWriter(&bundle)
+		for _, hdr := range []*tar.Header{
+			{Typeflag: tar.TypeSymlink, Name: "proc/1", Linkname: "/tmp"},
+			{Typeflag: tar.TypeSymlink, Name: "proc/2/ns/net", Linkname: "/tmp"},
+		} {
+			Expect(tw.WriteHeader(hdr)).To(Succeed())
+		}
+		for _, name := range []string{
+			"../" + outside,
+			outside,
+			"proc/1/" + outside[len("/tmp/"):],
+			"proc/2/ns/net/stat",
+		} {
+			Expect(tw.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: 1,
+			})).To(Succeed())
+			_, err := tw.Write([]byte("X"))
+			Expect(err).NotTo(HaveOccurred())
+		}
+		meta := []byte(`{"info":{"version":1},"namespaces":[]}`)
+		Expect(tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg, Name: "lxkns.json", Mode: 0644, Size: int64(len(meta)),
+		})).To(Succeed())
+		_, err := tw.Write(meta)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tw.Close()).To(Succeed())
+
+		offline, _, err := DiscoverBundle(&bundle, FullDiscovery)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(offline.Processes).To(BeEmpty())
+		_, err = os.Lstat(outside)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+})
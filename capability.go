@@ -0,0 +1,235 @@
+// Evaluates whether processes have capabilities in namespaces, following the
+// rules of the Linux kernel.
+
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// +build linux
+
+package lxkns
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CapabilityNames maps Linux capability numbers to their names, such as
+// "CAP_SYS_ADMIN" for capability 21.
+var CapabilityNames = []string{
+	"CAP_CHOWN",
+	"CAP_DAC_OVERRIDE",
+	"CAP_DAC_READ_SEARCH",
+	"CAP_FOWNER",
+	"CAP_FSETID",
+	"CAP_KILL",
+	"CAP_SETGID",
+	"CAP_SETUID",
+	"CAP_SETPCAP",
+	"CAP_LINUX_IMMUTABLE",
+	"CAP_NET_BIND_SERVICE",
+	"CAP_NET_BROADCAST",
+	"CAP_NET_ADMIN",
+	"CAP_NET_RAW",
+	"CAP_IPC_LOCK",
+	"CAP_IPC_OWNER",
+	"CAP_SYS_MODULE",
+	"CAP_SYS_RAWIO",
+	"CAP_SYS_CHROOT",
+	"CAP_SYS_PTRACE",
+	"CAP_SYS_PACCT",
+	"CAP_SYS_ADMIN",
+	"CAP_SYS_BOOT",
+	"CAP_SYS_NICE",
+	"CAP_SYS_RESOURCE",
+	"CAP_SYS_TIME",
+	"CAP_SYS_TTY_CONFIG",
+	"CAP_MKNOD",
+	"CAP_LEASE",
+	"CAP_AUDIT_WRITE",
+	"CAP_AUDIT_CONTROL",
+	"CAP_SETFCAP",
+	"CAP_MAC_OVERRIDE",
+	"CAP_MAC_ADMIN",
+	"CAP_SYSLOG",
+	"CAP_WAKE_ALARM",
+	"CAP_BLOCK_SUSPEND",
+	"CAP_AUDIT_READ",
+	"CAP_PERFMON",
+	"CAP_BPF",
+	"CAP_CHECKPOINT_RESTORE",
+}
+
+// CapabilityName returns the name of the specified capability, or its number
+// in case it is unknown.
+func CapabilityName(capability int) string {
+	if capability >= 0 && capability < len(CapabilityNames) {
+		return CapabilityNames[capability]
+	}
+	return fmt.Sprintf("CAP_%d", capability)
+}
+
+// CapabilityByName returns the capability number for the specified
+// capability name; the name is case-insensitive and the "CAP_" prefix is
+// optional. Returns -1 for unknown capability names.
+func CapabilityByName(name string) int {
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "CAP_") {
+		name = "CAP_" + name
+	}
+	for capability, capname := range CapabilityNames {
+		if capname == name {
+			return capability
+		}
+	}
+	return -1
+}
+
+// ErrNoProcessStatus indicates that a process lacks the status information
+// needed for evaluating its capabilities; see also
+// DiscoverOpts.WithProcessStatus.
+var ErrNoProcessStatus = errors.New("lxkns: process status not discovered")
+
+// CapabilityReason tells why a process has or hasn't a capability in a
+// namespace.
+type CapabilityReason int
+
+// The reasons for a process having or not having a capability in a
+// namespace.
+const (
+	// The process is joined to the user namespace in question and its
+	// effective capabilities contain the capability.
+	CapabilityEffective CapabilityReason = iota
+	// The process is joined to the user namespace in question, but its
+	// effective capabilities lack the capability.
+	CapabilityNotEffective
+	// The process is joined to the parent of a user namespace on the way up
+	// to the user namespace in question, and its effective UID is the owner
+	// of that child user namespace, so it has all capabilities.
+	CapabilityOwner
+	// The user namespace in question is neither the user namespace of the
+	// process, nor one of its descendants.
+	CapabilityOutside
+)
+
+// String returns an explanation of the capability reason.
+func (r CapabilityReason) String() string {
+	switch r {
+	case CapabilityEffective:
+		return "process user namespace, capability effective"
+	case CapabilityNotEffective:
+		return "process user namespace, capability not effective"
+	case CapabilityOwner:
+		return "owned by process effective UID in process user namespace"
+	case CapabilityOutside:
+		return "outside process user namespace hierarchy"
+	}
+	return fmt.Sprintf("CapabilityReason(%d)", int(r))
+}
+
+// CapabilityCheck is the result of checking a process for a capability in a
+// namespace, together with the decision path taken.
+type CapabilityCheck struct {
+	Process    *Process         // process checked.
+	Capability int              // capability checked for.
+	Target     Namespace        // namespace to be operated on.
+	Allowed    bool             // process has the capability in the target namespace?
+	Reason     CapabilityReason // why the process has or hasn't the capability.
+	// The user namespaces visited, starting with the user namespace owning
+	// the target namespace (or the target namespace itself if it is a user
+	// namespace), and then going up the user namespace hierarchy until the
+	// decision was reached.
+	Path []Namespace
+}
+
+// NsCapable checks whether the specified process has the specified capability
+// in the target namespace, following the same rules as the Linux kernel's
+// ns_capable(): the capability is checked against the user namespace owning
+// the target namespace, or against the target namespace itself if it is a
+// user namespace.
+//
+//   - if the process is joined to this user namespace, then the process has
+//     the capability only if it is in its effective capabilities set.
+//   - if this user namespace isn't a descendant of the user namespace of the
+//     process, then the process doesn't have the capability.
+//   - if the parent of this user namespace is the user namespace of the
+//     process and this user namespace was created by the effective UID of the
+//     process, then the process has all capabilities.
+//   - otherwise, the same rules are applied to the parent user namespace.
+//
+// The process needs to have its status discovered, as its effective
+// capabilities and UID are required; see DiscoverOpts.WithProcessStatus.
+// Please note that the kernel might additionally apply other security
+// mechanisms, such as LSMs.
+func NsCapable(proc *Process, capability int, target Namespace) (*CapabilityCheck, error) {
+	if proc.Status == nil {
+		return nil, ErrNoProcessStatus
+	}
+	procuserns := proc.Namespaces[UserNS]
+	if procuserns == nil {
+		return nil, fmt.Errorf("lxkns: user namespace of process %d unknown", proc.PID)
+	}
+	userns := target
+	if target.Type() != procuserns.Type() {
+		owner, ok := target.Owner().(Namespace)
+		if !ok || owner == nil {
+			return nil, fmt.Errorf("lxkns: owning user namespace of %s unknown",
+				target.(NamespaceStringer).TypeIDString())
+		}
+		userns = owner
+	}
+	check := &CapabilityCheck{
+		Process:    proc,
+		Capability: capability,
+		Target:     target,
+	}
+	proclevel := userNamespaceLevel(procuserns)
+	for {
+		check.Path = append(check.Path, userns)
+		if userns == procuserns {
+			check.Allowed = proc.Status.CapEff.Has(capability)
+			if check.Allowed {
+				check.Reason = CapabilityEffective
+			} else {
+				check.Reason = CapabilityNotEffective
+			}
+			return check, nil
+		}
+		if userNamespaceLevel(userns) <= proclevel {
+			check.Reason = CapabilityOutside
+			return check, nil
+		}
+		parent, _ := userns.(Hierarchy).Parent().(Namespace)
+		if parent == procuserns &&
+			userns.(Ownership).UID() == int(proc.Status.EUID) {
+			check.Allowed = true
+			check.Reason = CapabilityOwner
+			return check, nil
+		}
+		if parent == nil {
+			check.Reason = CapabilityOutside
+			return check, nil
+		}
+		userns = parent
+	}
+}
+
+// userNamespaceLevel returns the nesting level of the specified user
+// namespace, with the topmost user namespace having level 0.
+func userNamespaceLevel(userns Namespace) (level int) {
+	for hns := userns.(Hierarchy).Parent(); hns != nil; hns = hns.Parent() {
+		level++
+	}
+	return
+}
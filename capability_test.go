@@ -0,0 +1,154 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package lxkns
+
+import (
+	"os"
+
+	"github.com/thediveo/lxkns/species"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("capabilities", func() {
+
+	const netadmin = 12
+
+	It("maps capability names", func() {
+		Expect(CapabilityName(21)).To(Equal("CAP_SYS_ADMIN"))
+		Expect(CapabilityName(666)).To(Equal("CAP_666"))
+		Expect(CapabilityByName("CAP_NET_ADMIN")).To(Equal(netadmin))
+		Expect(CapabilityByName("net_admin")).To(Equal(netadmin))
+		Expect(CapabilityByName("CAP_FOOBAR")).To(Equal(-1))
+	})
+
+	Describe("ns_capable", func() {
+
+		// The user namespace hierarchy is u0 -> u1 -> u2, with u1 and u2
+		// created by UID 1000; each user namespace owns a network namespace.
+		var u0, u1, u2, n0, n1, n2 Namespace
+
+		BeforeEach(func() {
+			id := func(ino uint64) species.NamespaceID {
+				return species.NamespaceID{Dev: 1, Ino: ino}
+			}
+			u0 = NewNamespace(species.CLONE_NEWUSER, id(10), "")
+			u1 = NewNamespace(species.CLONE_NEWUSER, id(11), "")
+			u2 = NewNamespace(species.CLONE_NEWUSER, id(12), "")
+			u1.(*userNamespace).owneruid = 1000
+			u2.(*userNamespace).owneruid = 1000
+			u0.(HierarchyConfigurer).AddChild(u1.(Hierarchy))
+			u1.(HierarchyConfigurer).AddChild(u2.(Hierarchy))
+			usernsmap := NamespaceMap{u0.ID(): u0, u1.ID(): u1, u2.ID(): u2}
+			netns := func(ino uint64, owner Namespace) Namespace {
+				ns := NewNamespace(species.CLONE_NEWNET, id(ino), "")
+				ns.(NamespaceConfigurer).SetOwner(owner.ID())
+				ns.(NamespaceConfigurer).ResolveOwner(usernsmap)
+				return ns
+			}
+			n0, n1, n2 = netns(20, u0), netns(21, u1), netns(22, u2)
+		})
+
+		proc := func(userns Namespace, euid uint32, caps CapabilitySet) *Process {
+			p := &Process{PID: 42, Status: &ProcessStatus{EUID: euid, CapEff: caps}}
+			p.Namespaces[UserNS] = userns
+			return p
+		}
+
+		It("uses effective capabilities in the process' user namespace", func() {
+			check, err := NsCapable(proc(u0, 0, 1<<netadmin), netadmin, n0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(check.Allowed).To(BeTrue())
+			Expect(check.Reason).To(Equal(CapabilityEffective))
+			Expect(check.Path).To(Equal([]Namespace{u0}))
+
+			check, err = NsCapable(proc(u0, 0, 1<<21), netadmin, n0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(check.Allowed).To(BeFalse())
+			Expect(check.Reason).To(Equal(CapabilityNotEffective))
+		})
+
+		It("grants all capabilities to the owner in the parent user namespace", func() {
+			check, err := NsCapable(proc(u0, 1000, 0), netadmin, n1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(check.Allowed).To(BeTrue())
+			Expect(check.Reason).To(Equal(CapabilityOwner))
+			Expect(check.Path).To(Equal([]Namespace{u1}))
+
+			check, err = NsCapable(proc(u0, 1000, 0), netadmin, n2)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(check.Allowed).To(BeTrue())
+			Expect(check.Path).To(Equal([]Namespace{u2, u1}))
+
+			check, err = NsCapable(proc(u0, 1000, 0), netadmin, u1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(check.Allowed).To(BeTrue())
+			Expect(check.Path).To(Equal([]Namespace{u1}))
+		})
+
+		It("falls back to the process' user namespace for non-owners", func() {
+			check, err := NsCapable(proc(u0, 1001, 0), netadmin, n2)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(check.Allowed).To(BeFalse())
+			Expect(check.Reason).To(Equal(CapabilityNotEffective))
+			Expect(check.Path).To(Equal([]Namespace{u2, u1, u0}))
+
+			check, err = NsCapable(proc(u0, 1001, ^CapabilitySet(0)), netadmin, n2)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(check.Allowed).To(BeTrue())
+		})
+
+		It("denies capabilities outside the process' user namespace", func() {
+			check, err := NsCapable(proc(u1, 0, ^CapabilitySet(0)), netadmin, n0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(check.Allowed).To(BeFalse())
+			Expect(check.Reason).To(Equal(CapabilityOutside))
+			Expect(check.Path).To(Equal([]Namespace{u0}))
+
+			check, err = NsCapable(proc(u2, 1000, ^CapabilitySet(0)), netadmin, n1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(check.Allowed).To(BeFalse())
+			Expect(check.Reason).To(Equal(CapabilityOutside))
+		})
+
+		It("reports missing information", func() {
+			_, err := NsCapable(&Process{PID: 42}, netadmin, n0)
+			Expect(err).To(Equal(ErrNoProcessStatus))
+			_, err = NsCapable(proc(nil, 0, 0), netadmin, n0)
+			Expect(err).To(MatchError(ContainSubstring("user namespace of process 42 unknown")))
+			_, err = NsCapable(proc(u0, 0, 0), netadmin,
+				NewNamespace(species.CLONE_NEWNET, species.NamespaceID{Dev: 1, Ino: 666}, ""))
+			Expect(err).To(MatchError(ContainSubstring("owning user namespace of net:[666] unknown")))
+		})
+
+		It("explains reasons", func() {
+			Expect(CapabilityOwner.String()).To(ContainSubstring("owned by"))
+			Expect(CapabilityReason(42).String()).To(Equal("CapabilityReason(42)"))
+		})
+
+	})
+
+	It("evaluates capabilities of discovered processes", func() {
+		opts := FullDiscovery
+		opts.WithProcessStatus = true
+		allns := Discover(opts)
+		me := allns.Processes[PIDType(os.Getpid())]
+		check, err := NsCapable(me, netadmin, me.Namespaces[NetNS])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(check.Allowed).To(Equal(me.Status.CapEff.Has(netadmin)))
+	})
+
+})
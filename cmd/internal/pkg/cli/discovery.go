@@ -0,0 +1,121 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package cli
+
+import (
+	"errors"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/thediveo/go-plugger"
+	"github.com/thediveo/lxkns"
+	"github.com/thediveo/lxkns/decorator/systemd"
+)
+
+// captureFile is the name of the file to write a capture bundle to, if any.
+var captureFile string
+
+// bundleFile is the name of the capture bundle to discover from instead of
+// the live system, if any.
+var bundleFile string
+
+// bundleInfo describes the bundle discovered from, if any.
+var bundleInfo *lxkns.BundleInfo
+
+// DiscoveryOptions returns the options for a full namespace discovery as run
+// by the CLI tools, including decorating processes with their systemd units.
+func DiscoveryOptions() lxkns.DiscoverOpts {
+	opts := lxkns.FullDiscovery
+	opts.Decorators = []lxkns.Decorator{systemd.NewDecorator()}
+	return opts
+}
+
+// Discover runs a namespace discovery using the specified options. Depending
+// on the "--capture" and "--bundle" flags, it additionally captures the live
+// system into a bundle, or discovers from a bundle instead of the live
+// system. Finally, if requested by the "--stats" flag, it prints the
+// discovery statistics to stderr.
+func Discover(opts lxkns.DiscoverOpts) (allns *lxkns.DiscoveryResult, err error) {
+	switch {
+	case bundleFile != "":
+		var f *os.File
+		if f, err = os.Open(bundleFile); err != nil {
+			return
+		}
+		defer f.Close()
+		allns, bundleInfo, err = lxkns.DiscoverBundle(f, opts)
+	case captureFile != "":
+		var f *os.File
+		if f, err = os.Create(captureFile); err != nil {
+			return
+		}
+		allns, err = lxkns.Capture(f, opts)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	default:
+		allns = lxkns.Discover(opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if showStats {
+		RenderStats(os.Stderr, &allns.Stats)
+	}
+	return
+}
+
+// SelfPID returns the PID of the process which discovered the namespaces:
+// usually this is the PID of this process, except when discovering from a
+// bundle, where it is the PID of the process which captured the bundle.
+func SelfPID() lxkns.PIDType {
+	if bundleInfo != nil {
+		return bundleInfo.PID
+	}
+	return lxkns.PIDType(os.Getpid())
+}
+
+// Register our plugin functions for delayed registration of the "--capture"
+// and "--bundle" flags, and for checking them before the command runs.
+func init() {
+	plugger.RegisterPlugin(&plugger.PluginSpec{
+		Name:  "bundle",
+		Group: "cli",
+		Symbols: []plugger.Symbol{
+			plugger.NamedSymbol{Name: "SetupCLI", Symbol: BundleSetupCLI},
+			plugger.NamedSymbol{Name: "BeforeRun", Symbol: BundleBeforeRun},
+		},
+	})
+}
+
+// BundleSetupCLI adds the "--capture" and "--bundle" flags to the specified
+// command.
+func BundleSetupCLI(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&captureFile,
+		"capture", "",
+		"captures the discovered processes and namespaces into a bundle file")
+	cmd.PersistentFlags().StringVar(&bundleFile,
+		"bundle", "",
+		"discovers from a bundle file captured before, instead of from this system")
+}
+
+// BundleBeforeRun checks that capturing and discovering from a bundle aren't
+// requested at the same time.
+func BundleBeforeRun() error {
+	if captureFile != "" && bundleFile != "" {
+		return errors.New("--capture and --bundle cannot be used together")
+	}
+	return nil
+}
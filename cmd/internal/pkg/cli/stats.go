@@ -0,0 +1,69 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/thediveo/go-plugger"
+	"github.com/thediveo/lxkns"
+)
+
+// showStats enables printing the discovery statistics after the discovery.
+var showStats bool
+
+// RenderStats renders the specified discovery statistics as a table, with
+// one line per discovery phase and a final line with the totals.
+func RenderStats(out io.Writer, stats *lxkns.DiscoveryStats) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PHASE\tTYPE\tDURATION\tPROCS\tFDS\tREEXECS\tNAMESPACES\t")
+	row := func(phase, nstype string, ps lxkns.PhaseStats) {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t\n",
+			phase, nstype, ps.Duration, ps.Processes, ps.Fds, ps.Reexecs, ps.Namespaces)
+	}
+	for _, ps := range stats.Phases {
+		nstype := "*"
+		if lxkns.TypeIndex(ps.Type) >= 0 {
+			nstype = ps.Type.Name()
+		}
+		row(ps.Phase, nstype, ps)
+	}
+	totals := stats.Totals()
+	totals.Duration = stats.Duration
+	row("total", "", totals)
+	w.Flush()
+}
+
+// Register our plugin function for delayed registration of the "--stats"
+// flag.
+func init() {
+	plugger.RegisterPlugin(&plugger.PluginSpec{
+		Name:  "stats",
+		Group: "cli",
+		Symbols: []plugger.Symbol{
+			plugger.NamedSymbol{Name: "SetupCLI", Symbol: StatsSetupCLI},
+		},
+	})
+}
+
+// StatsSetupCLI adds the "--stats" flag to the specified command.
+func StatsSetupCLI(cmd *cobra.Command) {
+	cmd.PersistentFlags().BoolVar(&showStats,
+		"stats", false,
+		"prints discovery statistics, such as phase durations, to stderr")
+}
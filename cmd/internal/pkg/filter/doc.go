@@ -1,7 +1,9 @@
 /*
 
 Package filter provides CLI-controlled filtering of namespaces by type. It
-provides the CLI commands "--filter" flag.
+provides the CLI commands "--filter" flag, as well as the "--named-netns" flag
+for showing only named network namespaces; the latter needs to be explicitly
+added only to those commands showing network namespaces.
 
 */
 package filter
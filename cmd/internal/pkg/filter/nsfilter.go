@@ -30,13 +30,25 @@ func Filter(ns lxkns.Namespace) bool {
 			filterMask |= f
 		}
 	}
-	return ns.Type()&filterMask != 0
+	if ns.Type()&filterMask == 0 {
+		return false
+	}
+	// Optionally let only named network namespaces pass.
+	if namedNetnsOnly && ns.Type() == species.CLONE_NEWNET {
+		_, ok := ns.Labels()[lxkns.NameLabel]
+		return ok
+	}
+	return true
 }
 
 // filterMask is a set of OR'ed namespace CLONE_NEWxx constants indicating the
 // type of namespaces allowed to pass the filter.
 var filterMask species.NamespaceType
 
+// namedNetnsOnly lets only those network namespaces pass the filter which
+// have a human-readable name, such as when created using "ip netns add".
+var namedNetnsOnly bool
+
 // The user-controlled namespace filters; they default to showing all types of
 // Linux-kernel namespaces.
 var namespaceFilters = []species.NamespaceType{
@@ -83,3 +95,13 @@ func FilterSetupCLI(cmd *cobra.Command) {
 		"shows only selected namespace types; can be 'cgroup'/'c', 'ipc'/'i', 'mnt'/'m',\n"+
 			"'net'/'n', 'pid'/'p', 'user'/'U', 'uts'/'u'")
 }
+
+// NamedNetnsSetupCLI adds the "--named-netns" flag to the specified command.
+// As this flag only makes sense for commands showing network namespaces, it
+// isn't registered as a plugin for all CLI commands, but instead commands
+// need to explicitly add it.
+func NamedNetnsSetupCLI(cmd *cobra.Command) {
+	cmd.PersistentFlags().BoolVar(&namedNetnsOnly,
+		"named-netns", false,
+		"shows only named network namespaces, such as created by 'ip netns'")
+}
@@ -21,6 +21,7 @@ import (
 
 	"github.com/thediveo/lxkns"
 	"github.com/thediveo/lxkns/cmd/internal/pkg/style"
+	"github.com/thediveo/lxkns/decorator/systemd"
 )
 
 // NamespaceReferenceLabel returns a string describing a reference to the
@@ -31,9 +32,10 @@ import (
 // versus all leader processes)
 func NamespaceReferenceLabel(ns lxkns.Namespace) string {
 	if ancient := ns.Ealdorman(); ancient != nil {
-		return fmt.Sprintf("process %q (%d)",
+		return fmt.Sprintf("process %q (%d)%s",
 			style.ProcessStyle.V(style.ProcessName(ancient)),
-			ancient.PID)
+			ancient.PID,
+			ProcessUnitLabel(ancient))
 	}
 	if ref := ns.Ref(); ref != "" {
 		// TODO: deal with references in other mount namespaces :)
@@ -43,6 +45,32 @@ func NamespaceReferenceLabel(ns lxkns.Namespace) string {
 	return ""
 }
 
+// NamespaceNameLabel returns the human-readable name of the specified
+// namespace, such as the name of a network namespace created by "ip netns",
+// as a string suitable for appending to a namespace's type and ID. If the
+// namespace has no name, then an empty string is returned instead.
+func NamespaceNameLabel(ns lxkns.Namespace) string {
+	if name, ok := ns.Labels()[lxkns.NameLabel]; ok {
+		return fmt.Sprintf(" «%s»", style.Styles[ns.Type().Name()].V(name))
+	}
+	return ""
+}
+
+// ProcessUnitLabel returns the systemd unit the specified process belongs to,
+// as a string suitable for appending to a process name and PID. If the process
+// hasn't been labelled with its systemd unit, then an empty string is returned
+// instead.
+func ProcessUnitLabel(proc *lxkns.Process) string {
+	unit, ok := proc.Labels[systemd.UnitLabel]
+	if !ok {
+		return ""
+	}
+	if userunit, ok := proc.Labels[systemd.UserUnitLabel]; ok {
+		unit += " » " + userunit
+	}
+	return fmt.Sprintf(" in unit %s", style.ProcessStyle.V(unit))
+}
+
 /*
 	if leaders := ns.Leaders(); len(leaders) > 0 {
 			sorted := make([]*lxkns.Process, len(leaders))
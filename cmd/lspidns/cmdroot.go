@@ -35,13 +35,14 @@ var rootCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, _ []string) error {
 		user, _ := cmd.PersistentFlags().GetBool("user")
 		// Run a full namespace discovery.
-		allns := lxkns.Discover(lxkns.FullDiscovery)
+		allns, err := cli.Discover(cli.DiscoveryOptions())
+		if err != nil {
+			return err
+		}
 		fmt.Println(
 			asciitree.Render(
-				allns.PIDNSRoots,
-				&PIDNSVisitor{
-					ShowUserNS: user,
-				},
+				PIDNSTree(allns.PIDNSRoots, user),
+				asciitree.NewMapStructVisitor(false, false),
 				style.NamespaceStyler))
 		return nil
 	},
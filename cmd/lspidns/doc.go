@@ -21,12 +21,15 @@ Flags
 
 The following lspidns flags are available:
 
+        --bundle string          discovers from a bundle file captured before, instead of from this system
+        --capture string         captures the discovered processes and namespaces into a bundle file
     -c, --color color[=always]   colorize the output; can be 'always' (default if omitted), 'auto',
                                  or 'never' (default auto)
         --dump                   dump colorization theme to stdout (for saving to ~/.lxknsrc.yaml)
     -h, --help                   help for lspidns
         --proc proc[=name]       process name style; can be 'name' (default if omitted), 'basename',
                                  or 'exe' (default name)
+        --stats                  prints discovery statistics, such as phase durations, to stderr
         --theme theme            colorization theme 'dark' or 'light' (default dark)
         --treestyle treestyle    select the tree render style; can be 'line' (default if omitted)
                                  or 'ascii' (default line)
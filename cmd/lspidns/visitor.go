@@ -20,66 +20,117 @@ package main
 import (
 	"fmt"
 	"os/user"
-	"reflect"
 
 	"github.com/thediveo/lxkns"
 	"github.com/thediveo/lxkns/cmd/internal/pkg/output"
 	"github.com/thediveo/lxkns/cmd/internal/pkg/style"
+	"github.com/thediveo/lxkns/species"
 )
 
-// PIDNSVisitor is an asciitree.Visitor which starts from a list (slice) of root
-// PID namespaces and then recursively dives into the PID namespace hierarchy,
-// optionally showing the intermediate user namespaces owing PID namespaces.
-type PIDNSVisitor struct {
-	ShowUserNS bool
+// PIDNSNode is a PID or user namespace node of the rendered tree.
+type PIDNSNode struct {
+	Label    string       `asciitree:"label"`
+	Children []*PIDNSNode `asciitree:"children"`
+	ns       lxkns.Namespace
 }
 
-// Roots returns the given topmost hierarchical PID namespaces sorted. Well, to
-// be honest, it returns the owning user namespaces instead in case user
-// namespaces should be shown too.
-func (v *PIDNSVisitor) Roots(roots reflect.Value) (children []reflect.Value) {
-	pidroots := lxkns.SortNamespaces(roots.Interface().([]lxkns.Namespace))
-	if !v.ShowUserNS {
-		// When only showing PID namespaces, then sort all PID "root" namespaces
-		// numerically and then visit them, descending down the hierarchy.
-		count := len(pidroots)
-		children = make([]reflect.Value, count)
-		for idx := 0; idx < count; idx++ {
-			children[idx] = reflect.ValueOf(pidroots[idx])
+// PIDNSTree walks the PID namespace hierarchy starting from the specified
+// root PID namespaces, returning the tree of namespace nodes ready for
+// rendering. With showuserns, the tree instead starts from the user
+// namespaces owning the root PID namespaces, and user namespaces get inserted
+// into the PID namespace hierarchy wherever the owning user namespace
+// changes.
+func PIDNSTree(pidroots []lxkns.Namespace, showuserns bool) []*PIDNSNode {
+	tree := []*PIDNSNode{}
+	nodes := map[*lxkns.WalkNode]*PIDNSNode{}
+	add := func(node *lxkns.WalkNode, nsnode *PIDNSNode) {
+		nodes[node] = nsnode
+		if node.Parent == nil {
+			tree = append(tree, nsnode)
+			return
 		}
-		return
+		parent := nodes[node.Parent]
+		parent.Children = append(parent.Children, nsnode)
 	}
-	// When showing the owning user namespaces in the tree, find the (unique)
-	// user namespaces for all PID "root" namespaces, so we start with the user
-	// namespaces.
-	userns := map[lxkns.Namespace]bool{}
-	for _, pidns := range pidroots {
-		userns[pidns.Owner().(lxkns.Namespace)] = true
+	if !showuserns {
+		_ = lxkns.Walk(pidroots, lxkns.WalkOptions{
+			Edges: lxkns.WalkChildren,
+			Pre: func(node *lxkns.WalkNode) error {
+				add(node, &PIDNSNode{Label: namespaceLabel(node.Namespace)})
+				return nil
+			},
+		})
+		return tree
 	}
+	// Start with the (unique) user namespaces owning the root PID namespaces.
 	userroots := []lxkns.Namespace{}
-	for uns := range userns {
-		userroots = append(userroots, uns.(lxkns.Namespace))
-	}
-	userroots = lxkns.SortNamespaces(userroots)
-	count := len(userroots)
-	children = make([]reflect.Value, count)
-	for idx := 0; idx < count; idx++ {
-		children[idx] = reflect.ValueOf(userroots[idx])
+	seen := map[lxkns.Namespace]bool{}
+	for _, pidns := range pidroots {
+		if userns := pidns.Owner().(lxkns.Namespace); !seen[userns] {
+			seen[userns] = true
+			userroots = append(userroots, userns)
+		}
 	}
-	return
+	_ = lxkns.Walk(userroots, lxkns.WalkOptions{
+		Edges: lxkns.WalkOwned | lxkns.WalkChildren,
+		Pre: func(node *lxkns.WalkNode) error {
+			ns := node.Namespace
+			switch {
+			case node.Parent == nil:
+				add(node, &PIDNSNode{Label: namespaceLabel(ns), ns: ns})
+				return nil
+			case ns.Type() != species.CLONE_NEWPID:
+				// We're neither interested in the other owned namespaces,
+				// nor in the child user namespaces.
+				return lxkns.SkipChildren
+			case node.Edge == lxkns.WalkOwned:
+				// Only take the topmost owned PID namespaces, as the others
+				// get visited as children of their parent PID namespaces.
+				if ppidns := ns.(lxkns.Hierarchy).Parent(); ppidns != nil &&
+					ppidns.(lxkns.Namespace).Owner() == ns.Owner() {
+					return lxkns.SkipChildren
+				}
+				add(node, &PIDNSNode{Label: namespaceLabel(ns), ns: ns})
+				return nil
+			}
+			// A child PID namespace owned by a different user namespace than
+			// its parent PID namespace gets placed beneath its owning user
+			// namespace.
+			pidnsnode := &PIDNSNode{Label: namespaceLabel(ns), ns: ns}
+			nodes[node] = pidnsnode
+			parent := nodes[node.Parent]
+			if owner := ns.Owner(); owner != node.Parent.Namespace.Owner() {
+				parent = parent.child(owner.(lxkns.Namespace))
+			}
+			parent.Children = append(parent.Children, pidnsnode)
+			return nil
+		},
+	})
+	return tree
 }
 
-// Label returns the text label for a namespace node. Everything else will have
-// no label.
-func (v *PIDNSVisitor) Label(node reflect.Value) (label string) {
-	if ns, ok := node.Interface().(lxkns.Namespace); ok {
-		style := style.Styles[ns.Type().Name()]
-		label = fmt.Sprintf("%s%s %s",
-			output.NamespaceIcon(ns),
-			style.V(ns.(lxkns.NamespaceStringer).TypeIDString()),
-			output.NamespaceReferenceLabel(ns))
+// child returns the child node for the specified namespace, adding a new
+// child node if necessary.
+func (n *PIDNSNode) child(ns lxkns.Namespace) *PIDNSNode {
+	for _, child := range n.Children {
+		if child.ns == ns {
+			return child
+		}
 	}
-	if uns, ok := node.Interface().(lxkns.Ownership); ok {
+	child := &PIDNSNode{Label: namespaceLabel(ns), ns: ns}
+	n.Children = append(n.Children, child)
+	return child
+}
+
+// namespaceLabel returns the text label for a namespace, additionally with
+// the creator UID in case of user namespaces.
+func namespaceLabel(ns lxkns.Namespace) (label string) {
+	label = fmt.Sprintf("%s%s%s %s",
+		output.NamespaceIcon(ns),
+		style.Styles[ns.Type().Name()].V(ns.(lxkns.NamespaceStringer).TypeIDString()),
+		output.NamespaceNameLabel(ns),
+		output.NamespaceReferenceLabel(ns))
+	if uns, ok := ns.(lxkns.Ownership); ok {
 		username := ""
 		if user, err := user.LookupId(fmt.Sprintf("%d", uns.UID())); err == nil {
 			username = fmt.Sprintf(" (%q)", style.OwnerStyle.V(user.Username))
@@ -90,62 +141,3 @@ func (v *PIDNSVisitor) Label(node reflect.Value) (label string) {
 	}
 	return
 }
-
-// Get returns the user namespace text label for the current node (which is
-// always an user namespace), as well as the list of properties (owned
-// non-user namespaces) and the list of child user namespace nodes.
-func (v *PIDNSVisitor) Get(node reflect.Value) (
-	label string, properties []string, children reflect.Value) {
-	// Label for this PID (or user) namespace; this is the easy part ;)
-	label = v.Label(node)
-	// For a user namespace, its children are the owned PID namespaces ... but
-	// ... we must only take the topmost owned PID namespaces, otherwise the
-	// result isn't exactly correct and we would all subtrees mirrored to the
-	// topmost level. Now, a "topmost" owned PID namespace is one that either
-	// has no parent PID namespace, or the parent PID namespace has a different
-	// owner. That's all that's to it.
-	if uns, ok := node.Interface().(lxkns.Ownership); ok {
-		clist := []lxkns.Namespace{}
-		for _, ns := range uns.Ownings()[lxkns.PIDNS] {
-			pidns := ns.(lxkns.Hierarchy)
-			ppidns := pidns.Parent()
-			if ppidns == nil || ppidns.(lxkns.Namespace).Owner() != uns.(lxkns.Ownership) {
-				clist = append(clist, ns)
-			}
-		}
-		children = reflect.ValueOf(lxkns.SortNamespaces(clist))
-		return
-	}
-	// For a PID namespace, the children are either PID namespaces, or user
-	// namespaces in case a child PID namespace lives in a different user
-	// namespace.
-	clist := []interface{}{}
-	if hns, ok := node.Interface().(lxkns.Hierarchy); ok {
-		if !v.ShowUserNS {
-			// Show only the PID namespace hierarchy: this is easy, as we all we
-			// need to do is to take all child PID namespaces and return them.
-			// That's it.
-			for _, cpidns := range lxkns.SortChildNamespaces(hns.Children()) {
-				clist = append(clist, cpidns)
-			}
-		} else {
-			// Insert user namespaces into the PID namespace hierarchy, whenever
-			// there is a change of user namespaces in the PID hierarchy.
-			userns := node.Interface().(lxkns.Namespace).Owner()
-			for _, cpidns := range lxkns.SortChildNamespaces(hns.Children()) {
-				if ownerns := cpidns.(lxkns.Namespace).Owner(); ownerns == userns {
-					// The child PID namespace is still in the same user namespace,
-					// so we take it as a direct child.
-					clist = append(clist, cpidns)
-				} else {
-					// The child PID namespace is in a different user namespace, so
-					// we take the child's user namespace instead and will visit the
-					// child PID namespace only later via the user namespace.
-					clist = append(clist, ownerns)
-				}
-			}
-		}
-	}
-	children = reflect.ValueOf(clist)
-	return
-}
@@ -0,0 +1,71 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	asciitree "github.com/thediveo/go-asciitree"
+	"github.com/thediveo/lxkns"
+	"github.com/thediveo/lxkns/cmd/internal/pkg/cli"
+	"github.com/thediveo/lxkns/cmd/internal/pkg/filter"
+	"github.com/thediveo/lxkns/cmd/internal/pkg/style"
+	"github.com/thediveo/lxkns/decorator/oci"
+)
+
+var rootCmd = &cobra.Command{
+	Use:     "lssandbox",
+	Short:   "lssandbox lists sandboxes of processes sharing the same namespaces",
+	Version: lxkns.SemVersion,
+	Args:    cobra.NoArgs,
+	PersistentPreRunE: func(_ *cobra.Command, _ []string) error {
+		return cli.BeforeCommand()
+	},
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		shared, _ := cmd.PersistentFlags().GetBool("shared")
+		// Run a full namespace discovery, additionally looking for
+		// containers, so sandboxes can be related to them.
+		opts := cli.DiscoveryOptions()
+		opts.Decorators = append(opts.Decorators, oci.NewDecorator())
+		allns, err := cli.Discover(opts)
+		if err != nil {
+			return err
+		}
+		renderSandboxes(os.Stdout, lxkns.Sandboxes(allns.Processes), shared)
+		return nil
+	},
+}
+
+// Sets up the flags.
+func init() {
+	rootCmd.PersistentFlags().BoolP(
+		"shared", "s", false,
+		"shows only namespaces shared with other sandboxes")
+	filter.NamedNetnsSetupCLI(rootCmd)
+	cli.AddFlags(rootCmd)
+}
+
+// Renders the specified sandboxes together with their namespaces, optionally
+// only the namespaces shared with other sandboxes.
+func renderSandboxes(out io.Writer, sandboxes []*lxkns.Sandbox, sharedonly bool) {
+	fmt.Fprintln(out,
+		asciitree.Render(
+			SandboxTree(sandboxes, sharedonly),
+			asciitree.NewMapStructVisitor(false, false),
+			style.NamespaceStyler))
+}
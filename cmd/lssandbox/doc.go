@@ -0,0 +1,55 @@
+/*
+
+lssandbox lists "sandboxes", that is, groups of processes joined to exactly
+the same set of namespaces, together with their namespaces. Sandboxes usually
+correspond with containers; in case of container pods, the sandboxes of a pod
+share some of their namespaces, such as the network and IPC namespaces, but
+not their mount namespaces.
+
+Sandboxes are named after their namespace names (if any), or otherwise after
+their most senior processes. If a sandbox belongs to a container, then the
+container ID is shown too.
+
+Usage
+
+To use lssandbox:
+
+    lssandbox [flag]
+
+For example, to view the colorized list of sandboxes in a pager:
+
+    lssandbox -c | less -SR
+
+Show only those namespaces which are shared between sandboxes:
+
+    lssandbox -s
+
+Flags
+
+The following lssandbox flags are available:
+
+        --bundle string          discovers from a bundle file captured before, instead of from this system
+        --capture string         captures the discovered processes and namespaces into a bundle file
+    -c, --color color[=always]   colorize the output; can be 'always' (default if omitted), 'auto',
+                                 or 'never' (default auto)
+        --dump                   dump colorization theme to stdout (for saving to ~/.lxknsrc.yaml)
+    -f, --filter filter          shows only selected namespace types; can be 'cgroup'/'c', 'ipc'/'i', 'mnt'/'m',
+                                 'net'/'n', 'pid'/'p', 'user'/'U', 'uts'/'u' (default [mnt,cgroup,uts,ipc,user,pid,net])
+    -h, --help                   help for lssandbox
+        --icon                   show/hide unicode icons next to namespaces
+        --named-netns            shows only named network namespaces, such as created by 'ip netns'
+        --proc proc[=name]       process name style; can be 'name' (default if omitted), 'basename',
+                                 or 'exe' (default name)
+    -s, --shared                 shows only namespaces shared with other sandboxes
+        --stats                  prints discovery statistics, such as phase durations, to stderr
+        --theme theme            colorization theme 'dark' or 'light' (default dark)
+        --treestyle treestyle    select the tree render style; can be 'line' (default if omitted)
+                                 or 'ascii' (default line)
+
+Colorization
+
+Please see the lsuns command documentation for how to colorize the output and
+how to adapt the color themes.
+
+*/
+package main
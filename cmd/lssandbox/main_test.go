@@ -0,0 +1,67 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thediveo/lxkns"
+	"github.com/thediveo/lxkns/species"
+)
+
+var _ = Describe("renders sandboxes", func() {
+
+	var sandboxes []*lxkns.Sandbox
+
+	BeforeEach(func() {
+		ns := func(nstype species.NamespaceType, id uint64) lxkns.Namespace {
+			return lxkns.NewNamespace(nstype, species.NamespaceID{Dev: 1, Ino: id}, "")
+		}
+		podnet := ns(species.CLONE_NEWNET, 3)
+		pt := lxkns.ProcessTable{}
+		for _, proc := range []*lxkns.Process{
+			{PID: 42, Name: "app", Namespaces: lxkns.NamespacesSet{
+				lxkns.MountNS: ns(species.CLONE_NEWNS, 1), lxkns.NetNS: podnet}},
+			{PID: 43, Name: "app", Namespaces: lxkns.NamespacesSet{
+				lxkns.MountNS: ns(species.CLONE_NEWNS, 1), lxkns.NetNS: podnet}},
+			{PID: 44, Name: "proxy", Namespaces: lxkns.NamespacesSet{
+				lxkns.MountNS: ns(species.CLONE_NEWNS, 2), lxkns.NetNS: podnet}},
+		} {
+			pt[proc.PID] = proc
+		}
+		sandboxes = lxkns.Sandboxes(pt)
+	})
+
+	It("renders sandboxes with their namespaces", func() {
+		out := bytes.Buffer{}
+		renderSandboxes(&out, sandboxes, false)
+		Expect(out.String()).To(MatchRegexp(`(?m)^sandbox "app": process "app" \(42\) and 1 more processes
+.* mnt:\[1\]
+.* net:\[3\] shared with "proxy" \(44\)
+sandbox "proxy": process "proxy" \(44\)
+.* mnt:\[2\]
+.* net:\[3\] shared with "app" \(42\)$`))
+	})
+
+	It("renders only shared namespaces", func() {
+		out := bytes.Buffer{}
+		renderSandboxes(&out, sandboxes, true)
+		Expect(out.String()).NotTo(ContainSubstring("mnt:"))
+		Expect(out.String()).To(ContainSubstring(`net:[3] shared with "app" (42)`))
+	})
+
+})
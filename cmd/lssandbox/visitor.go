@@ -0,0 +1,109 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/thediveo/lxkns"
+	"github.com/thediveo/lxkns/cmd/internal/pkg/filter"
+	"github.com/thediveo/lxkns/cmd/internal/pkg/output"
+	"github.com/thediveo/lxkns/cmd/internal/pkg/style"
+	"github.com/thediveo/lxkns/decorator/oci"
+)
+
+// SandboxNode is a sandbox node of the rendered list of sandboxes, with the
+// namespaces of the sandbox as its properties. Sandboxes never have children,
+// but the renderer insists on a children field.
+type SandboxNode struct {
+	Label      string         `asciitree:"label"`
+	Namespaces []string       `asciitree:"properties"`
+	Children   []*SandboxNode `asciitree:"children"`
+}
+
+// SandboxTree returns the nodes for the specified sandboxes in their original
+// order, ready for rendering. The namespaces of each sandbox become the
+// properties of its node; if sharedonly is true, then only the namespaces
+// shared with other sandboxes.
+func SandboxTree(sandboxes []*lxkns.Sandbox, sharedonly bool) []*SandboxNode {
+	shared := lxkns.SharedNamespaces(sandboxes)
+	nodes := make([]*SandboxNode, len(sandboxes))
+	for idx, sandbox := range sandboxes {
+		nodes[idx] = &SandboxNode{
+			Label:      sandboxLabel(sandbox),
+			Namespaces: sandboxNamespaces(sandbox, shared, sharedonly),
+		}
+	}
+	return nodes
+}
+
+// sandboxLabel returns the text label for a sandbox, consisting of the
+// sandbox name, its ealdorman process, and optionally its container.
+func sandboxLabel(sandbox *lxkns.Sandbox) (label string) {
+	label = fmt.Sprintf("sandbox %q: process %q (%d)%s",
+		sandbox.Name,
+		style.ProcessStyle.V(style.ProcessName(sandbox.Ealdorman)),
+		sandbox.Ealdorman.PID,
+		output.ProcessUnitLabel(sandbox.Ealdorman))
+	if count := len(sandbox.Processes); count > 1 {
+		label += fmt.Sprintf(" and %d more processes", count-1)
+	}
+	if id, ok := sandbox.Labels[oci.ContainerIDLabel]; ok {
+		label += fmt.Sprintf(", container %s", id)
+	}
+	return
+}
+
+// sandboxNamespaces returns the text labels of the namespaces of a sandbox,
+// optionally only of the namespaces shared with other sandboxes.
+func sandboxNamespaces(sandbox *lxkns.Sandbox, shared []lxkns.SharedNamespace, sharedonly bool) (namespaces []string) {
+	for _, nstype := range lxkns.TypeIndexLexicalOrder {
+		ns := sandbox.Namespaces[nstype]
+		if ns == nil || !filter.Filter(ns) {
+			continue
+		}
+		sharers := sharers(sandbox, ns, shared)
+		if sharedonly && len(sharers) == 0 {
+			continue
+		}
+		style := style.Styles[ns.Type().Name()]
+		s := fmt.Sprintf("%s%s%s",
+			output.NamespaceIcon(ns),
+			style.V(ns.(lxkns.NamespaceStringer).TypeIDString()),
+			output.NamespaceNameLabel(ns))
+		if len(sharers) > 0 {
+			s += " shared with " + strings.Join(sharers, ", ")
+		}
+		namespaces = append(namespaces, s)
+	}
+	return
+}
+
+// sharers returns the names of the other sandboxes sharing the specified
+// namespace with the specified sandbox.
+func sharers(sandbox *lxkns.Sandbox, ns lxkns.Namespace, shared []lxkns.SharedNamespace) (names []string) {
+	for _, shared := range shared {
+		if shared.Namespace.Type() != ns.Type() || shared.Namespace.ID() != ns.ID() {
+			continue
+		}
+		for _, other := range shared.Sandboxes {
+			if other != sandbox {
+				names = append(names, fmt.Sprintf("%q (%d)", other.Name, other.Ealdorman.PID))
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,120 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/thediveo/lxkns"
+	"github.com/thediveo/lxkns/cmd/internal/pkg/cli"
+	"github.com/thediveo/lxkns/cmd/internal/pkg/style"
+	"github.com/thediveo/lxkns/species"
+)
+
+var capableCmd = &cobra.Command{
+	Use:   "capable PID CAPABILITY NAMESPACE",
+	Short: "explains whether a process has a capability in a namespace",
+	Long: "capable explains whether a process has a capability, such as CAP_NET_ADMIN,\n" +
+		"in a namespace, such as \"net:[4026531992]\", following the kernel's rules.",
+	Args: cobra.ExactArgs(3),
+	RunE: func(_ *cobra.Command, args []string) error {
+		pid, err := strconv.ParseUint(args[0], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid PID %q", args[0])
+		}
+		capability := lxkns.CapabilityByName(args[1])
+		if capability < 0 {
+			return fmt.Errorf("unknown capability %q", args[1])
+		}
+		opts := cli.DiscoveryOptions()
+		opts.WithProcessStatus = true
+		allns, err := cli.Discover(opts)
+		if err != nil {
+			return err
+		}
+		proc, ok := allns.Processes[lxkns.PIDType(pid)]
+		if !ok {
+			return fmt.Errorf("unknown process PID %d", pid)
+		}
+		target, err := namespace(allns, args[2])
+		if err != nil {
+			return err
+		}
+		check, err := lxkns.NsCapable(proc, capability, target)
+		if err != nil {
+			return err
+		}
+		renderCapabilityCheck(os.Stdout, check)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(capableCmd)
+}
+
+// namespace returns the discovered namespace specified either in textual
+// representation, such as "net:[4026531992]", or only by its inode number.
+func namespace(allns *lxkns.DiscoveryResult, nst string) (lxkns.Namespace, error) {
+	if ino, err := strconv.ParseUint(nst, 10, 64); err == nil {
+		nsid := species.NamespaceIDfromInode(ino)
+		for _, nsmap := range allns.Namespaces {
+			if ns, ok := nsmap[nsid]; ok {
+				return ns, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown namespace %q", nst)
+	}
+	nsid, nstype := species.IDwithType(nst)
+	if nstype == species.NaNS {
+		return nil, errors.New("not a valid namespace: " + strconv.Quote(nst))
+	}
+	if ns, ok := allns.Namespaces[lxkns.TypeIndex(nstype)][nsid]; ok {
+		return ns, nil
+	}
+	return nil, fmt.Errorf("unknown namespace %q", nst)
+}
+
+// renderCapabilityCheck explains the decision path of the capability check.
+func renderCapabilityCheck(out io.Writer, check *lxkns.CapabilityCheck) {
+	proc := check.Process
+	verdict := "denied"
+	if check.Allowed {
+		verdict = "allowed"
+	}
+	fmt.Fprintf(out, "%s of process %q (%d) for %s: %s\n",
+		lxkns.CapabilityName(check.Capability),
+		style.ProcessStyle.V(style.ProcessName(proc)), proc.PID,
+		nsTypeID(check.Target), verdict)
+	fmt.Fprintf(out, "  process joined to %s with effective UID %d\n",
+		nsTypeID(proc.Namespaces[lxkns.UserNS]),
+		style.OwnerStyle.V(proc.Status.EUID))
+	for _, userns := range check.Path {
+		fmt.Fprintf(out, "  checking %s created by UID %d\n",
+			nsTypeID(userns),
+			style.OwnerStyle.V(userns.(lxkns.Ownership).UID()))
+	}
+	fmt.Fprintf(out, "  %s: %s\n", verdict, check.Reason)
+}
+
+// nsTypeID returns the styled type and ID of the specified namespace.
+func nsTypeID(ns lxkns.Namespace) style.StyledValue {
+	return style.Styles[ns.Type().Name()].V(ns.(lxkns.NamespaceStringer).TypeIDString())
+}
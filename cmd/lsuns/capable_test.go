@@ -0,0 +1,63 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thediveo/lxkns"
+)
+
+var _ = Describe("capable", func() {
+
+	It("explains capabilities of processes in namespaces", func() {
+		opts := lxkns.FullDiscovery
+		opts.WithProcessStatus = true
+		allns := lxkns.Discover(opts)
+		me := allns.Processes[lxkns.PIDType(os.Getpid())]
+		netns := me.Namespaces[lxkns.NetNS]
+
+		ns, err := namespace(allns, netns.(lxkns.NamespaceStringer).TypeIDString())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ns).To(BeIdenticalTo(netns))
+		ns, err = namespace(allns, fmt.Sprintf("%d", netns.ID().Ino))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ns).To(BeIdenticalTo(netns))
+		_, err = namespace(allns, "foo:[1]")
+		Expect(err).To(HaveOccurred())
+		_, err = namespace(allns, "42")
+		Expect(err).To(HaveOccurred())
+
+		check, err := lxkns.NsCapable(me, lxkns.CapabilityByName("CAP_NET_ADMIN"), netns)
+		Expect(err).NotTo(HaveOccurred())
+		out := bytes.Buffer{}
+		renderCapabilityCheck(&out, check)
+		verdict := "denied"
+		if me.Status.CapEff.Has(12) {
+			verdict = "allowed"
+		}
+		Expect(out.String()).To(MatchRegexp(fmt.Sprintf(
+			`^CAP_NET_ADMIN of process ".*" \(%d\) for net:\[%d\]: %s
+  process joined to user:\[\d+\] with effective UID %d
+  checking user:\[\d+\] created by UID \d+
+  %s: process user namespace, capability (not )?effective
+$`, me.PID, netns.ID().Ino, verdict, os.Geteuid(), verdict)))
+	})
+
+})
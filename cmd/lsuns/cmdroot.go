@@ -21,6 +21,7 @@ import (
 	asciitree "github.com/thediveo/go-asciitree"
 	"github.com/thediveo/lxkns"
 	"github.com/thediveo/lxkns/cmd/internal/pkg/cli"
+	"github.com/thediveo/lxkns/cmd/internal/pkg/filter"
 	"github.com/thediveo/lxkns/cmd/internal/pkg/style"
 )
 
@@ -35,13 +36,14 @@ var rootCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, _ []string) error {
 		details, _ := cmd.PersistentFlags().GetBool("details")
 		// Run a full namespace discovery.
-		allns := lxkns.Discover(lxkns.FullDiscovery)
+		allns, err := cli.Discover(cli.DiscoveryOptions())
+		if err != nil {
+			return err
+		}
 		fmt.Println(
 			asciitree.Render(
-				allns.UserNSRoots,
-				&UserNSVisitor{
-					Details: details,
-				},
+				UserNSTree(allns.UserNSRoots, details),
+				asciitree.NewMapStructVisitor(false, false),
 				style.NamespaceStyler))
 		return nil
 	},
@@ -52,5 +54,6 @@ func init() {
 	rootCmd.PersistentFlags().BoolP(
 		"details", "d", false,
 		"shows details, such as owned namespaces")
+	filter.NamedNetnsSetupCLI(rootCmd)
 	cli.AddFlags(rootCmd)
 }
@@ -17,6 +17,8 @@ Flags
 
 The following lsuns flags are available:
 
+        --bundle string          discovers from a bundle file captured before, instead of from this system
+        --capture string         captures the discovered processes and namespaces into a bundle file
     -c, --color color[=always]   colorize the output; can be 'always' (default if omitted), 'auto',
                                  or 'never' (default auto)
     -d, --details                shows details, such as owned namespaces
@@ -24,12 +26,73 @@ The following lsuns flags are available:
     -f, --filter filter          shows only selected namespace types; can be 'cgroup'/'c', 'ipc'/'i', 'mnt'/'m',
                                 'net'/'n', 'pid'/'p', 'user'/'U', 'uts'/'u' (default [mnt,cgroup,uts,ipc,user,pid,net])
     -h, --help                   help for lsuns
+        --named-netns            shows only named network namespaces, such as created by 'ip netns'
         --proc proc[=name]       process name style; can be 'name' (default if omitted), 'basename',
                                  or 'exe' (default name)
+        --stats                  prints discovery statistics, such as phase durations, to stderr
         --theme theme            colorization theme 'dark' or 'light' (default dark)
         --treestyle treestyle    select the tree render style; can be 'line' (default if omitted)
                                  or 'ascii' (default line)
 
+Capabilities
+
+The "capable" command explains whether a process has a specific capability in
+a namespace, following the rules of the Linux kernel: it shows the user
+namespaces checked, from the user namespace owning the namespace in question
+upwards towards the user namespace of the process.
+
+    lsuns capable PID CAPABILITY NAMESPACE
+
+For example, to check whether the process with PID 42 is allowed to administer
+a particular network namespace:
+
+    lsuns capable 42 CAP_NET_ADMIN net:[4026532281]
+
+Named Network Namespaces
+
+Network namespaces bind-mounted by "ip netns add", Docker, or CNI plugins into
+their well-known places (such as /run/netns) are shown with their names:
+
+    net:[4026532281] «blue» bind-mounted at "/run/netns/blue"
+
+Use the "--named-netns" flag in combination with "--details" to show only
+named network namespaces, but not any unnamed ones.
+
+systemd Units
+
+Where namespace leader processes belong to systemd units, such as services
+sandboxed using PrivateNetwork=, PrivateTmp=, and similar settings, lsuns shows
+the units alongside the leader processes:
+
+    net:[4026532362] process "nginx" (1234) in unit nginx.service
+
+Discovery Statistics
+
+In order to find out which phase of the namespace discovery takes how long on
+a particular host, the "--stats" flag prints the time spent as well as the
+processes, file descriptors, and namespaces found per discovery phase to
+stderr, so it doesn't get in the way of the regular output:
+
+    lsuns --stats >/dev/null
+
+The "--stats" flag is available with all lxkns CLI tools.
+
+Offline Discovery
+
+When namespace problems need to be analyzed on a system other than the one
+they occur on, the "--capture" flag writes the process and namespace state
+discovered into a bundle file, in addition to the usual output:
+
+    lsuns --capture lxkns-bundle.tar
+
+Later, the "--bundle" flag reproduces the discovery from the bundle file,
+instead of discovering from the system lsuns is running on:
+
+    lsuns -d --bundle lxkns-bundle.tar
+
+Same as "--stats", the "--capture" and "--bundle" flags are available with all
+lxkns CLI tools.
+
 Colorization
 
 Unless specified otherwise using the "--color=none" flag, lsuns colorizes its
@@ -1,6 +1,3 @@
-// A visitor implementing the view on user namespaces and their owned
-// namespaces, using the lxkns information model.
-
 // Copyright 2020 Harald Albrecht.
 //
 // Licensed under the Apache License, Version 2.0 (the "License"); you may not
@@ -20,7 +17,6 @@ package main
 import (
 	"fmt"
 	"os/user"
-	"reflect"
 
 	"github.com/thediveo/lxkns"
 	"github.com/thediveo/lxkns/cmd/internal/pkg/filter"
@@ -28,35 +24,62 @@ import (
 	"github.com/thediveo/lxkns/cmd/internal/pkg/style"
 )
 
-// UserNSVisitor is an asciitree.Visitor which starts from a list (slice) of
-// root user namespaces and then recursively dives into the user namespace
-// hierarchy.
-type UserNSVisitor struct {
-	Details bool
+// UserNSNode is a user namespace node of the rendered tree, with the owned
+// non-user namespaces as its properties and the child user namespaces as its
+// children.
+type UserNSNode struct {
+	Label    string        `asciitree:"label"`
+	Owned    []string      `asciitree:"properties"`
+	Children []*UserNSNode `asciitree:"children"`
 }
 
-// Roots returns the given topmost hierarchical user namespaces sorted.
-func (v *UserNSVisitor) Roots(roots reflect.Value) (children []reflect.Value) {
-	userroots := lxkns.SortNamespaces(roots.Interface().([]lxkns.Namespace))
-	count := len(userroots)
-	children = make([]reflect.Value, count)
-	for idx := 0; idx < count; idx++ {
-		children[idx] = reflect.ValueOf(userroots[idx])
+// UserNSTree walks the user namespace hierarchy starting from the specified
+// root user namespaces, returning the tree of user namespace nodes ready for
+// rendering. With details, the owned namespaces become properties of their
+// owning user namespace nodes.
+func UserNSTree(roots []lxkns.Namespace, details bool) []*UserNSNode {
+	tree := []*UserNSNode{}
+	nodes := map[*lxkns.WalkNode]*UserNSNode{}
+	edges := lxkns.WalkChildren
+	if details {
+		edges |= lxkns.WalkOwned
 	}
-	return
+	_ = lxkns.Walk(roots, lxkns.WalkOptions{
+		Edges: edges,
+		Pre: func(node *lxkns.WalkNode) error {
+			// Owned (non-user) namespaces are properties of their owning user
+			// namespace; we're not interested in their PID namespace
+			// children, if any.
+			if node.Edge == lxkns.WalkOwned {
+				if filter.Filter(node.Namespace) {
+					owner := nodes[node.Parent]
+					owner.Owned = append(owner.Owned, namespaceLabel(node.Namespace))
+				}
+				return lxkns.SkipChildren
+			}
+			usernode := &UserNSNode{Label: namespaceLabel(node.Namespace)}
+			nodes[node] = usernode
+			if node.Parent == nil {
+				tree = append(tree, usernode)
+			} else {
+				parent := nodes[node.Parent]
+				parent.Children = append(parent.Children, usernode)
+			}
+			return nil
+		},
+	})
+	return tree
 }
 
-// Label returns the text label for a namespace node. Everything else will have
-// no label.
-func (v *UserNSVisitor) Label(node reflect.Value) (label string) {
-	if ns, ok := node.Interface().(lxkns.Namespace); ok {
-		style := style.Styles[ns.Type().Name()]
-		label = fmt.Sprintf("%s%s %s",
-			output.NamespaceIcon(ns),
-			style.V(ns.(lxkns.NamespaceStringer).TypeIDString()),
-			output.NamespaceReferenceLabel(ns))
-	}
-	if uns, ok := node.Interface().(lxkns.Ownership); ok {
+// namespaceLabel returns the text label for a namespace, additionally with
+// the creator UID in case of user namespaces.
+func namespaceLabel(ns lxkns.Namespace) (label string) {
+	label = fmt.Sprintf("%s%s%s %s",
+		output.NamespaceIcon(ns),
+		style.Styles[ns.Type().Name()].V(ns.(lxkns.NamespaceStringer).TypeIDString()),
+		output.NamespaceNameLabel(ns),
+		output.NamespaceReferenceLabel(ns))
+	if uns, ok := ns.(lxkns.Ownership); ok {
 		username := ""
 		if user, err := user.LookupId(fmt.Sprintf("%d", uns.UID())); err == nil {
 			username = fmt.Sprintf(" (%q)", style.OwnerStyle.V(user.Username))
@@ -67,45 +90,3 @@ func (v *UserNSVisitor) Label(node reflect.Value) (label string) {
 	}
 	return
 }
-
-// Get returns the user namespace text label for the current node (which is
-// always an user namespace), as well as the list of properties (owned
-// non-user namespaces) and the list of child user namespace nodes.
-func (v *UserNSVisitor) Get(node reflect.Value) (
-	label string, properties []string, children reflect.Value) {
-	// Label for this user namespace...
-	label = v.Label(node)
-	// Children of this user namespace...
-	if hns, ok := node.Interface().(lxkns.Hierarchy); ok {
-		children = reflect.ValueOf(lxkns.SortChildNamespaces(hns.Children()))
-	}
-	// Owned (non-user) namespaces...
-	if v.Details {
-		if uns, ok := node.Interface().(lxkns.Ownership); ok {
-			ownedns := uns.Ownings()
-			for _, nstype := range lxkns.TypeIndexLexicalOrder {
-				if nstype == lxkns.UserNS {
-					// The lxkns information model does not add child user
-					// namespaces to the model, but instead models the
-					// parent-child relationship. So, there should be no owned
-					// user namespaces present anyway. But we skip just as a
-					// safeguard in case the model would change anytime later.
-					continue
-				}
-				nslist := lxkns.SortedNamespaces(ownedns[nstype])
-				for _, ns := range nslist {
-					if !filter.Filter(ns) {
-						continue
-					}
-					style := style.Styles[ns.Type().Name()]
-					s := fmt.Sprintf("%s%s %s",
-						output.NamespaceIcon(ns),
-						style.V(ns.(lxkns.NamespaceStringer).TypeIDString()),
-						output.NamespaceReferenceLabel(ns))
-					properties = append(properties, s)
-				}
-			}
-		}
-	}
-	return
-}
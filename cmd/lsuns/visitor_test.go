@@ -0,0 +1,56 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thediveo/lxkns"
+	"github.com/thediveo/lxkns/species"
+)
+
+var _ = Describe("user namespace tree", func() {
+
+	It("walks user namespaces with their owned namespaces", func() {
+		id := func(ino uint64) species.NamespaceID {
+			return species.NamespaceID{Dev: 1, Ino: ino}
+		}
+		u0 := lxkns.NewNamespace(species.CLONE_NEWUSER, id(10), "")
+		u1 := lxkns.NewNamespace(species.CLONE_NEWUSER, id(11), "")
+		u0.(lxkns.HierarchyConfigurer).AddChild(u1.(lxkns.Hierarchy))
+		usernsmap := lxkns.NamespaceMap{u0.ID(): u0, u1.ID(): u1}
+		for _, ns := range []lxkns.Namespace{
+			lxkns.NewNamespace(species.CLONE_NEWNET, id(20), ""),
+			lxkns.NewNamespace(species.CLONE_NEWIPC, id(21), ""),
+		} {
+			ns.(lxkns.NamespaceConfigurer).SetOwner(u1.ID())
+			ns.(lxkns.NamespaceConfigurer).ResolveOwner(usernsmap)
+		}
+
+		tree := UserNSTree([]lxkns.Namespace{u0}, true)
+		Expect(tree).To(HaveLen(1))
+		Expect(tree[0].Label).To(HavePrefix("user:[10] "))
+		Expect(tree[0].Owned).To(BeEmpty())
+		Expect(tree[0].Children).To(HaveLen(1))
+		Expect(tree[0].Children[0].Label).To(HavePrefix("user:[11] "))
+		Expect(tree[0].Children[0].Owned).To(HaveLen(2))
+		Expect(tree[0].Children[0].Owned[0]).To(HavePrefix("ipc:[21]"))
+		Expect(tree[0].Children[0].Owned[1]).To(HavePrefix("net:[20]"))
+
+		tree = UserNSTree([]lxkns.Namespace{u0}, false)
+		Expect(tree[0].Children[0].Owned).To(BeEmpty())
+	})
+
+})
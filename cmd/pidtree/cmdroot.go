@@ -42,38 +42,64 @@ var rootCmd = &cobra.Command{
 	leading to process PID 42.
   pidtree -n pid:[4026531836] -p 1
 	shows only the PID namespace hierarchy and processes on the branch
-	leading to process PID 1 in PID namespace 4026531836.`,
+	leading to process PID 1 in PID namespace 4026531836.
+  pidtree --from-ns pid:[4026532442]
+	shows the PID namespace 4026532442 and its child PID namespaces with
+	the processes inside them, using the PIDs as seen from inside PID
+	namespace 4026532442.`,
 	PersistentPreRunE: func(_ *cobra.Command, _ []string) error {
 		return cli.BeforeCommand()
 	},
 	RunE: func(cmd *cobra.Command, _ []string) error {
 		pid, _ := cmd.PersistentFlags().GetUint32("pid")
+		fromnst, _ := cmd.PersistentFlags().GetString("from-ns")
+		fromnsid, err := pidNamespaceID(fromnst)
+		if err != nil {
+			return err
+		}
 		// If no PID was specified ("zero" PID), then render the usual full
-		// PID namespace and process tree.
+		// PID namespace and process tree, or the tree as seen from inside a
+		// specific PID namespace.
 		if pid == 0 {
+			if fromnsid != species.NoneID {
+				return renderPIDView(os.Stdout, fromnsid)
+			}
 			return renderPIDTreeWithNamespaces(os.Stdout)
 		}
+		if fromnsid != species.NoneID {
+			return fmt.Errorf("--from-ns cannot be combined with --pid")
+		}
 		// If there is a PID, then check next if there is also a PID namespace
 		// specified, in which the PID is valid. Then render only the branch
 		// leading from the initial PID namespace down to the PID namespace of
 		// PID, and the processes on this branch.
-		pidnsid := species.NoneID
-		if nst, _ := cmd.PersistentFlags().GetString("ns"); nst != "" {
-			id, err := strconv.ParseUint(nst, 10, 64)
-			if err == nil {
-				pidnsid, _ = species.IDwithType(strconv.FormatUint(id, 10))
-			} else {
-				var t species.NamespaceType
-				pidnsid, t = species.IDwithType(nst)
-				if t == species.NaNS {
-					return fmt.Errorf("not a valid PID namespace ID: %q", nst)
-				}
-			}
+		nst, _ := cmd.PersistentFlags().GetString("ns")
+		pidnsid, err := pidNamespaceID(nst)
+		if err != nil {
+			return err
 		}
 		return renderPIDBranch(os.Stdout, lxkns.PIDType(pid), pidnsid)
 	},
 }
 
+// pidNamespaceID returns the PID namespace ID specified either as an unsigned
+// int64 value or in textual representation "pid:[...]". If nothing has been
+// specified, then the NoneID is returned.
+func pidNamespaceID(nst string) (species.NamespaceID, error) {
+	if nst == "" {
+		return species.NoneID, nil
+	}
+	if id, err := strconv.ParseUint(nst, 10, 64); err == nil {
+		pidnsid, _ := species.IDwithType(strconv.FormatUint(id, 10))
+		return pidnsid, nil
+	}
+	pidnsid, t := species.IDwithType(nst)
+	if t == species.NaNS {
+		return species.NoneID, fmt.Errorf("not a valid PID namespace ID: %q", nst)
+	}
+	return pidnsid, nil
+}
+
 // Sets up the flags.
 func init() {
 	rootCmd.PersistentFlags().Uint32P("pid", "p", 0,
@@ -82,23 +108,22 @@ func init() {
 		"PID namespace of PID, if not the initial PID namespace;\n"+
 			"either an unsigned int64 value, such as \"4026531836\", or a\n"+
 			"PID namespace textual representation like \"pid:[4026531836]\"")
+	rootCmd.PersistentFlags().String("from-ns", "",
+		"PID namespace to show the PID tree from, using the PIDs as seen\n"+
+			"from inside it; same format as for --ns")
 	cli.AddFlags(rootCmd)
 }
 
-// SingleBranch encodes a single branch from the initial/root PID namespace
-// down to a particular process, with all intermediate PID namespaces and
-// processes along the route.
-type SingleBranch struct {
-	Branch []interface{}
-}
-
 // Renders only the PID namespaces hierarchy and PID branch leading up to a
 // specific PID, optionally in a specific PID namespace.
 func renderPIDBranch(out io.Writer, pid lxkns.PIDType, pidnsid species.NamespaceID) error {
 	// Run a full namespace discovery and also get the PID translation map.
-	allns := lxkns.Discover(lxkns.FullDiscovery)
+	allns, err := cli.Discover(cli.DiscoveryOptions())
+	if err != nil {
+		return err
+	}
 	pidmap := lxkns.NewPIDMap(allns)
-	rootpidns := allns.Processes[lxkns.PIDType(os.Getpid())].Namespaces[lxkns.PIDNS]
+	rootpidns := allns.Processes[cli.SelfPID()].Namespaces[lxkns.PIDNS]
 	// If necessary, translate the PID from its own PID namespace into the
 	// initial/this program's PID namespace.
 	if pidnsid != species.NoneID {
@@ -119,37 +144,11 @@ func renderPIDBranch(out io.Writer, pid lxkns.PIDType, pidnsid species.Namespace
 	if !ok {
 		return fmt.Errorf("unknown process PID %d", pid)
 	}
-	branch := SingleBranch{Branch: []interface{}{}}
-	for proc != nil {
-		// Prepend the current process to the branch.
-		branch.Branch = append([]interface{}{proc}, branch.Branch...)
-		// Now if there is a change in PID namespaces just at the current
-		// process, prepend our "current" PID namespace also. The difficult
-		// part here is that we need to deal with the situation where we have
-		// the process tree, but lack the PID namespace information for
-		// processes in the tree and up the branch for which we don't have
-		// enough privileges: we then cannot give PID namespace information
-		// for them :(
-		pproc := proc.Parent
-		if (pproc == nil ||
-			pproc.Namespaces[lxkns.PIDNS] != proc.Namespaces[lxkns.PIDNS]) &&
-			proc.Namespaces[lxkns.PIDNS] != nil {
-			branch.Branch = append(
-				[]interface{}{proc.Namespaces[lxkns.PIDNS]},
-				branch.Branch...)
-		}
-		// Climb up towards the root/stem.
-		proc = pproc
-	}
 	// Now render the whole branch...
 	fmt.Fprintln(out,
 		asciitree.Render(
-			branch,
-			&BranchVisitor{
-				Details:   true,
-				PIDMap:    pidmap,
-				RootPIDNS: rootpidns,
-			},
+			PIDBranch(proc, rootpidns, pidmap),
+			asciitree.NewMapStructVisitor(false, false),
 			style.NamespaceStyler))
 	return nil
 }
@@ -157,7 +156,10 @@ func renderPIDBranch(out io.Writer, pid lxkns.PIDType, pidnsid species.Namespace
 // Renders a full PID tree including PID namespaces.
 func renderPIDTreeWithNamespaces(out io.Writer) error {
 	// Run a full namespace discovery and also get the PID translation map.
-	allns := lxkns.Discover(lxkns.FullDiscovery)
+	allns, err := cli.Discover(cli.DiscoveryOptions())
+	if err != nil {
+		return err
+	}
 	pidmap := lxkns.NewPIDMap(allns)
 	// You may wonder why lxkns returns a slice of "root" PID and user
 	// namespaces, instead of only a single root for each. The rationale is
@@ -171,24 +173,38 @@ func renderPIDTreeWithNamespaces(out io.Writer) error {
 	// any other roots that might have turned up during discovery. And this
 	// slightly ranty comment now gets me another badge-achievement which is
 	// so important in today's societies: "ranty source commenter".
-	ourproc, ok := allns.Processes[lxkns.PIDType(os.Getpid())]
+	ourproc, ok := allns.Processes[cli.SelfPID()]
 	if !ok {
 		fmt.Fprintln(os.Stderr, "error: /proc does not match the current PID namespace")
 		os.Exit(1)
 	}
 	rootpidns := ourproc.Namespaces[lxkns.PIDNS]
-	// Finally render the output based on the information gathered. The
-	// important part here is the PIDVisitor, which encapsulated the knowledge
-	// of traversing the information in the correct way in order to achieve
-	// the desired process tree with PID namespaces.
+	// Finally render the output based on the information gathered, that is,
+	// the process tree with the PID namespaces in between wherever the PID
+	// namespace changes.
+	fmt.Fprintln(out,
+		asciitree.Render(
+			PIDTree(rootpidns, pidmap),
+			asciitree.NewMapStructVisitor(false, false),
+			style.NamespaceStyler))
+	return nil
+}
+
+// Renders the PID tree as seen from inside the specified PID namespace, with
+// the PIDs local to this PID namespace.
+func renderPIDView(out io.Writer, fromnsid species.NamespaceID) error {
+	allns, err := cli.Discover(cli.DiscoveryOptions())
+	if err != nil {
+		return err
+	}
+	pidns := allns.Namespaces[lxkns.PIDNS][fromnsid]
+	if pidns == nil {
+		return fmt.Errorf("unknown PID namespace pid:[%d]", fromnsid.Ino)
+	}
 	fmt.Fprintln(out,
 		asciitree.Render(
-			[]lxkns.Namespace{rootpidns}, // note to self: expects a slice of roots
-			&TreeVisitor{
-				Details:   true,
-				PIDMap:    pidmap,
-				RootPIDNS: rootpidns,
-			},
+			PIDViewTree(lxkns.NewPIDMap(allns).View(pidns)),
+			asciitree.NewMapStructVisitor(false, false),
 			style.NamespaceStyler))
 	return nil
 }
@@ -24,9 +24,13 @@ Flags
 
 The following pidtree flags are available:
 
+        --bundle string              discovers from a bundle file captured before, instead of from this system
+        --capture string             captures the discovered processes and namespaces into a bundle file
     -c, --color colormode[=always]   colorize the output; can be 'always' (default if omitted), 'auto',
                                      or 'never' (default auto)
         --dump                       dump colorization theme to stdout (for saving to ~/.lxknsrc.yaml)
+        --from-ns string             PID namespace to show the PID tree from, using the PIDs as seen
+                                     from inside it; same format as for --ns
     -h, --help                       help for pidtree
     -n, --ns string                  PID namespace of PID, if not the initial PID namespace;
                                      either an unsigned int64 value, such as "4026531836", or a
@@ -34,6 +38,7 @@ The following pidtree flags are available:
     -p, --pid uint32                 PID of process to show PID namespace tree and parent PIDs for
         --proc namemode[=name]       process name style; can be 'name' (default if omitted), 'basename',
                                      or 'exe' (default name)
+        --stats                      prints discovery statistics, such as phase durations, to stderr
         --theme theme                colorization theme 'dark' or 'light' (default dark)
         --treestyle treestyle        select the tree render style; can be 'line' (default if omitted)
 
@@ -52,6 +57,9 @@ reach out into parent (or sibling) PID namespaces, thus pidtree cannot show
 proper PID namespacing information for such processes above the starting point's
 PID namespace (please also see below).
 
+Processes leading PID namespaces additionally show the systemd units they
+belong to, if any, such as "in unit nginx.service".
+
 Whenever a child process lives in a different PID namespace than its parent
 process, pstree shows an intermediate PID namespace node between parent and
 child process(es). These PID namespace nodes show the namespace ID (inode
@@ -88,6 +96,14 @@ controlling childs or diagnosing logs with PIDs.
     │  │                    └─ "sleep" (5529/25)
     [...]
 
+Using "--from-ns", pidtree instead starts at the specified PID namespace and
+shows the PIDs as seen from inside this PID namespace, similar to what "ps"
+inside a container would show:
+
+    pid:[4026532247], owned by UID 1000 ("thediveo")
+    └─ "bash" (1)
+       └─ "sleep" (25)
+
 Insufficient Privileges/Capabilities:
 
 When pidtree is started without the necessary privileges (in particular, the
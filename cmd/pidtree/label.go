@@ -43,13 +43,19 @@ func ProcessLabel(proc *lxkns.Process, pidmap *lxkns.PIDMap, rootpidns lxkns.Nam
 		for _, el := range pidmap.NamespacedPIDs(proc.PID, rootpidns) {
 			pids = append(pids, strconv.FormatUint(uint64(el.PID), 10))
 		}
+		// Only show the systemd unit for leader processes of PID namespaces,
+		// in order to not clutter the tree.
+		var unit string
+		if proc.Parent == nil || proc.Parent.Namespaces[lxkns.PIDNS] != procpidns {
+			unit = output.ProcessUnitLabel(proc)
+		}
 		if len(pids) > 1 {
-			return fmt.Sprintf("%q (%s)",
+			return fmt.Sprintf("%q (%s)%s",
 				style.ProcessStyle.V(proc.Name),
-				strings.Join(pids, "/"))
+				strings.Join(pids, "/"), unit)
 		}
-		return fmt.Sprintf("%q (%d)",
-			style.ProcessStyle.V(style.ProcessName(proc)), proc.PID)
+		return fmt.Sprintf("%q (%d)%s",
+			style.ProcessStyle.V(style.ProcessName(proc)), proc.PID, unit)
 	}
 	// PID namespace information is NOT known, so this is a process out of
 	// our reach. We thus print it in a way to signal that we don't know
@@ -61,6 +67,25 @@ func ProcessLabel(proc *lxkns.Process, pidmap *lxkns.PIDMap, rootpidns lxkns.Nam
 		style.UnknownStyle.V("???"))
 }
 
+// ViewProcessLabel returns the text label for a process as seen from inside
+// a particular PID namespace, showing its PIDs from this PID namespace down
+// to the PID namespace the process is joined to.
+func ViewProcessLabel(vproc *lxkns.ViewProcess) string {
+	pids := make([]string, len(vproc.PIDs))
+	for idx, el := range vproc.PIDs {
+		pids[idx] = strconv.FormatUint(uint64(el.PID), 10)
+	}
+	// Only show the systemd unit for leader processes of PID namespaces, in
+	// order to not clutter the tree.
+	var unit string
+	if vproc.Parent == nil || vproc.Parent.Namespace != vproc.Namespace {
+		unit = output.ProcessUnitLabel(vproc.Process)
+	}
+	return fmt.Sprintf("%q (%s)%s",
+		style.ProcessStyle.V(style.ProcessName(vproc.Process)),
+		strings.Join(pids, "/"), unit)
+}
+
 // PIDNamespaceLabel returns the text label for a PID namespace, giving not
 // only the details about type (always PID) and ID, but additionally the
 // owner's UID and user name.
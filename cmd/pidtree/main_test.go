@@ -17,12 +17,16 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/exec"
+	"strings"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/thediveo/lxkns"
 	"github.com/thediveo/lxkns/nstest"
+	"github.com/thediveo/lxkns/ops"
 	"github.com/thediveo/lxkns/species"
 	"github.com/thediveo/testbasher"
 )
@@ -89,3 +93,40 @@ $`,
 	})
 
 })
+
+var _ = Describe("renders PID trees from other PID namespaces", func() {
+
+	It("renders from the perspective of a PID namespace", func() {
+		sleepy := exec.Command("unshare", "--pid", "--kill-child",
+			"sh", "-c", "sleep 60 & exec sleep 61")
+		Expect(sleepy.Start()).To(Succeed())
+		defer func() {
+			_ = sleepy.Process.Kill()
+			_ = sleepy.Wait()
+		}()
+		var initpid int
+		Eventually(func() int {
+			children, _ := ioutil.ReadFile(fmt.Sprintf(
+				"/proc/%d/task/%d/children", sleepy.Process.Pid, sleepy.Process.Pid))
+			fields := strings.Fields(string(children))
+			if len(fields) == 0 {
+				return 0
+			}
+			fmt.Sscan(fields[0], &initpid)
+			children, _ = ioutil.ReadFile(fmt.Sprintf(
+				"/proc/%d/task/%d/children", initpid, initpid))
+			return len(strings.Fields(string(children)))
+		}).Should(Equal(1))
+		pidnsid, err := ops.NamespacePath(fmt.Sprintf("/proc/%d/ns/pid", initpid)).ID()
+		Expect(err).NotTo(HaveOccurred())
+
+		out := bytes.Buffer{}
+		Expect(renderPIDView(&out, species.NamespaceIDfromInode(123))).To(HaveOccurred())
+		Expect(renderPIDView(&out, pidnsid)).To(Succeed())
+		Expect(out.String()).To(MatchRegexp(fmt.Sprintf(`^pid:\[%d\], owned by UID %d \(".*"\)
+└─ "sleep" \(1\)
+   └─ "sleep" \(2\)
+`, pidnsid.Ino, os.Geteuid())))
+	})
+
+})
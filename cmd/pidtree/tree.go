@@ -0,0 +1,139 @@
+// Builds the process tree with PID namespaces, as well as single branches of
+// it.
+
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"github.com/thediveo/lxkns"
+)
+
+// PIDNode is a PID namespace or process node of a rendered PID tree.
+type PIDNode struct {
+	Label    string          `asciitree:"label"`
+	Children []*PIDNode      `asciitree:"children"`
+	pidns    lxkns.Namespace // PID namespace of this node, if known.
+}
+
+// pidnsChild returns the child node for the specified PID namespace, adding a
+// new child node if necessary. As child processes in the same PID namespace
+// as their parent process always share the parent's PID namespace, any child
+// node with a different PID namespace can only be a PID namespace node.
+func (n *PIDNode) pidnsChild(pidns lxkns.Namespace) *PIDNode {
+	for _, child := range n.Children {
+		if child.pidns == pidns {
+			return child
+		}
+	}
+	child := &PIDNode{Label: PIDNamespaceLabel(pidns), pidns: pidns}
+	n.Children = append(n.Children, child)
+	return child
+}
+
+// PIDTree returns the process tree starting from the specified root PID
+// namespace, ready for rendering. Differing from `ps fax`, we also show the
+// PID namespaces in between the process hierarchy where the PID namespace
+// changes from one to another.
+func PIDTree(rootpidns lxkns.Namespace, pidmap *lxkns.PIDMap) []*PIDNode {
+	b := newPIDTreeBuilder(rootpidns, pidmap)
+	_ = lxkns.Walk([]lxkns.Namespace{rootpidns}, lxkns.WalkOptions{
+		Edges: lxkns.WalkLeaders | lxkns.WalkProcessChildren,
+		Pre: func(node *lxkns.WalkNode) error {
+			b.add(node)
+			return nil
+		},
+	})
+	return b.tree
+}
+
+// PIDBranch returns only the single branch of the process tree leading from
+// the topmost ancestor of the specified process down to this process, with
+// the PID namespaces along the route, ready for rendering.
+func PIDBranch(proc *lxkns.Process, rootpidns lxkns.Namespace, pidmap *lxkns.PIDMap) []*PIDNode {
+	onbranch := map[*lxkns.Process]bool{}
+	topmost := proc
+	for ; proc != nil; proc = proc.Parent {
+		onbranch[proc] = true
+		topmost = proc
+	}
+	b := newPIDTreeBuilder(rootpidns, pidmap)
+	_ = lxkns.WalkProcesses([]*lxkns.Process{topmost}, lxkns.WalkOptions{
+		Edges: lxkns.WalkProcessChildren,
+		Pre: func(node *lxkns.WalkNode) error {
+			if !onbranch[node.Process] {
+				return lxkns.SkipChildren
+			}
+			b.add(node)
+			return nil
+		},
+	})
+	return b.tree
+}
+
+// pidTreeBuilder builds PID trees from the namespace and process nodes
+// visited while walking.
+type pidTreeBuilder struct {
+	rootpidns lxkns.Namespace
+	pidmap    *lxkns.PIDMap
+	tree      []*PIDNode
+	nodes     map[*lxkns.WalkNode]*PIDNode
+}
+
+func newPIDTreeBuilder(rootpidns lxkns.Namespace, pidmap *lxkns.PIDMap) *pidTreeBuilder {
+	return &pidTreeBuilder{
+		rootpidns: rootpidns,
+		pidmap:    pidmap,
+		tree:      []*PIDNode{},
+		nodes:     map[*lxkns.WalkNode]*PIDNode{},
+	}
+}
+
+// add adds a node for the visited PID namespace or process to the tree. Where
+// the PID namespace changes from a process to its child process, a PID
+// namespace node gets inserted. We might lack the privileges (capabilities)
+// to discover the PID namespace of a process; we then only can add the
+// process itself, with a label signalling that we don't know about its PID
+// namespace.
+func (b *pidTreeBuilder) add(node *lxkns.WalkNode) {
+	if node.Namespace != nil {
+		nsnode := &PIDNode{
+			Label: PIDNamespaceLabel(node.Namespace),
+			pidns: node.Namespace,
+		}
+		b.nodes[node] = nsnode
+		b.tree = append(b.tree, nsnode)
+		return
+	}
+	proc := node.Process
+	pidns := proc.Namespaces[lxkns.PIDNS]
+	procnode := &PIDNode{
+		Label: ProcessLabel(proc, b.pidmap, b.rootpidns),
+		pidns: pidns,
+	}
+	b.nodes[node] = procnode
+	parent := b.nodes[node.Parent]
+	switch {
+	case parent == nil && pidns == nil:
+		b.tree = append(b.tree, procnode)
+		return
+	case parent == nil:
+		parent = &PIDNode{Label: PIDNamespaceLabel(pidns), pidns: pidns}
+		b.tree = append(b.tree, parent)
+	case pidns != nil && pidns != parent.pidns:
+		parent = parent.pidnsChild(pidns)
+	}
+	parent.Children = append(parent.Children, procnode)
+}
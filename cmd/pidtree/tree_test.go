@@ -0,0 +1,83 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thediveo/lxkns"
+	"github.com/thediveo/lxkns/species"
+)
+
+var _ = Describe("PID tree", func() {
+
+	var pidns, childpidns lxkns.Namespace
+	var init, nested2 *lxkns.Process
+	var pidmap *lxkns.PIDMap
+
+	BeforeEach(func() {
+		pidns = lxkns.NewNamespace(species.CLONE_NEWPID, species.NamespaceID{Dev: 1, Ino: 10}, "")
+		childpidns = lxkns.NewNamespace(species.CLONE_NEWPID, species.NamespaceID{Dev: 1, Ino: 11}, "")
+		pidns.(lxkns.HierarchyConfigurer).AddChild(childpidns.(lxkns.Hierarchy))
+		proc := func(pid lxkns.PIDType, name string, parent *lxkns.Process, pidns lxkns.Namespace) *lxkns.Process {
+			p := &lxkns.Process{PID: pid, Name: name, Parent: parent}
+			p.Namespaces[lxkns.PIDNS] = pidns
+			if parent != nil {
+				parent.Children = append(parent.Children, p)
+			}
+			if pidns != nil && (parent == nil || parent.Namespaces[lxkns.PIDNS] != pidns) {
+				pidns.(lxkns.NamespaceConfigurer).AddLeader(p)
+			}
+			return p
+		}
+		init = proc(1, "init", nil, pidns)
+		nested2 = proc(3, "nested2", init, childpidns)
+		proc(2, "nested1", init, childpidns)
+		proc(4, "unknown", init, nil)
+		pidmap = lxkns.NewPIDMap(&lxkns.DiscoveryResult{})
+	})
+
+	It("groups child PID namespaces", func() {
+		tree := PIDTree(pidns, pidmap)
+		Expect(tree).To(HaveLen(1))
+		Expect(tree[0].Label).To(HavePrefix("pid:[10]"))
+		Expect(tree[0].Children).To(HaveLen(1))
+		initnode := tree[0].Children[0]
+		Expect(initnode.Label).To(HavePrefix(`"init" (1)`))
+		Expect(initnode.Children).To(HaveLen(2))
+		nsnode := initnode.Children[0]
+		Expect(nsnode.Label).To(HavePrefix("pid:[11]"))
+		Expect(nsnode.Children).To(HaveLen(2))
+		Expect(nsnode.Children[0].Label).To(HavePrefix(`"nested1" (2)`))
+		Expect(nsnode.Children[1].Label).To(HavePrefix(`"nested2" (3)`))
+		Expect(initnode.Children[1].Label).To(ContainSubstring(`"unknown" (4/`))
+	})
+
+	It("renders only a single branch", func() {
+		branch := PIDBranch(nested2, pidns, pidmap)
+		Expect(branch).To(HaveLen(1))
+		Expect(branch[0].Label).To(HavePrefix("pid:[10]"))
+		Expect(branch[0].Children).To(HaveLen(1))
+		initnode := branch[0].Children[0]
+		Expect(initnode.Label).To(HavePrefix(`"init" (1)`))
+		Expect(initnode.Children).To(HaveLen(1))
+		nsnode := initnode.Children[0]
+		Expect(nsnode.Label).To(HavePrefix("pid:[11]"))
+		Expect(nsnode.Children).To(HaveLen(1))
+		Expect(nsnode.Children[0].Label).To(HavePrefix(`"nested2" (3)`))
+		Expect(nsnode.Children[0].Children).To(BeEmpty())
+	})
+
+})
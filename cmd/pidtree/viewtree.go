@@ -0,0 +1,48 @@
+// Builds the PID tree as seen from inside a particular PID namespace.
+
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"github.com/thediveo/lxkns"
+)
+
+// PIDViewTree returns the tree of PID namespaces and processes as seen from
+// inside the PID namespace of the specified view, ready for rendering. The
+// tree starts with the viewing PID namespace and then branches into child PID
+// namespaces where the PID namespace changes from a process to its children.
+func PIDViewTree(view *lxkns.PIDView) []*PIDNode {
+	root := &PIDNode{Label: PIDNamespaceLabel(view.PIDNS), pidns: view.PIDNS}
+	addViewProcesses(root, view.Roots)
+	return []*PIDNode{root}
+}
+
+// addViewProcesses adds nodes for the specified processes to the parent node,
+// which is either the node of their parent process or the node of the viewing
+// PID namespace. Processes in other PID namespaces than the parent's get
+// grouped below nodes of their PID namespaces.
+func addViewProcesses(parent *PIDNode, vprocs []*lxkns.ViewProcess) {
+	for _, vproc := range vprocs {
+		node := &PIDNode{Label: ViewProcessLabel(vproc), pidns: vproc.Namespace}
+		addViewProcesses(node, vproc.Children)
+		if vproc.Namespace == parent.pidns {
+			parent.Children = append(parent.Children, node)
+			continue
+		}
+		nsnode := parent.pidnsChild(vproc.Namespace)
+		nsnode.Children = append(nsnode.Children, node)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thediveo/lxkns"
+	"github.com/thediveo/lxkns/species"
+)
+
+var _ = Describe("PID view tree", func() {
+
+	It("branches into child PID namespaces", func() {
+		pidns := lxkns.NewNamespace(species.CLONE_NEWPID, species.NamespaceID{Dev: 1, Ino: 10}, "")
+		childpidns := lxkns.NewNamespace(species.CLONE_NEWPID, species.NamespaceID{Dev: 1, Ino: 11}, "")
+		init := &lxkns.ViewProcess{
+			Process:   &lxkns.Process{PID: 1001, Name: "init"},
+			PID:       1,
+			Namespace: pidns,
+			PIDs:      lxkns.NamespacedPIDs{{PIDNS: pidns, PID: 1}},
+		}
+		nested := &lxkns.ViewProcess{
+			Process:   &lxkns.Process{PID: 1002, Name: "nested"},
+			PID:       2,
+			PPID:      1,
+			Parent:    init,
+			Namespace: childpidns,
+			PIDs:      lxkns.NamespacedPIDs{{PIDNS: pidns, PID: 2}, {PIDNS: childpidns, PID: 1}},
+		}
+		init.Children = []*lxkns.ViewProcess{nested}
+		view := &lxkns.PIDView{
+			PIDNS:     pidns,
+			Processes: []*lxkns.ViewProcess{init, nested},
+			Roots:     []*lxkns.ViewProcess{init},
+		}
+
+		tree := PIDViewTree(view)
+		Expect(tree).To(HaveLen(1))
+		Expect(tree[0].Label).To(HavePrefix("pid:[10]"))
+		Expect(tree[0].Children).To(HaveLen(1))
+		Expect(tree[0].Children[0].Label).To(Equal(`"init" (1)`))
+		Expect(tree[0].Children[0].Children).To(HaveLen(1))
+		nsnode := tree[0].Children[0].Children[0]
+		Expect(nsnode.Label).To(HavePrefix("pid:[11]"))
+		Expect(nsnode.Children).To(HaveLen(1))
+		Expect(nsnode.Children[0].Label).To(Equal(`"nested" (2/1)`))
+	})
+
+})
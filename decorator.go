@@ -0,0 +1,39 @@
+// Decorators add information to the discovery results which doesn't come
+// from the Linux kernel itself, such as container identities.
+
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package lxkns
+
+// Decorator decorates the namespaces (and processes) of a discovery result
+// with additional information from sources other than the Linux kernel, such
+// as the state directories of container runtimes. Decorators attach their
+// information in form of labels, see also Namespace.Labels() and
+// Process.Labels.
+type Decorator interface {
+	// Decorate adds labels to the namespaces and processes in the specified
+	// discovery result. Decorate is called only after all namespaces have been
+	// discovered, including their hierarchy and ownership (subject to the
+	// discovery options).
+	Decorate(result *DiscoveryResult)
+}
+
+// decorate runs the decorators specified in the discovery options on the
+// discovery results, in the order of their appearance.
+func decorate(result *DiscoveryResult) {
+	for _, decorator := range result.Options.Decorators {
+		decorator.Decorate(result)
+	}
+}
@@ -0,0 +1,41 @@
+/*
+
+Package oci decorates the namespaces discovered by lxkns with the identities
+of OCI containers, based on the state directories low-level container runtimes
+(such as runc and crun) and containerd shims maintain for their containers.
+
+Container Runtime State
+
+Low-level container runtimes keep the state of the containers they create in
+state directories, one per container:
+
+    * runc: /run/runc/[ID]/state.json, as well as the runc state roots used by
+      Docker (/run/docker/runtime-runc/[NS]/[ID]/state.json) and containerd
+      (/run/containerd/runc/[NS]/[ID]/state.json).
+    * crun: /run/crun/[ID]/status.
+    * containerd shims: /run/containerd/io.containerd.runtime.v2.task/[NS]/[ID]/init.pid,
+      where the state directory also is the bundle directory.
+
+The state information includes the PID of a container's initial process, so the
+oci decorator can correlate containers with the processes in a discovery
+result. As the container runtimes also record the start time of a container's
+initial process, the decorator avoids mismatches due to recycled PIDs where
+this information is available.
+
+Decorating
+
+To decorate a discovery with container identities, add an oci Decorator to the
+discovery options:
+
+    opts := lxkns.FullDiscovery
+    opts.Decorators = []lxkns.Decorator{oci.NewDecorator()}
+    result := lxkns.Discover(opts)
+
+A namespace gets labelled with the container ID, bundle path, and runtime name
+only if the initial process of a container is the ealdorman of this namespace.
+This ensures that namespaces shared with other containers (such as in case of
+Kubernetes pods) or with the host are only labelled with the container actually
+"owning" them.
+
+*/
+package oci
@@ -0,0 +1,272 @@
+// Reads the state directories of OCI container runtimes and shims in order to
+// learn about the containers and their initial processes.
+
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// +build linux
+
+package oci
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/thediveo/lxkns"
+)
+
+// Names of the labels the oci decorator attaches to namespaces.
+const (
+	ContainerIDLabel = "oci/container-id" // ID of the container "owning" a namespace.
+	BundleLabel      = "oci/bundle"       // path of the container's bundle.
+	RuntimeLabel     = "oci/runtime"      // runtime name: "runc", "crun", or "containerd".
+)
+
+// Default state directory roots for the supported container runtimes.
+var (
+	DefaultRuncRoots = []string{
+		"/run/runc",
+		"/run/docker/runtime-runc",
+		"/run/containerd/runc",
+	}
+	DefaultCrunRoots = []string{
+		"/run/crun",
+	}
+	DefaultContainerdRoots = []string{
+		"/run/containerd/io.containerd.runtime.v2.task",
+		"/run/containerd/io.containerd.runtime.v1.linux",
+	}
+)
+
+// Container describes an OCI container as found in the state directory of a
+// container runtime.
+type Container struct {
+	ID        string        // container identifier.
+	Bundle    string        // path to the container's bundle directory.
+	Runtime   string        // name of the runtime: "runc", "crun", or "containerd".
+	PID       lxkns.PIDType // PID of the container's initial process.
+	Starttime uint64        // start time of the initial process, or zero if unknown.
+}
+
+// Decorator labels namespaces with the identities of OCI containers, based on
+// the state directories of container runtimes. A nil list of state roots
+// selects the corresponding default roots, while an empty (non-nil) list
+// skips scanning for containers of the corresponding runtime.
+type Decorator struct {
+	RuncRoots       []string // state roots of runc(-compatible) runtimes.
+	CrunRoots       []string // state roots of crun.
+	ContainerdRoots []string // state roots of containerd shims.
+}
+
+var _ lxkns.Decorator = (*Decorator)(nil)
+
+// NewDecorator returns a new OCI container decorator using the default state
+// directory roots.
+func NewDecorator() *Decorator {
+	return &Decorator{}
+}
+
+// Decorate labels those namespaces in the discovery result whose ealdorman
+// processes are initial container processes.
+func (d *Decorator) Decorate(result *lxkns.DiscoveryResult) {
+	for _, container := range d.Containers() {
+		proc, ok := result.Processes[container.PID]
+		if !ok || (container.Starttime != 0 && container.Starttime != proc.Starttime) {
+			// Either we don't know about the container's initial process, or
+			// the PID has been recycled in the meantime and now belongs to a
+			// completely different process.
+			continue
+		}
+		for _, ns := range proc.Namespaces {
+			if ns == nil || ns.Ealdorman() != proc {
+				continue
+			}
+			configurer := ns.(lxkns.NamespaceConfigurer)
+			configurer.SetLabel(ContainerIDLabel, container.ID)
+			configurer.SetLabel(BundleLabel, container.Bundle)
+			configurer.SetLabel(RuntimeLabel, container.Runtime)
+		}
+	}
+}
+
+// Containers returns the containers found in the state directories of the
+// container runtimes. Containers whose state cannot be read are silently
+// skipped, as they're most probably being created or destroyed just now.
+func (d *Decorator) Containers() (containers []Container) {
+	for _, root := range roots(d.RuncRoots, DefaultRuncRoots) {
+		for _, dir := range stateDirs(root, "state.json") {
+			if c, ok := runcContainer(dir); ok {
+				containers = append(containers, c)
+			}
+		}
+	}
+	for _, root := range roots(d.CrunRoots, DefaultCrunRoots) {
+		for _, dir := range stateDirs(root, "status") {
+			if c, ok := crunContainer(dir); ok {
+				containers = append(containers, c)
+			}
+		}
+	}
+	for _, root := range roots(d.ContainerdRoots, DefaultContainerdRoots) {
+		for _, dir := range stateDirs(root, "init.pid") {
+			if c, ok := containerdContainer(dir); ok {
+				containers = append(containers, c)
+			}
+		}
+	}
+	return
+}
+
+// roots returns the configured state roots, or the default roots if none
+// have been configured.
+func roots(configured []string, defaults []string) []string {
+	if configured == nil {
+		return defaults
+	}
+	return configured
+}
+
+// stateDirs returns the container state directories below the specified
+// root which contain a state file of the given name. As Docker and
+// containerd separate their containers into (non-Linux) namespaces, such as
+// "moby" and "k8s.io", state directories are looked for either directly below
+// the root, or one level further down.
+func stateDirs(root string, statefile string) (dirs []string) {
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(root, entry.Name())
+		if isFile(filepath.Join(dir, statefile)) {
+			dirs = append(dirs, dir)
+			continue
+		}
+		subentries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, subentry := range subentries {
+			subdir := filepath.Join(dir, subentry.Name())
+			if subentry.IsDir() && isFile(filepath.Join(subdir, statefile)) {
+				dirs = append(dirs, subdir)
+			}
+		}
+	}
+	return
+}
+
+// isFile returns true if path exists and is a regular file.
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// runcState is the subset of runc's state.json we're interested in.
+type runcState struct {
+	ID             string `json:"id"`
+	InitProcessPID int    `json:"init_process_pid"`
+	InitStart      uint64 `json:"init_process_start"`
+	Config         struct {
+		Labels []string `json:"labels"`
+	} `json:"config"`
+}
+
+// runcContainer reads the container state from a runc state directory.
+func runcContainer(dir string) (c Container, ok bool) {
+	var state runcState
+	if !readJSON(filepath.Join(dir, "state.json"), &state) || state.InitProcessPID <= 0 {
+		return
+	}
+	c = Container{
+		ID:        state.ID,
+		Runtime:   "runc",
+		PID:       lxkns.PIDType(state.InitProcessPID),
+		Starttime: state.InitStart,
+	}
+	if c.ID == "" {
+		c.ID = filepath.Base(dir)
+	}
+	// runc doesn't store the bundle path as a separate state field, but
+	// instead as a "bundle=..." label of the container configuration.
+	for _, label := range state.Config.Labels {
+		if strings.HasPrefix(label, "bundle=") {
+			c.Bundle = label[len("bundle="):]
+			break
+		}
+	}
+	return c, true
+}
+
+// crunState is the subset of crun's status file we're interested in.
+type crunState struct {
+	PID       int    `json:"pid"`
+	Starttime uint64 `json:"process-start-time"`
+	Bundle    string `json:"bundle"`
+}
+
+// crunContainer reads the container state from a crun state directory. crun
+// doesn't store the container ID in its status, but the state directory is
+// named after the container.
+func crunContainer(dir string) (c Container, ok bool) {
+	var state crunState
+	if !readJSON(filepath.Join(dir, "status"), &state) || state.PID <= 0 {
+		return
+	}
+	return Container{
+		ID:        filepath.Base(dir),
+		Bundle:    state.Bundle,
+		Runtime:   "crun",
+		PID:       lxkns.PIDType(state.PID),
+		Starttime: state.Starttime,
+	}, true
+}
+
+// containerdContainer reads the container state from a containerd shim state
+// directory. The shim state directory is named after the container and
+// simultaneously is the container's bundle directory. Unfortunately, the shim
+// only tells us the PID of the initial process, but not its start time.
+func containerdContainer(dir string) (c Container, ok bool) {
+	pidtext, err := ioutil.ReadFile(filepath.Join(dir, "init.pid"))
+	if err != nil {
+		return
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(pidtext)))
+	if err != nil || pid <= 0 {
+		return
+	}
+	return Container{
+		ID:      filepath.Base(dir),
+		Bundle:  dir,
+		Runtime: "containerd",
+		PID:     lxkns.PIDType(pid),
+	}, true
+}
+
+// readJSON reads and decodes the JSON file at path into v, returning true if
+// successful.
+func readJSON(path string, v interface{}) bool {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(data, v) == nil
+}
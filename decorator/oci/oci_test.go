@@ -0,0 +1,97 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package oci
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thediveo/lxkns"
+	"github.com/thediveo/lxkns/species"
+)
+
+var testDecorator = Decorator{
+	RuncRoots:       []string{"../../test/oci/runc"},
+	CrunRoots:       []string{"../../test/oci/crun"},
+	ContainerdRoots: []string{"../../test/oci/containerd", "../../test/oci/nirvana"},
+}
+
+var _ = Describe("OCI decorator", func() {
+
+	It("uses default roots unless told otherwise", func() {
+		Expect(roots(nil, DefaultRuncRoots)).To(Equal(DefaultRuncRoots))
+		Expect(roots([]string{}, DefaultRuncRoots)).To(BeEmpty())
+	})
+
+	It("reads container runtime state directories", func() {
+		Expect(testDecorator.Containers()).To(ConsistOf(
+			Container{
+				ID:        "abc123",
+				Bundle:    "/run/containerd/io.containerd.runtime.v1.linux/moby/abc123",
+				Runtime:   "runc",
+				PID:       42,
+				Starttime: 4242,
+			},
+			Container{ID: "def456", Runtime: "runc", PID: 666, Starttime: 1},
+			Container{
+				ID:        "ghi789",
+				Bundle:    "/var/lib/containers/ghi789/userdata",
+				Runtime:   "crun",
+				PID:       1234,
+				Starttime: 5678,
+			},
+			Container{
+				ID:      "jkl012",
+				Bundle:  "../../test/oci/containerd/k8s.io/jkl012",
+				Runtime: "containerd",
+				PID:     4711,
+			},
+		))
+	})
+
+	It("labels only namespaces of container ealdormen", func() {
+		host := &lxkns.Process{PID: 1, Starttime: 1}
+		container := &lxkns.Process{PID: 42, PPID: 1, Parent: host, Starttime: 4242}
+		stale := &lxkns.Process{PID: 666, PPID: 1, Parent: host, Starttime: 666}
+		hostnetns := lxkns.NewNamespace(species.CLONE_NEWNET, species.NamespaceID{Dev: 1, Ino: 1}, "")
+		netns := lxkns.NewNamespace(species.CLONE_NEWNET, species.NamespaceID{Dev: 1, Ino: 2}, "")
+		stalenetns := lxkns.NewNamespace(species.CLONE_NEWNET, species.NamespaceID{Dev: 1, Ino: 3}, "")
+		hostnetns.(lxkns.NamespaceConfigurer).AddLeader(host)
+		netns.(lxkns.NamespaceConfigurer).AddLeader(container)
+		stalenetns.(lxkns.NamespaceConfigurer).AddLeader(stale)
+		host.Namespaces[lxkns.NetNS] = hostnetns
+		container.Namespaces[lxkns.NetNS] = netns
+		stale.Namespaces[lxkns.NetNS] = stalenetns
+		// The container shares the host's IPC namespace.
+		ipcns := lxkns.NewNamespace(species.CLONE_NEWIPC, species.NamespaceID{Dev: 1, Ino: 4}, "")
+		ipcns.(lxkns.NamespaceConfigurer).AddLeader(host)
+		host.Namespaces[lxkns.IPCNS] = ipcns
+		container.Namespaces[lxkns.IPCNS] = ipcns
+
+		result := &lxkns.DiscoveryResult{
+			Processes: lxkns.ProcessTable{1: host, 42: container, 666: stale},
+		}
+		testDecorator.Decorate(result)
+
+		Expect(netns.Labels()).To(Equal(map[string]string{
+			ContainerIDLabel: "abc123",
+			BundleLabel:      "/run/containerd/io.containerd.runtime.v1.linux/moby/abc123",
+			RuntimeLabel:     "runc",
+		}))
+		Expect(hostnetns.Labels()).To(BeNil())
+		Expect(ipcns.Labels()).To(BeNil())
+		Expect(stalenetns.Labels()).To(BeNil())
+	})
+
+})
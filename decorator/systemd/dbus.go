@@ -0,0 +1,430 @@
+// Asks systemd for the units of processes, using a minimal D-Bus client
+// talking to systemd's private socket.
+
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// +build linux
+
+package systemd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thediveo/lxkns"
+)
+
+// PrivateSocket is the path of systemd's private D-Bus socket, which allows
+// talking directly to systemd without a D-Bus daemon in between. Only root
+// can connect to this socket.
+const PrivateSocket = "/run/systemd/private"
+
+// DBusTimeout is the time systemd gets to answer a single method call.
+var DBusTimeout = 5 * time.Second
+
+// The systemd manager object and the prefix of the object paths of units.
+const (
+	systemdService   = "org.freedesktop.systemd1"
+	systemdPath      = "/org/freedesktop/systemd1"
+	systemdManager   = "org.freedesktop.systemd1.Manager"
+	systemdUnitsPath = "/org/freedesktop/systemd1/unit/"
+)
+
+// D-Bus message types.
+const (
+	methodCallMsg   = 1
+	methodReturnMsg = 2
+	errorMsg        = 3
+	signalMsg       = 4
+)
+
+// D-Bus message header field codes.
+const (
+	pathField        = 1
+	interfaceField   = 2
+	memberField      = 3
+	errorNameField   = 4
+	replySerialField = 5
+	destinationField = 6
+	signatureField   = 8
+)
+
+// Conn is a D-Bus connection to systemd, connected directly to systemd's
+// private socket.
+type Conn struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	serial uint32
+}
+
+// Dial connects to systemd via the private D-Bus socket at the specified
+// path, such as PrivateSocket, and authenticates using the credentials of
+// this process.
+func Dial(socket string) (*Conn, error) {
+	conn, err := net.DialTimeout("unix", socket, DBusTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &Conn{conn: conn, r: bufio.NewReader(conn)}
+	if err := c.auth(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close closes the connection to systemd.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// auth authenticates to systemd using the EXTERNAL mechanism, which passes
+// our UID, as systemd's private socket doesn't support any other mechanism.
+func (c *Conn) auth() error {
+	_ = c.conn.SetDeadline(time.Now().Add(DBusTimeout))
+	defer func() { _ = c.conn.SetDeadline(time.Time{}) }()
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Geteuid())))
+	if _, err := io.WriteString(c.conn, "\x00AUTH EXTERNAL "+uid+"\r\n"); err != nil {
+		return err
+	}
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "OK ") {
+		return fmt.Errorf("systemd D-Bus authentication rejected: %q",
+			strings.TrimSpace(line))
+	}
+	_, err = io.WriteString(c.conn, "BEGIN\r\n")
+	return err
+}
+
+// UnitByPID asks systemd for the name of the unit the process with the
+// specified PID belongs to, such as "nginx.service". The PID must be from the
+// PID namespace systemd is running in.
+func (c *Conn) UnitByPID(pid lxkns.PIDType) (string, error) {
+	body := &encoder{}
+	body.uint32(uint32(pid))
+	reply, err := c.call(&message{
+		typ: methodCallMsg,
+		fields: []field{
+			{pathField, 'o', systemdPath},
+			{interfaceField, 's', systemdManager},
+			{memberField, 's', "GetUnitByPID"},
+			{destinationField, 's', systemdService},
+			{signatureField, 'g', "u"},
+		},
+		body: body.buf,
+	})
+	if err != nil {
+		return "", err
+	}
+	path, err := reply.bodyString("o")
+	if err != nil {
+		return "", err
+	}
+	return unitFromPath(path)
+}
+
+// call sends a method call to systemd and then waits for its reply, skipping
+// any signals systemd broadcasts to all its private connections in the
+// meantime. D-Bus errors are returned as Go errors.
+func (c *Conn) call(msg *message) (*message, error) {
+	_ = c.conn.SetDeadline(time.Now().Add(DBusTimeout))
+	defer func() { _ = c.conn.SetDeadline(time.Time{}) }()
+	c.serial++
+	msg.serial = c.serial
+	if _, err := c.conn.Write(msg.marshal()); err != nil {
+		return nil, err
+	}
+	for {
+		reply, err := readMessage(c.r)
+		if err != nil {
+			return nil, err
+		}
+		if reply.typ != methodReturnMsg && reply.typ != errorMsg {
+			continue
+		}
+		if serial, ok := reply.field(replySerialField).(uint32); !ok || serial != msg.serial {
+			continue
+		}
+		if reply.typ == errorMsg {
+			name, _ := reply.field(errorNameField).(string)
+			text, _ := reply.bodyString("s")
+			return nil, &DBusError{Name: name, Message: text}
+		}
+		return reply, nil
+	}
+}
+
+// DBusError is an error reply from systemd to a method call, such as when
+// there is no unit for a particular PID. In contrast to other errors, the
+// connection to systemd is still usable after a DBusError.
+type DBusError struct {
+	Name    string // D-Bus error name, such as "org.freedesktop.systemd1.NoUnitForPID".
+	Message string // error message from systemd.
+}
+
+// Error returns the D-Bus error name and message.
+func (e *DBusError) Error() string {
+	return fmt.Sprintf("systemd D-Bus error %s: %s", e.Name, e.Message)
+}
+
+// unitFromPath returns the name of the unit with the specified D-Bus object
+// path. systemd escapes all characters in unit names other than ASCII
+// letters and digits in form of "_xx", with xx being the hex value of the
+// escaped character, such as "nginx_2eservice" for "nginx.service".
+func unitFromPath(path string) (string, error) {
+	if !strings.HasPrefix(path, systemdUnitsPath) {
+		return "", fmt.Errorf("not a systemd unit object path %q", path)
+	}
+	escaped := path[len(systemdUnitsPath):]
+	var unit strings.Builder
+	for idx := 0; idx < len(escaped); idx++ {
+		if escaped[idx] != '_' {
+			unit.WriteByte(escaped[idx])
+			continue
+		}
+		if idx+2 >= len(escaped) {
+			return "", fmt.Errorf("invalid systemd unit object path %q", path)
+		}
+		ch, err := strconv.ParseUint(escaped[idx+1:idx+3], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("invalid systemd unit object path %q", path)
+		}
+		unit.WriteByte(byte(ch))
+		idx += 2
+	}
+	return unit.String(), nil
+}
+
+// message is a D-Bus message, with its body kept in marshalled form. Header
+// fields are limited to string-like and uint32 values, which suffices for
+// the header fields defined by the D-Bus specification.
+type message struct {
+	typ    byte
+	serial uint32
+	fields []field
+	body   []byte
+	order  binary.ByteOrder
+}
+
+// field is a header field of a D-Bus message, with its code, the signature
+// of its value, and the value itself.
+type field struct {
+	code  byte
+	sig   byte
+	value interface{} // either string or uint32
+}
+
+// field returns the value of the header field with the specified code, or
+// nil if the message doesn't have such a header field.
+func (m *message) field(code byte) interface{} {
+	for _, f := range m.fields {
+		if f.code == code {
+			return f.value
+		}
+	}
+	return nil
+}
+
+// bodyString returns the string-like body of the message, checking that the
+// body has the expected signature.
+func (m *message) bodyString(sig string) (string, error) {
+	if bodysig, _ := m.field(signatureField).(string); bodysig != sig {
+		return "", fmt.Errorf("unexpected D-Bus reply signature %q", bodysig)
+	}
+	d := &decoder{buf: m.body, order: m.order}
+	return d.string()
+}
+
+// marshal returns the message in D-Bus wire format, using little endian
+// byte order.
+func (m *message) marshal() []byte {
+	e := &encoder{}
+	e.buf = append(e.buf, 'l', m.typ, 0, 1)
+	e.uint32(uint32(len(m.body)))
+	e.uint32(m.serial)
+	e.uint32(0) // header fields array length, to be filled in below.
+	for _, f := range m.fields {
+		e.align(8)
+		e.buf = append(e.buf, f.code)
+		e.signature(string(f.sig))
+		switch v := f.value.(type) {
+		case string:
+			if f.sig == 'g' {
+				e.signature(v)
+			} else {
+				e.string(v)
+			}
+		case uint32:
+			e.uint32(v)
+		}
+	}
+	binary.LittleEndian.PutUint32(e.buf[12:], uint32(len(e.buf)-16))
+	e.align(8)
+	return append(e.buf, m.body...)
+}
+
+// readMessage reads the next D-Bus message from the specified reader.
+func readMessage(r io.Reader) (*message, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, err
+	}
+	m := &message{typ: fixed[1]}
+	switch fixed[0] {
+	case 'l':
+		m.order = binary.LittleEndian
+	case 'B':
+		m.order = binary.BigEndian
+	default:
+		return nil, errors.New("invalid D-Bus message endianness")
+	}
+	bodylen := m.order.Uint32(fixed[4:])
+	m.serial = m.order.Uint32(fixed[8:])
+	fieldslen := m.order.Uint32(fixed[12:])
+	if bodylen > 1<<27 || fieldslen > 1<<26 {
+		return nil, errors.New("D-Bus message too long")
+	}
+	headerlen := (16 + int(fieldslen) + 7) &^ 7
+	rest := make([]byte, headerlen-16+int(bodylen))
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, err
+	}
+	// Alignment of the header fields is relative to the start of the
+	// message, so we need to decode the fields with the fixed part in front.
+	d := &decoder{buf: append(fixed, rest[:fieldslen]...), pos: 16, order: m.order}
+	for d.pos < len(d.buf) {
+		d.align(8)
+		code, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		sig, err := d.signature()
+		if err != nil {
+			return nil, err
+		}
+		var value interface{}
+		switch sig {
+		case "s", "o":
+			value, err = d.string()
+		case "g":
+			value, err = d.signature()
+		case "u":
+			value, err = d.uint32()
+		default:
+			err = fmt.Errorf("unsupported D-Bus header field signature %q", sig)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m.fields = append(m.fields, field{code: code, sig: sig[0], value: value})
+	}
+	m.body = rest[headerlen-16:]
+	return m, nil
+}
+
+// encoder marshals basic D-Bus types in little endian byte order.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) align(n int) {
+	for len(e.buf)%n != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.align(4)
+	e.buf = append(e.buf, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(e.buf[len(e.buf)-4:], v)
+}
+
+func (e *encoder) string(s string) {
+	e.uint32(uint32(len(s)))
+	e.buf = append(append(e.buf, s...), 0)
+}
+
+func (e *encoder) signature(s string) {
+	e.buf = append(append(append(e.buf, byte(len(s))), s...), 0)
+}
+
+// decoder unmarshals basic D-Bus types.
+type decoder struct {
+	buf   []byte
+	pos   int
+	order binary.ByteOrder
+}
+
+var errShortMessage = errors.New("truncated D-Bus message")
+
+func (d *decoder) align(n int) {
+	d.pos = (d.pos + n - 1) / n * n
+}
+
+func (d *decoder) byte() (byte, error) {
+	if d.pos >= len(d.buf) {
+		return 0, errShortMessage
+	}
+	d.pos++
+	return d.buf[d.pos-1], nil
+}
+
+func (d *decoder) uint32() (uint32, error) {
+	d.align(4)
+	if d.pos+4 > len(d.buf) {
+		return 0, errShortMessage
+	}
+	d.pos += 4
+	return d.order.Uint32(d.buf[d.pos-4:]), nil
+}
+
+func (d *decoder) string() (string, error) {
+	l, err := d.uint32()
+	if err != nil {
+		return "", err
+	}
+	return d.bytes(int(l))
+}
+
+func (d *decoder) signature() (string, error) {
+	l, err := d.byte()
+	if err != nil {
+		return "", err
+	}
+	return d.bytes(int(l))
+}
+
+// bytes returns the specified number of bytes as a string, skipping the
+// terminating zero byte.
+func (d *decoder) bytes(l int) (string, error) {
+	if l < 0 || d.pos+l+1 > len(d.buf) {
+		return "", errShortMessage
+	}
+	s := string(d.buf[d.pos : d.pos+l])
+	d.pos += l + 1
+	return s, nil
+}
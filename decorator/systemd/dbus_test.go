@@ -0,0 +1,246 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package systemd
+
+import (
+	"bufio"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thediveo/lxkns"
+)
+
+// fakeSystemd serves GetUnitByPID method calls on the specified listener,
+// answering from the specified map of PIDs to unit object paths. Before each
+// reply it broadcasts a signal, as systemd does on its private socket.
+func fakeSystemd(l net.Listener, units map[uint32]string) {
+	defer GinkgoRecover()
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	auth, err := r.ReadString('\n')
+	Expect(err).NotTo(HaveOccurred())
+	Expect(auth).To(HavePrefix("\x00AUTH EXTERNAL "))
+	_, _ = conn.Write([]byte("OK 0123456789abcdef0123456789abcdef\r\n"))
+	begin, err := r.ReadString('\n')
+	Expect(err).NotTo(HaveOccurred())
+	Expect(begin).To(Equal("BEGIN\r\n"))
+	for {
+		call, err := readMessage(r)
+		if err != nil {
+			return
+		}
+		Expect(call.typ).To(Equal(byte(methodCallMsg)))
+		Expect(call.field(memberField)).To(Equal("GetUnitByPID"))
+		Expect(call.field(signatureField)).To(Equal("u"))
+		d := &decoder{buf: call.body, order: call.order}
+		pid, err := d.uint32()
+		Expect(err).NotTo(HaveOccurred())
+
+		signal := &message{
+			typ:    signalMsg,
+			serial: 1000 + call.serial,
+			fields: []field{
+				{pathField, 'o', systemdPath},
+				{interfaceField, 's', systemdManager},
+				{memberField, 's', "UnitNew"},
+			},
+		}
+		_, _ = conn.Write(signal.marshal())
+
+		body := &encoder{}
+		reply := &message{
+			serial: 2000 + call.serial,
+			fields: []field{{replySerialField, 'u', call.serial}},
+		}
+		if path, ok := units[pid]; ok {
+			body.string(path)
+			reply.typ = methodReturnMsg
+			reply.fields = append(reply.fields, field{signatureField, 'g', "o"})
+		} else {
+			body.string("PID has no unit")
+			reply.typ = errorMsg
+			reply.fields = append(reply.fields,
+				field{errorNameField, 's', "org.freedesktop.systemd1.NoUnitForPID"},
+				field{signatureField, 'g', "s"})
+		}
+		reply.body = body.buf
+		_, _ = conn.Write(reply.marshal())
+	}
+}
+
+// hungSystemd accepts a connection on the specified listener and
+// authenticates it, but then never answers any method call.
+func hungSystemd(l net.Listener) {
+	defer GinkgoRecover()
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	_, _ = r.ReadString('\n')
+	_, _ = conn.Write([]byte("OK 0123456789abcdef0123456789abcdef\r\n"))
+	_, _ = r.ReadString('\n')
+	_, _ = ioutil.ReadAll(r)
+}
+
+var _ = Describe("systemd D-Bus", func() {
+
+	var tmpdir, socket string
+	var listener net.Listener
+
+	BeforeEach(func() {
+		var err error
+		tmpdir, err = ioutil.TempDir("", "lxkns-systemd-")
+		Expect(err).NotTo(HaveOccurred())
+		socket = filepath.Join(tmpdir, "private")
+		listener, err = net.Listen("unix", socket)
+		Expect(err).NotTo(HaveOccurred())
+		go fakeSystemd(listener, map[uint32]string{
+			1:  "/org/freedesktop/systemd1/unit/init_2escope",
+			42: "/org/freedesktop/systemd1/unit/foo_2dbar_5cx2dbaz_2eservice",
+			69: "/org/freedesktop/systemd1/nada",
+		})
+	})
+
+	AfterEach(func() {
+		listener.Close()
+		os.RemoveAll(tmpdir)
+	})
+
+	It("decodes unit object paths", func() {
+		Expect(unitFromPath("/org/freedesktop/systemd1/unit/cron_2eservice")).To(Equal("cron.service"))
+		Expect(unitFromPath("/org/freedesktop/systemd1/unit/getty_40tty1_2eservice")).To(Equal("getty@tty1.service"))
+		for _, path := range []string{
+			"/org/freedesktop/systemd1/unit/cron_2",
+			"/org/freedesktop/systemd1/unit/cron_zz",
+			"/org/freedesktop/systemd1",
+		} {
+			_, err := unitFromPath(path)
+			Expect(err).To(HaveOccurred(), path)
+		}
+	})
+
+	It("round-trips messages", func() {
+		msg := &message{
+			typ:    methodCallMsg,
+			serial: 42,
+			fields: []field{
+				{pathField, 'o', systemdPath},
+				{signatureField, 'g', "u"},
+				{replySerialField, 'u', uint32(666)},
+			},
+			body: []byte{1, 0, 0, 0},
+		}
+		m, err := readMessage(strings.NewReader(string(msg.marshal())))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(m.typ).To(Equal(msg.typ))
+		Expect(m.serial).To(Equal(msg.serial))
+		Expect(m.fields).To(Equal(msg.fields))
+		Expect(m.body).To(Equal(msg.body))
+
+		_, err = readMessage(strings.NewReader(string(msg.marshal()[:20])))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("asks systemd for units", func() {
+		conn, err := Dial(socket)
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+		Expect(conn.UnitByPID(1)).To(Equal("init.scope"))
+		Expect(conn.UnitByPID(42)).To(Equal(`foo-bar\x2dbaz.service`))
+		_, err = conn.UnitByPID(69)
+		Expect(err).To(MatchError(ContainSubstring("not a systemd unit object path")))
+		_, err = conn.UnitByPID(12345)
+		Expect(err).To(MatchError(ContainSubstring("NoUnitForPID")))
+	})
+
+	It("labels processes using systemd", func() {
+		result := &lxkns.DiscoveryResult{
+			Processes: lxkns.ProcessTable{
+				1:   &lxkns.Process{PID: 1},
+				42:  &lxkns.Process{PID: 42},
+				100: &lxkns.Process{PID: 100},
+			},
+		}
+		d := &Decorator{ProcRoot: "../../test/systemd/proc", Socket: socket}
+		d.Decorate(result)
+		Expect(result.Processes[1].Labels).To(Equal(map[string]string{
+			UnitLabel: "init.scope",
+		}))
+		Expect(result.Processes[42].Labels).To(Equal(map[string]string{
+			UnitLabel: `foo-bar\x2dbaz.service`,
+		}))
+		Expect(result.Processes[100].Labels).To(Equal(map[string]string{
+			UnitLabel:     "user@1000.service",
+			UserUnitLabel: "foo.service",
+		}))
+	})
+
+	It("gives up on a hung systemd", func() {
+		hungsocket := filepath.Join(tmpdir, "hung")
+		hung, err := net.Listen("unix", hungsocket)
+		Expect(err).NotTo(HaveOccurred())
+		defer hung.Close()
+		go hungSystemd(hung)
+		defer func(timeout time.Duration) { DBusTimeout = timeout }(DBusTimeout)
+		DBusTimeout = 200 * time.Millisecond
+
+		result := &lxkns.DiscoveryResult{Processes: lxkns.ProcessTable{}}
+		for pid := lxkns.PIDType(1000); pid < 1010; pid++ {
+			result.Processes[pid] = &lxkns.Process{PID: pid}
+		}
+		d := &Decorator{ProcRoot: "../../test/systemd/proc", Socket: hungsocket}
+		start := time.Now()
+		d.Decorate(result)
+		Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+	})
+
+	It("reads control groups from the discovery's proc filesystem", func() {
+		result := &lxkns.DiscoveryResult{
+			Options:   lxkns.DiscoverOpts{ProcRoot: "../../test/systemd/proc"},
+			Processes: lxkns.ProcessTable{42: &lxkns.Process{PID: 42}},
+		}
+		d := &Decorator{UnitByPID: func(lxkns.PIDType) (string, error) {
+			return "", errors.New("nada")
+		}}
+		d.Decorate(result)
+		Expect(result.Processes[42].Labels).To(HaveKeyWithValue(UnitLabel, "cron.service"))
+	})
+
+	It("falls back to control groups", func() {
+		result := &lxkns.DiscoveryResult{
+			Processes: lxkns.ProcessTable{42: &lxkns.Process{PID: 42}},
+		}
+		d := &Decorator{
+			ProcRoot: "../../test/systemd/proc",
+			Socket:   filepath.Join(tmpdir, "nada"),
+		}
+		d.Decorate(result)
+		Expect(result.Processes[42].Labels).To(HaveKeyWithValue(UnitLabel, "cron.service"))
+	})
+
+})
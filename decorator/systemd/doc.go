@@ -0,0 +1,49 @@
+/*
+
+Package systemd decorates the processes discovered by lxkns with the systemd
+units they belong to. This answers questions such as "which service owns this
+mount namespace?" for services sandboxed by systemd using PrivateNetwork=,
+PrivateTmp=, ProtectSystem=, et cetera, as the namespaces of such services have
+the service's processes as their leaders.
+
+Units from Control Groups
+
+systemd places the processes of each unit into a separate control group, so the
+unit of a process can be derived from its control group path in
+/proc/[PID]/cgroup. The systemd decorator understands both the unified cgroup
+v2 hierarchy as well as systemd's own "name=systemd" cgroup v1 hierarchy. In
+the control group path, the slices are skipped and the first element after the
+slices names the unit of the process, such as "nginx.service" in
+"/system.slice/nginx.service". For processes of user sessions managed by a user
+instance of systemd, such as "/user.slice/user-1000.slice/user@1000.service/
+app.slice/foo.service", the decorator additionally labels the user unit
+"foo.service", while the (system) unit then is "user@1000.service".
+
+Units from systemd
+
+Deriving units from control group paths is guesswork when it comes to scopes
+and slices with escaped names. Thus, the decorator prefers to ask systemd
+directly via the GetUnitByPID D-Bus method, using a minimal D-Bus client
+talking to systemd's private socket /run/systemd/private. This socket is only
+accessible to root, so for unprivileged discoveries the decorator silently
+falls back to the control group paths. The same applies to processes systemd
+doesn't know a unit for. If systemd doesn't answer in time, the decorator
+stops asking systemd for the remaining processes. Processes discovered from
+another proc filesystem than "/proc" aren't from this system, so systemd isn't
+asked about them. Applications having a D-Bus connection to systemd already at
+hand can set the UnitByPID resolver of a Decorator instead.
+
+Decorating
+
+To decorate a discovery with systemd units, add a systemd Decorator to the
+discovery options:
+
+    opts := lxkns.FullDiscovery
+    opts.Decorators = []lxkns.Decorator{systemd.NewDecorator()}
+    result := lxkns.Discover(opts)
+    for _, leader := range result.Namespaces[lxkns.MountNS][mntnsid].Leaders() {
+        println(leader.Labels[systemd.UnitLabel])
+    }
+
+*/
+package systemd
@@ -0,0 +1,201 @@
+// Derives the systemd units of processes from their control group paths, or
+// asks systemd.
+
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// +build linux
+
+package systemd
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/thediveo/lxkns"
+)
+
+// Names of the labels the systemd decorator attaches to processes.
+const (
+	UnitLabel     = "systemd/unit"      // (system) unit a process belongs to.
+	UserUnitLabel = "systemd/user-unit" // unit of a user's systemd instance.
+)
+
+// unitSuffixes lists the suffixes of the unit types which can show up in
+// control group paths; slices are deliberately missing, as they only group
+// other units.
+var unitSuffixes = []string{
+	".service", ".scope", ".socket", ".mount", ".swap",
+	".automount", ".device", ".path", ".target", ".timer",
+}
+
+// Decorator labels processes with the systemd units they belong to.
+type Decorator struct {
+	// ProcRoot is the root of the proc filesystem to read control group
+	// memberships from; it defaults to the proc filesystem the processes
+	// have been discovered from.
+	ProcRoot string
+	// Socket is the path of systemd's private D-Bus socket for asking systemd
+	// about the units of processes. It defaults to PrivateSocket, unless the
+	// processes are from another proc filesystem than "/proc", as they then
+	// are not from this system. If systemd cannot be reached, such as when
+	// not running as root, then the units get derived from the control group
+	// paths of the processes instead. After the first failing call other than
+	// systemd reporting back an error, such as when systemd doesn't answer in
+	// time, systemd isn't asked anymore during the same decoration.
+	Socket string
+	// UnitByPID optionally overrides asking systemd via its private D-Bus
+	// socket for the unit of a process. If failing, the unit gets derived
+	// from the control group path of the process instead.
+	UnitByPID func(pid lxkns.PIDType) (string, error)
+}
+
+var _ lxkns.Decorator = (*Decorator)(nil)
+
+// NewDecorator returns a new systemd decorator deriving units from the
+// control groups in the proc filesystem the processes have been discovered
+// from.
+func NewDecorator() *Decorator {
+	return &Decorator{}
+}
+
+// Decorate labels the processes in the discovery result with their systemd
+// (user) units. Processes not belonging to any unit, such as kernel threads
+// or processes of containers not managed via systemd, are left unlabelled.
+func (d *Decorator) Decorate(result *lxkns.DiscoveryResult) {
+	procroot := d.ProcRoot
+	if procroot == "" {
+		procroot = result.Options.ProcRoot
+	}
+	if procroot == "" {
+		procroot = "/proc"
+	}
+	unitByPID := d.UnitByPID
+	var conn *Conn
+	if unitByPID == nil {
+		socket := d.Socket
+		if socket == "" && filepath.Clean(procroot) == "/proc" {
+			socket = PrivateSocket
+		}
+		if socket != "" {
+			var err error
+			if conn, err = Dial(socket); err == nil {
+				defer conn.Close()
+				unitByPID = conn.UnitByPID
+			}
+		}
+	}
+	for pid, proc := range result.Processes {
+		unit, userunit := Units(cgroupPath(procroot, pid))
+		if unitByPID != nil {
+			// systemd knows better than we do when trying to make sense of
+			// control group paths, especially when it comes to escaped unit
+			// names. The user unit can only be derived from the control
+			// group path, as the system instance of systemd doesn't know
+			// about the units of user instances.
+			u, err := unitByPID(pid)
+			var dbuserr *DBusError
+			switch {
+			case err == nil && u != "":
+				unit = u
+				if !isUserManager(unit) {
+					userunit = ""
+				}
+			case err != nil && conn != nil && !errors.As(err, &dbuserr):
+				// systemd didn't answer in time or the connection broke, so
+				// don't wait for systemd again for each remaining process.
+				unitByPID = nil
+			}
+		}
+		if unit != "" {
+			proc.SetLabel(UnitLabel, unit)
+		}
+		if userunit != "" {
+			proc.SetLabel(UserUnitLabel, userunit)
+		}
+	}
+}
+
+// cgroupPath returns the control group path of the specified process in the
+// systemd-managed hierarchy: this is either systemd's own "name=systemd"
+// hierarchy in case of cgroup v1, or otherwise the unified cgroup v2
+// hierarchy. If the process is gone or there is no systemd-managed hierarchy,
+// then an empty path is returned.
+func cgroupPath(procroot string, pid lxkns.PIDType) (path string) {
+	f, err := os.Open(filepath.Join(procroot, strconv.Itoa(int(pid)), "cgroup"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Each line has the form "hierarchy-ID:controller-list:cgroup-path";
+		// please note that the path may contain colons itself.
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		switch {
+		case fields[1] == "name=systemd":
+			return fields[2]
+		case fields[0] == "0" && fields[1] == "":
+			// Remember the unified hierarchy path, but keep looking for a
+			// systemd v1 hierarchy in hybrid setups.
+			path = fields[2]
+		}
+	}
+	return
+}
+
+// Units returns the systemd unit and user unit (if any) for the specified
+// control group path. For instance, "/system.slice/cron.service" is mapped to
+// the unit "cron.service", while
+// "/user.slice/user-1000.slice/user@1000.service/app.slice/foo.service" is
+// mapped to the unit "user@1000.service" and the user unit "foo.service".
+func Units(cgrouppath string) (unit string, userunit string) {
+	elements := strings.Split(strings.Trim(cgrouppath, "/"), "/")
+	unit, elements = firstUnit(elements)
+	if isUserManager(unit) {
+		userunit, _ = firstUnit(elements)
+	}
+	return
+}
+
+// isUserManager returns true if the specified unit is a user instance of
+// systemd, such as "user@1000.service".
+func isUserManager(unit string) bool {
+	return strings.HasPrefix(unit, "user@") && strings.HasSuffix(unit, ".service")
+}
+
+// firstUnit skips any leading slices in the control group path elements and
+// returns the unit found next, together with the remaining path elements. If
+// there is no unit, then an empty unit name is returned.
+func firstUnit(elements []string) (string, []string) {
+	for idx, element := range elements {
+		if strings.HasSuffix(element, ".slice") {
+			continue
+		}
+		for _, suffix := range unitSuffixes {
+			if strings.HasSuffix(element, suffix) && len(element) > len(suffix) {
+				return element, elements[idx+1:]
+			}
+		}
+		break
+	}
+	return "", nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package systemd
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thediveo/lxkns"
+)
+
+var _ = Describe("systemd decorator", func() {
+
+	It("maps control group paths to units", func() {
+		for _, tt := range []struct {
+			path     string
+			unit     string
+			userunit string
+		}{
+			{"/init.scope", "init.scope", ""},
+			{"/system.slice/cron.service", "cron.service", ""},
+			{"/system.slice/system-getty.slice/getty@tty1.service", "getty@tty1.service", ""},
+			{"/user.slice/user-1000.slice/session-2.scope", "session-2.scope", ""},
+			{"/user.slice/user-1000.slice/user@1000.service/app.slice/foo.service", "user@1000.service", "foo.service"},
+			{"/user.slice/user-1000.slice/user@1000.service/init.scope", "user@1000.service", "init.scope"},
+			{"/docker/0123456789abcdef", "", ""},
+			{"/system.slice", "", ""},
+			{"/", "", ""},
+			{"", "", ""},
+		} {
+			unit, userunit := Units(tt.path)
+			Expect(unit).To(Equal(tt.unit), tt.path)
+			Expect(userunit).To(Equal(tt.userunit), tt.path)
+		}
+	})
+
+	It("reads the systemd-managed control group", func() {
+		Expect(cgroupPath("../../test/systemd/proc", 42)).To(Equal("/system.slice/cron.service"))
+		Expect(cgroupPath("../../test/systemd/proc", 1)).To(Equal("/init.scope"))
+		Expect(cgroupPath("../../test/systemd/proc", 12345)).To(BeEmpty())
+	})
+
+	It("labels processes", func() {
+		result := &lxkns.DiscoveryResult{
+			Processes: lxkns.ProcessTable{},
+		}
+		for _, pid := range []lxkns.PIDType{1, 42, 100, 200, 666, 12345} {
+			result.Processes[pid] = &lxkns.Process{PID: pid}
+		}
+		d := &Decorator{ProcRoot: "../../test/systemd/proc"}
+		d.Decorate(result)
+		Expect(result.Processes[1].Labels).To(Equal(map[string]string{
+			UnitLabel: "init.scope",
+		}))
+		Expect(result.Processes[42].Labels).To(Equal(map[string]string{
+			UnitLabel: "cron.service",
+		}))
+		Expect(result.Processes[100].Labels).To(Equal(map[string]string{
+			UnitLabel:     "user@1000.service",
+			UserUnitLabel: "foo.service",
+		}))
+		Expect(result.Processes[200].Labels).To(BeNil())
+		Expect(result.Processes[666].Labels).To(BeNil())
+		Expect(result.Processes[12345].Labels).To(BeNil())
+	})
+
+	It("prefers asking systemd", func() {
+		result := &lxkns.DiscoveryResult{
+			Processes: lxkns.ProcessTable{
+				1:  &lxkns.Process{PID: 1},
+				42: &lxkns.Process{PID: 42},
+			},
+		}
+		d := &Decorator{
+			ProcRoot: "../../test/systemd/proc",
+			UnitByPID: func(pid lxkns.PIDType) (string, error) {
+				if pid == 42 {
+					return "", errors.New("no such unit")
+				}
+				return "foobar.service", nil
+			},
+		}
+		d.Decorate(result)
+		Expect(result.Processes[1].Labels).To(HaveKeyWithValue(UnitLabel, "foobar.service"))
+		Expect(result.Processes[42].Labels).To(HaveKeyWithValue(UnitLabel, "cron.service"))
+	})
+
+})
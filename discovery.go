@@ -22,6 +22,7 @@ package lxkns
 import (
 	"fmt"
 	"sort"
+	"time"
 
 	"github.com/thediveo/lxkns/species"
 )
@@ -42,6 +43,52 @@ type DiscoverOpts struct {
 	SkipBindmounts bool // Don't scan for bind-mounted namespaces.
 	SkipHierarchy  bool // Don't discover the hierarchy of PID and user namespaces.
 	SkipOwnership  bool // Don't discover the ownership of non-user namespaces.
+
+	// Read additional process details, such as credentials and capabilities;
+	// see Process.Status.
+	WithProcessStatus bool
+	// Open process file descriptors for all processes discovered, so that
+	// follow-up operations on them cannot hit the wrong process in case of
+	// PID reuse; see Process.OpenPIDFD. The caller is responsible for
+	// eventually closing them using ProcessTable.ClosePIDFDs. Only supported
+	// when discovering from /proc, see also ProcRoot.
+	WithPIDFDs bool
+
+	// Decorators to run on the discovery results after the namespaces have
+	// been discovered, in order to attach labels with additional information,
+	// such as container identities.
+	Decorators []Decorator
+
+	// Custom discoverers to run in addition to the built-in discovery
+	// phases, in order to discover namespaces from other sources, such as
+	// container engines. See Discoverer for details.
+	Discoverers []Discoverer
+
+	// Maximum time a re-executed child gets for discovering in other mount
+	// namespaces; if zero, defaults to DefaultReexecTimeout.
+	ReexecTimeout time.Duration
+
+	// Root of the proc filesystem to discover processes from; if empty,
+	// defaults to "/proc".
+	ProcRoot string
+
+	// Only discover the namespaces of the processes with these PIDs, their
+	// open file descriptors, as well as the namespaces bind-mounted in their
+	// mount namespaces; if empty, discovers namespaces for all processes. The
+	// hierarchy and ownership of the namespaces found is still completed.
+	// Only the procfs entries of these processes get read, so their Parent
+	// and Children link only to other processes in the process table.
+	PIDs []PIDType
+	// When discovering only for specific PIDs, also include their
+	// descendant processes. As this needs to scan all processes, the scoped
+	// processes then keep their Parent and Children pointing to processes
+	// outside the process table, such as the parent of a scoped process.
+	WithDescendants bool
+
+	// Called before and after each discovery phase, such as for diagnosing
+	// slow discoveries; optional. See also DiscoveryResult.Stats.
+	BeforePhase PhaseHook
+	AfterPhase  PhaseHook
 }
 
 // FullDiscovery sets the discovery options to a full and thus extensive
@@ -63,12 +110,17 @@ var NoDiscovery = DiscoverOpts{
 // DiscoveryResult stores the results of a tour through Linux processes and
 // kernel namespaces.
 type DiscoveryResult struct {
-	Options           DiscoverOpts  // options used during discovery.
-	Namespaces        AllNamespaces // all discovered namespaces, subject to filtering according to Options.
-	InitialNamespaces NamespacesSet // the 7 initial namespaces.
-	UserNSRoots       []Namespace   // the topmost user namespace(s) in the hierarchy
-	PIDNSRoots        []Namespace   // the topmost PID namespace(s) in the hierarchy
-	Processes         ProcessTable  // processes checked for namespaces.
+	Options           DiscoverOpts   // options used during discovery.
+	Namespaces        AllNamespaces  // all discovered namespaces, subject to filtering according to Options.
+	InitialNamespaces NamespacesSet  // the 7 initial namespaces.
+	UserNSRoots       []Namespace    // the topmost user namespace(s) in the hierarchy
+	PIDNSRoots        []Namespace    // the topmost PID namespace(s) in the hierarchy
+	Processes         ProcessTable   // processes checked for namespaces.
+	Diagnostics       []error        // non-fatal problems encountered during discovery.
+	Stats             DiscoveryStats // timing and counts of the discovery phases.
+
+	phase  *PhaseStats           // statistics of the discovery phase currently running, if any.
+	nspids map[PIDType][]PIDType // namespaced PIDs captured in a bundle; only for offline discoveries.
 }
 
 // SortNamespaces returns a sorted copy of a list of namespaces. The
@@ -138,6 +190,13 @@ func rootNamespaces(nsmap NamespaceMap) []Namespace {
 	return result
 }
 
+// allNamespaceTypes is the set of all types of namespaces discovered when no
+// specific types of namespaces are requested in the discovery options.
+const allNamespaceTypes = species.CLONE_NEWNS |
+	species.CLONE_NEWCGROUP | species.CLONE_NEWUTS |
+	species.CLONE_NEWIPC | species.CLONE_NEWUSER |
+	species.CLONE_NEWPID | species.CLONE_NEWNET
+
 // discoverySequence contains the namespace type indices in the order of
 // preferred discovery. While often the order of sequence doesn't matter,
 // there are few cases where it makes coding discovery functionality easier
@@ -161,22 +220,38 @@ func init() {
 // initial namespaces, as well the process table/tree on which the discovery
 // bases at least in part.
 func Discover(opts DiscoverOpts) *DiscoveryResult {
-	result := &DiscoveryResult{
-		Options:   opts,
-		Processes: NewProcessTable(),
+	start := time.Now()
+	if opts.ProcRoot == "" {
+		opts.ProcRoot = "/proc"
+	}
+	result := &DiscoveryResult{Options: opts}
+	switch {
+	case len(opts.PIDs) == 0:
+		result.Processes = newProcessTable(opts.ProcRoot)
+	case opts.WithDescendants:
+		result.Processes = newProcessTable(opts.ProcRoot).scope(opts.PIDs)
+	default:
+		result.Processes = newProcessTableOf(opts.ProcRoot, opts.PIDs)
 	}
 	// If no namespace types are specified for discovery, we take this as
 	// discovering all types of namespaces.
 	if result.Options.NamespaceTypes == 0 {
-		result.Options.NamespaceTypes = species.CLONE_NEWNS |
-			species.CLONE_NEWCGROUP | species.CLONE_NEWUTS |
-			species.CLONE_NEWIPC | species.CLONE_NEWUSER |
-			species.CLONE_NEWPID | species.CLONE_NEWNET
+		result.Options.NamespaceTypes = allNamespaceTypes
 	}
 	// Finish initialization.
 	for idx := range result.Namespaces {
 		result.Namespaces[idx] = NamespaceMap{}
 	}
+	if opts.WithProcessStatus {
+		for pid, proc := range result.Processes {
+			proc.Status, _ = NewProcessStatus(pid, opts.ProcRoot)
+		}
+	}
+	if opts.WithPIDFDs {
+		if err := result.Processes.OpenPIDFDs(); err != nil {
+			result.Diagnostics = append(result.Diagnostics, err)
+		}
+	}
 	// Now go for discovery: we run the available discovery functions in
 	// sequence, subject to the following rules for the When field:
 	//   - []: call discovery function once; it'll know what to do.
@@ -184,12 +259,15 @@ func Discover(opts DiscoverOpts) *DiscoveryResult {
 	//     namespace type listed in the When field, and in the same order of
 	//     sequence.
 	for _, disco := range discoverers {
+		if disco.Custom != 0 {
+			discoverCustom(disco.Custom, result)
+		}
 		if len(*disco.When) == 0 {
-			disco.Discover(result.Options.NamespaceTypes, "/proc", result)
+			runPhase(disco, result.Options.NamespaceTypes, result)
 		} else {
 			for _, nstypeidx := range *disco.When {
 				if nstype := TypesByIndex[nstypeidx]; result.Options.NamespaceTypes&nstype != 0 {
-					disco.Discover(nstype, "/proc", result)
+					runPhase(disco, nstype, result)
 				}
 			}
 		}
@@ -203,6 +281,11 @@ func Discover(opts DiscoverOpts) *DiscoveryResult {
 	}
 	// TODO: Find the initial namespaces...
 
+	// Finally let the decorators add their information from outside the
+	// Linux kernel.
+	decorate(result)
+	result.Stats.Duration = time.Since(start)
+
 	// As a C oldie it gives me the shivers to return a pointer to what might
 	// look like an "auto" local struct ;)
 	return result
@@ -212,14 +295,16 @@ func Discover(opts DiscoverOpts) *DiscoveryResult {
 // functionality.
 type discoveryFunc func(species.NamespaceType, string, *DiscoveryResult)
 
-// discoverer describes a single discoveryFunc and when to call it: once, per
+// discoverer describes a single named discoveryFunc and when to call it: once, per
 // each namespace type and for which namespace types in what sequence. Please
 // note that we use a reference to a slice here, as discoverySequence will
 // only be only completed during the init() phase, but after(!)
 // discoverySequence has been set to its initial value. Sigh.
 type discoverer struct {
+	Name     string                // name of the discovery phase.
 	When     *[]NamespaceTypeIndex // indices of namespace types this discovery function discovers.
 	Discover discoveryFunc         // the concrete namespace discovery functionality.
+	Custom   DiscoveryStage        // if non-zero, custom discoverers of this stage run right before.
 }
 
 // Run a discoveryFunc only once per discovery, because it needs to work on
@@ -232,9 +317,10 @@ var discoveronce = []NamespaceTypeIndex{}
 // been initialized, we need to "late bind" it by reference (pointers to
 // slices, where has the world come to ... mumble ... mumble...)
 var discoverers = []discoverer{
-	{&discoverySequence, discoverFromProc},
-	{&discoveronce, discoverFromFd},
-	{&discoveronce, discoverBindmounts},
-	{&[]NamespaceTypeIndex{UserNS, PIDNS}, discoverHierarchy},
-	{&discoverySequence, resolveOwnership},
+	{Name: "proc", When: &discoverySequence, Discover: discoverFromProc},
+	{Name: "fd", When: &discoveronce, Discover: discoverFromFd},
+	{Name: "bindmounts", When: &discoveronce, Discover: discoverBindmounts},
+	{Name: "hierarchy", When: &[]NamespaceTypeIndex{UserNS, PIDNS}, Discover: discoverHierarchy, Custom: BeforeHierarchy},
+	{Name: "owners", When: &discoveronce, Discover: discoverMissingOwners, Custom: BeforeOwnership},
+	{Name: "ownership", When: &discoverySequence, Discover: resolveOwnership},
 }
@@ -20,8 +20,10 @@
 package lxkns
 
 import (
+	"context"
 	"encoding/json"
 	"os"
+	"path/filepath"
 
 	"github.com/thediveo/go-mntinfo"
 	"github.com/thediveo/gons/reexec"
@@ -39,6 +41,36 @@ type BindmountedNamespaceInfo struct {
 	OwnernsID species.NamespaceID   `json:"ownernsid"`
 }
 
+// NameLabel is the name of the label carrying a human-readable name of a
+// namespace, such as the name of a network namespace created using "ip netns
+// add".
+const NameLabel = "lxkns/name"
+
+// NetnsDirs lists the well-known directories where "ip netns", Docker, and CNI
+// plugins bind-mount network namespaces. Network namespaces bind-mounted in
+// these directories get named after their bind-mount's base name; this name is
+// then available in form of a NameLabel label.
+var NetnsDirs = []string{
+	"/run/netns",
+	"/var/run/netns",
+	"/run/docker/netns",
+	"/var/run/docker/netns",
+}
+
+// netnsName returns the name of a network namespace bind-mounted at the
+// specified path, if the path is located in one of the well-known NetnsDirs.
+// Otherwise, it returns an empty name.
+func netnsName(path string) string {
+	dir, name := filepath.Split(filepath.Clean(path))
+	dir = filepath.Clean(dir)
+	for _, netnsdir := range NetnsDirs {
+		if dir == filepath.Clean(netnsdir) {
+			return name
+		}
+	}
+	return ""
+}
+
 // discoverBindmounts checks bind-mounts to discover namespaces we haven't found
 // so far in the process' joined namespaces. This discovery function is designed
 // to be run only once per discovery: but it will search not only in the current
@@ -69,11 +101,23 @@ func discoverBindmounts(_ species.NamespaceType, _ string, result *DiscoveryResu
 			if bmntns.Type != species.CLONE_NEWUSER && bmntns.OwnernsID != species.NoneID {
 				ns.(NamespaceConfigurer).SetOwner(bmntns.OwnernsID)
 			}
+			// Network namespaces bind-mounted in the well-known places get
+			// a human-readable name, courtesy of "ip netns", et cetera.
+			if bmntns.Type == species.CLONE_NEWNET {
+				if name := netnsName(bmntns.Path); name != "" {
+					ns.(NamespaceConfigurer).SetLabel(NameLabel, name)
+				}
+			}
 		}
 	}
 	// Find any bind-mounted namespaces in the current namespace we're running
-	// in, and add them to the results.
-	updateNamespaces(ownedBindMounts())
+	// in, and add them to the results. When discovery is scoped to specific
+	// processes, we only do so if one of them is joined to our mount
+	// namespace.
+	ownmntnsid, _ := ops.NamespacePath("/proc/self/ns/mnt").ID()
+	if len(result.Options.PIDs) == 0 || result.Namespaces[MountNS][ownmntnsid] != nil {
+		updateNamespaces(ownedBindMounts())
+	}
 	// Now initialize a backlog with the mount namespaces we know so far,
 	// because we need to visit them in order to potentially discover more
 	// bind-mounted namespaces. These will then be added to the backlog if not
@@ -87,7 +131,6 @@ func discoverBindmounts(_ species.NamespaceType, _ string, result *DiscoveryResu
 	// namespace we've started our discovery in, as this will otherwise be
 	// visited twice.
 	visitedmntns := map[species.NamespaceID]bool{}
-	ownmntnsid, _ := ops.NamespacePath("/proc/self/ns/mnt").ID()
 	ownusernsid, _ := ops.NamespacePath("/proc/self/ns/user").ID()
 	visitedmntns[ownmntnsid] = true
 	// Now try to clear the back log of mount namespaces to visit and to
@@ -129,19 +172,29 @@ func discoverBindmounts(_ species.NamespaceType, _ string, result *DiscoveryResu
 		// out which namespace-related bind mounts might be found there...
 		visitedmntns[mntns.ID()] = true
 		var ownedbindmounts []BindmountedNamespaceInfo
-		if err := ReexecIntoAction(
-			"discover-nsfs-bindmounts", enterns, &ownedbindmounts); err == nil {
+		if err := reexecIntoAction(
+			result, "discover-nsfs-bindmounts", enterns, &ownedbindmounts); err == nil {
 			// TODO: remember mount namespace for namespaces found, so we
 			// still have a chance later to enter them by using the
 			// bind-mounted reference in a different mount namespace.
 			updateNamespaces(ownedbindmounts)
 		} else {
-			// TODO: for diagnosis:
-			// fmt.Fprintf(os.Stderr, "failed: %s\n", err.Error())
+			// Failing to look into a particular mount namespace doesn't spoil
+			// the whole discovery, but we keep the failure for diagnosis.
+			result.Diagnostics = append(result.Diagnostics, err)
 		}
 	}
 }
 
+// reexecIntoAction re-executes into the specified action, subject to the
+// re-execution timeout set in the discovery options.
+func reexecIntoAction(result *DiscoveryResult, actionname string, namespaces []Namespace, v interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), reexecTimeout(result))
+	defer cancel()
+	result.phaseStats().Reexecs++
+	return ReexecIntoActionContext(ctx, actionname, namespaces, nil, v)
+}
+
 // Register discoverNsfsBindmounts() as an action for re-execution.
 func init() {
 	reexec.Register("discover-nsfs-bindmounts", discoverNsfsBindmounts)
@@ -24,6 +24,15 @@ import (
 
 var _ = Describe("Discover from bind-mounts", func() {
 
+	It("names bind-mounted network namespaces in well-known places", func() {
+		Expect(netnsName("/run/netns/blue")).To(Equal("blue"))
+		Expect(netnsName("/var/run/netns//red")).To(Equal("red"))
+		Expect(netnsName("/var/run/docker/netns/1a2b3c4d5e6f")).To(Equal("1a2b3c4d5e6f"))
+		Expect(netnsName("/run/netns")).To(BeEmpty())
+		Expect(netnsName("/run/netns/blue/green")).To(BeEmpty())
+		Expect(netnsName("/tmp/netbindmount")).To(BeEmpty())
+	})
+
 	It("finds hidden hierarchical user namespaces", func() {
 		scripts := testbasher.Basher{}
 		defer scripts.Done()
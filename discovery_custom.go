@@ -0,0 +1,149 @@
+// Extends the namespace discovery with custom discoverers, looking for
+// namespaces in places lxkns doesn't know about.
+
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// +build linux
+
+package lxkns
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/thediveo/lxkns/ops"
+	"github.com/thediveo/lxkns/species"
+)
+
+// DiscoveryStage specifies when a custom Discoverer runs, relative to the
+// built-in discovery phases.
+type DiscoveryStage int
+
+// The stages at which custom discoverers can run.
+const (
+	// Run after the processes, their open file descriptors, and the
+	// bind-mounted namespaces have been scanned, but before the user and PID
+	// namespace hierarchies get discovered. This is the stage to use for
+	// discovering additional namespaces.
+	BeforeHierarchy DiscoveryStage = iota + 1
+	// Run after the user and PID namespace hierarchies have been discovered,
+	// but before the owning user namespaces get resolved. Please note that
+	// user and PID namespaces added at this stage won't become part of their
+	// hierarchies.
+	BeforeOwnership
+)
+
+// Discoverer discovers namespaces from sources lxkns doesn't know about out
+// of the box, such as the namespace references stored by a particular
+// container engine. Discoverers add the namespaces they find using
+// DiscoveryResult.AddNamespace and DiscoveryResult.AddNamespaceRef. Custom
+// discoverers are specified in DiscoverOpts.Discoverers.
+type Discoverer interface {
+	// Name returns the name of the discovery phase of this discoverer, such
+	// as used in the discovery statistics.
+	Name() string
+	// Stage returns when this discoverer is to be run.
+	Stage() DiscoveryStage
+	// Discover adds the namespaces found to the specified discovery result.
+	// Failures not spoiling the whole discovery should be added to the
+	// discovery result's Diagnostics.
+	Discover(result *DiscoveryResult)
+}
+
+// discoverCustom runs the custom discoverers for the specified stage, in the
+// order of their appearance in the discovery options. Each custom discoverer
+// runs as its own discovery phase.
+func discoverCustom(stage DiscoveryStage, result *DiscoveryResult) {
+	for _, custom := range result.Options.Discoverers {
+		if custom.Stage() != stage {
+			continue
+		}
+		custom := custom // ...sigh, closures.
+		runPhase(discoverer{
+			Name: custom.Name(),
+			When: &discoveronce,
+			Discover: func(_ species.NamespaceType, _ string, result *DiscoveryResult) {
+				custom.Discover(result)
+			},
+		}, result.Options.NamespaceTypes, result)
+	}
+}
+
+// AddNamespace adds the namespace with the specified type and identifier to
+// the discovery result, unless it is already known. In any case, it returns
+// the namespace object from the discovery result; but it returns nil for
+// namespace types not selected in the discovery options' NamespaceTypes. If
+// the namespace doesn't have a reference yet, then it gets the specified
+// reference, which should be a filesystem path suitable for opening the
+// namespace. For newly added non-user namespaces, the owning user namespace
+// gets detected via the reference, unless discovering the ownership is to be
+// skipped.
+func (dr *DiscoveryResult) AddNamespace(nstype species.NamespaceType, nsid species.NamespaceID, ref string) Namespace {
+	nstypeidx := TypeIndex(nstype)
+	if nstypeidx < 0 || dr.Options.NamespaceTypes&nstype == 0 {
+		return nil
+	}
+	nsmap := dr.Namespaces[nstypeidx]
+	if nsmap == nil {
+		nsmap = NamespaceMap{}
+		dr.Namespaces[nstypeidx] = nsmap
+	}
+	if ns, ok := nsmap[nsid]; ok {
+		if ns.Ref() == "" && ref != "" {
+			ns.(NamespaceConfigurer).SetRef(ref)
+		}
+		return ns
+	}
+	ns := NewNamespace(nstype, nsid, ref)
+	nsmap[nsid] = ns
+	if ref != "" && !dr.Options.SkipOwnership && nstype != species.CLONE_NEWUSER {
+		if nsf, err := ops.NewNamespaceFile(os.OpenFile(ref, os.O_RDONLY, 0)); err == nil {
+			ns.(NamespaceConfigurer).DetectOwner(nsf)
+			nsf.Close()
+		}
+	}
+	return ns
+}
+
+// AddNamespaceRef adds the namespace referenced by the specified filesystem
+// path to the discovery result, unless it is already known, and returns the
+// namespace object from the discovery result; see also AddNamespace. The
+// path can be any reference to a namespace, such as a bind-mounted namespace
+// or a "/proc/[PID]/ns/*" link. An error is returned for namespaces of types
+// not selected in the discovery options' NamespaceTypes.
+func (dr *DiscoveryResult) AddNamespaceRef(ref string) (Namespace, error) {
+	nsf, err := ops.NewNamespaceFile(os.OpenFile(ref, os.O_RDONLY, 0))
+	if err != nil {
+		return nil, err
+	}
+	defer nsf.Close()
+	nstype, err := nsf.Type()
+	if err != nil {
+		return nil, err
+	}
+	if TypeIndex(nstype) >= 0 && dr.Options.NamespaceTypes&nstype == 0 {
+		return nil, fmt.Errorf("lxkns: %s namespace referenced by %q not selected for discovery",
+			nstype.Name(), ref)
+	}
+	nsid, err := nsf.ID()
+	if err != nil {
+		return nil, err
+	}
+	ns := dr.AddNamespace(nstype, nsid, ref)
+	if ns == nil {
+		return nil, fmt.Errorf("lxkns: unsupported type of namespace referenced by %q", ref)
+	}
+	return ns, nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package lxkns
+
+import (
+	"fmt"
+	"os/exec"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thediveo/lxkns/ops"
+	"github.com/thediveo/lxkns/species"
+)
+
+// testDiscoverer is a custom discoverer running a function at a particular
+// discovery stage.
+type testDiscoverer struct {
+	name  string
+	stage DiscoveryStage
+	fn    func(result *DiscoveryResult)
+}
+
+func (d *testDiscoverer) Name() string                     { return d.name }
+func (d *testDiscoverer) Stage() DiscoveryStage            { return d.stage }
+func (d *testDiscoverer) Discover(result *DiscoveryResult) { d.fn(result) }
+
+var _ = Describe("Discover with custom discoverers", func() {
+
+	It("runs custom discoverers at their stages", func() {
+		phases := []string{}
+		opts := NoDiscovery
+		opts.NamespaceTypes = species.CLONE_NEWUSER
+		opts.Discoverers = []Discoverer{
+			&testDiscoverer{name: "late", stage: BeforeOwnership, fn: func(*DiscoveryResult) {}},
+			&testDiscoverer{name: "early", stage: BeforeHierarchy, fn: func(*DiscoveryResult) {}},
+		}
+		opts.BeforePhase = func(stats *PhaseStats, _ *DiscoveryResult) {
+			phases = append(phases, stats.Phase)
+		}
+		Discover(opts)
+		Expect(phases).To(Equal([]string{
+			"proc", "fd", "bindmounts",
+			"early", "hierarchy",
+			"late", "owners", "ownership",
+		}))
+	})
+
+	It("adds namespaces from custom discoverers", func() {
+		sleepy := exec.Command("unshare", "-Urn", "sleep", "60")
+		Expect(sleepy.Start()).To(Succeed())
+		defer func() {
+			_ = sleepy.Process.Kill()
+			_ = sleepy.Wait()
+		}()
+		netnsref := fmt.Sprintf("/proc/%d/ns/net", sleepy.Process.Pid)
+		var netnsid, usernsid species.NamespaceID
+		Eventually(func() error {
+			var err error
+			usernsid, err = ops.NamespacePath(fmt.Sprintf("/proc/%d/ns/user", sleepy.Process.Pid)).ID()
+			if err != nil {
+				return err
+			}
+			myusernsid, _ := ops.NamespacePath("/proc/self/ns/user").ID()
+			if usernsid == myusernsid {
+				return fmt.Errorf("user namespace not yet created")
+			}
+			netnsid, err = ops.NamespacePath(netnsref).ID()
+			return err
+		}).Should(Succeed())
+
+		var netns Namespace
+		opts := NoDiscovery
+		opts.SkipHierarchy = false
+		opts.SkipOwnership = false
+		opts.Discoverers = []Discoverer{
+			&testDiscoverer{name: "custom", stage: BeforeHierarchy, fn: func(result *DiscoveryResult) {
+				var err error
+				netns, err = result.AddNamespaceRef(netnsref)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.AddNamespace(species.CLONE_NEWNET, netnsid, "")).To(BeIdenticalTo(netns))
+				_, err = result.AddNamespaceRef("/proc/self/exe")
+				Expect(err).To(HaveOccurred())
+				Expect(result.AddNamespace(species.NaNS, netnsid, "")).To(BeNil())
+			}},
+		}
+		allns := Discover(opts)
+		Expect(netns).NotTo(BeNil())
+		Expect(netns.ID()).To(Equal(netnsid))
+		Expect(netns.Ref()).To(Equal(netnsref))
+		Expect(allns.Namespaces[NetNS]).To(HaveKeyWithValue(netnsid, netns))
+		// Even without any process having been scanned, the owning user
+		// namespace has been discovered.
+		owner, ok := netns.Owner().(Namespace)
+		Expect(ok).To(BeTrue())
+		Expect(owner).NotTo(BeNil())
+		Expect(owner.ID()).To(Equal(usernsid))
+		Expect(owner.(Hierarchy).Parent()).NotTo(BeNil())
+	})
+
+	It("adds only namespaces of the types selected", func() {
+		ipcnsid, err := ops.NamespacePath("/proc/self/ns/ipc").ID()
+		Expect(err).NotTo(HaveOccurred())
+		opts := NoDiscovery
+		opts.NamespaceTypes = species.CLONE_NEWNET | species.CLONE_NEWUSER
+		opts.Discoverers = []Discoverer{
+			&testDiscoverer{name: "custom", stage: BeforeHierarchy, fn: func(result *DiscoveryResult) {
+				_, err := result.AddNamespaceRef("/proc/self/ns/ipc")
+				Expect(err).To(MatchError(ContainSubstring("not selected")))
+				Expect(result.AddNamespace(species.CLONE_NEWIPC, ipcnsid, "")).To(BeNil())
+				Expect(result.AddNamespaceRef("/proc/self/ns/net")).NotTo(BeNil())
+			}},
+		}
+		allns := Discover(opts)
+		Expect(allns.Namespaces[IPCNS]).To(BeEmpty())
+		Expect(allns.Namespaces[NetNS]).To(HaveLen(1))
+	})
+
+})
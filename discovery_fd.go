@@ -54,6 +54,8 @@ func scanFd(_ species.NamespaceType, procfs string, fakeprocfs bool, result *Dis
 		if err != nil {
 			continue
 		}
+		result.phaseStats().Processes++
+		result.phaseStats().Fds += len(fdentries)
 		for _, fdentry := range fdentries {
 			// Filter out all open file descriptors which are not symbolic
 			// links; please note that there should only be symbolic links,
@@ -91,7 +93,7 @@ func scanFd(_ species.NamespaceType, procfs string, fakeprocfs bool, result *Dis
 					continue
 				}
 			}
-			nsid.Dev = stat.Dev
+			nsid.Dev = uint64(stat.Dev)
 			// Check if we already know this namespace, otherwise is a new
 			// discovery. Add such new discoveries and use the /proc fd path
 			// as a path reference in case we want later to make use of this
@@ -31,6 +31,8 @@
 package lxkns
 
 import (
+	"errors"
+	"fmt"
 	"os"
 
 	"github.com/thediveo/lxkns/ops"
@@ -70,67 +72,80 @@ func discoverHierarchy(nstype species.NamespaceType, _ string, result *Discovery
 		if err != nil {
 			continue
 		}
-		// Now, go climbing up the hierarchy...
-		for {
-			// We already worked on this user/pid namespace, so we don't need
-			// to climb up further. This won't catch the initial user/pid
-			// namespaces, but then these will break out of the loop anyway,
-			// as they don't have any parents.
-			if ns.(Hierarchy).Parent() != nil {
-				break
-			}
-			// By the way ... if it's a user namespace, then get its owner's
-			// UID, as we just happen to have a useful fd referencing the
-			// namespace open anyway.
-			if nstype == species.CLONE_NEWUSER {
-				ns.(*userNamespace).detectUID(nsf)
-			}
-			// See if there is a parent of this namespace at all, or whether
-			// we've reached the end of the road. Normally, this should be the
-			// initial user or PID namespace. But if we have insufficient
-			// capabilities, then we'll hit a brickwall earlier.
-			parentnsf, err := nsf.Parent()
-			if err != nil {
-				// There is no parent user/PID namespace, so we're done in
-				// this line. Let's move on to the next namespace. The reasons
-				// for not having a parent are: (1) initial namespace, so no
-				// parent; (2) no capabilities in parent namespace, so no
-				// parent either.
-				break
-			}
-			parentnsid, err := parentnsf.ID()
-			if err != nil {
-				// There is something severely rotten here, because the kernel
-				// just gave us a parent namespace reference which we cannot
-				// stat. Either we get a parent namespace reference which then
-				// has to work, or we won't get a reference from the parent
-				// namespace ioctl() syscall.
-				panic("cannot stat parent namespace fd reference")
-			}
-			parentns, ok := nsmap[parentnsid]
-			if !ok {
-				// So we've found a "hidden" namespace. For user namespaces
-				// this happens when there are no processes joined to a
-				// particular user namespace, but this user namespace has
-				// still child user namespaces. For PID namespaces this can
-				// only happen when bind-mounting a PID namespace or keeping
-				// it opened by an file descriptor ("fd-tied"), and there are
-				// no processes either in it or any of its child processes
-				// (which are also bind-mounted or fd-tied).
-				//
-				// Anyway, we need to create a new namespace node for what we
-				// found.
-				parentns = NewNamespace(nstype, parentnsid, "")
-				nsmap[parentnsid] = parentns
-			}
-			// Now insert the current namespace as a child of its parent in
-			// the hierarchy, and then prepare for the next rung...
-			parentns.(HierarchyConfigurer).AddChild(ns.(Hierarchy))
-			ns = parentns
-			nsf.Close()
-			nsf = parentnsf
+		// By the way ... if it's a user namespace, then get its owner's UID,
+		// as we just happen to have a useful fd referencing the namespace
+		// open anyway.
+		if nstype == species.CLONE_NEWUSER {
+			ns.(*userNamespace).detectUID(nsf)
+		}
+		if err := climbHierarchy(ns, nsf, nstype, nsmap); err != nil {
+			// Failing to climb up a particular line of the hierarchy doesn't
+			// spoil the whole discovery, but we keep the failure for
+			// diagnosis.
+			result.Diagnostics = append(result.Diagnostics, err)
 		}
 		// Don't leak...
 		nsf.Close()
 	}
 }
+
+// climbHierarchy climbs up the hierarchy of user or PID namespaces, starting
+// with the specified namespace referenced by nsf, and adds the ancestor
+// namespaces not known so far to nsmap. It returns an error only for real
+// failures, but not when reaching the topmost namespace visible to us.
+func climbHierarchy(ns Namespace, nsf *ops.NamespaceFile, nstype species.NamespaceType, nsmap NamespaceMap) error {
+	// Go climbing up the hierarchy, until there is no parent anymore.
+	// Normally, this should be the initial user or PID namespace. But if we
+	// have insufficient capabilities, then we'll hit a brickwall earlier.
+	var iderr error
+	err := ops.WalkAncestors(nsf, func(parentnsf *ops.NamespaceFile) bool {
+		parentnsid, err := parentnsf.ID()
+		if err != nil {
+			// There is something severely rotten here, because the kernel
+			// just gave us a parent namespace reference which we cannot
+			// stat. As we cannot sensibly climb any further, we leave
+			// this line of the hierarchy as it is.
+			iderr = err
+			return false
+		}
+		parentns, ok := nsmap[parentnsid]
+		if !ok {
+			// So we've found a "hidden" namespace. For user namespaces
+			// this happens when there are no processes joined to a
+			// particular user namespace, but this user namespace has
+			// still child user namespaces. For PID namespaces this can
+			// only happen when bind-mounting a PID namespace or keeping
+			// it opened by an file descriptor ("fd-tied"), and there are
+			// no processes either in it or any of its child processes
+			// (which are also bind-mounted or fd-tied).
+			//
+			// Anyway, we need to create a new namespace node for what we
+			// found.
+			parentns = NewNamespace(nstype, parentnsid, "")
+			nsmap[parentnsid] = parentns
+		}
+		// Now insert the current namespace as a child of its parent in
+		// the hierarchy, and then prepare for the next rung...
+		parentns.(HierarchyConfigurer).AddChild(ns.(Hierarchy))
+		ns = parentns
+		// We already worked on this user/pid namespace, so we don't need
+		// to climb up further. This won't catch the initial user/pid
+		// namespaces, but then these will end the walk anyway, as they
+		// don't have any parents.
+		if ns.(Hierarchy).Parent() != nil {
+			return false
+		}
+		if nstype == species.CLONE_NEWUSER {
+			ns.(*userNamespace).detectUID(parentnsf)
+		}
+		return true
+	})
+	// Hitting the brickwall isn't an error, as ops.ErrNoParent tells us that
+	// there is no parent visible to us anymore. But anything else, such as
+	// a lack of privileges, is.
+	if err != nil && !errors.Is(err, ops.ErrNoParent) {
+		return fmt.Errorf("lxkns: cannot discover parent of %s:[%d]: %w",
+			nstype.Name(), ns.ID().Ino, err)
+	}
+	return iderr
+}
@@ -19,7 +19,12 @@
 
 package lxkns
 
-import "github.com/thediveo/lxkns/species"
+import (
+	"os"
+
+	"github.com/thediveo/lxkns/ops"
+	"github.com/thediveo/lxkns/species"
+)
 
 // resolveOwnership unearths which non-user namespaces are owned by which user
 // namespaces. We only run the resolution phase after we've discovered a
@@ -39,3 +44,47 @@ func resolveOwnership(nstype species.NamespaceType, _ string, result *DiscoveryR
 		ns.(NamespaceConfigurer).ResolveOwner(usernsmap)
 	}
 }
+
+// discoverMissingOwners discovers those user namespaces which own other
+// namespaces, but which haven't been discovered so far, because no process
+// has joined them, nor are they ancestors of other user namespaces. Such as
+// when discovery is scoped to particular processes which have joined
+// namespaces owned by user namespaces they haven't joined. Missing owners are
+// added to the user namespace hierarchy.
+func discoverMissingOwners(_ species.NamespaceType, _ string, result *DiscoveryResult) {
+	if result.Options.SkipOwnership ||
+		result.Options.NamespaceTypes&species.CLONE_NEWUSER == 0 {
+		return
+	}
+	usernsmap := result.Namespaces[UserNS]
+	for nstypeidx, nsmap := range result.Namespaces {
+		if NamespaceTypeIndex(nstypeidx) == UserNS {
+			continue
+		}
+		for _, ns := range nsmap {
+			ownernsid := ns.(interface{ ownerID() species.NamespaceID }).ownerID()
+			if ownernsid == species.NoneID || usernsmap[ownernsid] != nil {
+				continue
+			}
+			// Get a reference to the missing owner via the namespace it
+			// owns, so we can then climb up the user namespace hierarchy,
+			// starting from the owner.
+			nsf, err := ops.NewNamespaceFile(os.OpenFile(ns.Ref(), os.O_RDONLY, 0))
+			if err != nil {
+				continue
+			}
+			ownernsf, err := nsf.User()
+			nsf.Close()
+			if err != nil {
+				continue
+			}
+			userns := NewNamespace(species.CLONE_NEWUSER, ownernsid, "")
+			usernsmap[ownernsid] = userns
+			userns.(*userNamespace).detectUID(ownernsf)
+			if !result.Options.SkipHierarchy {
+				climbHierarchy(userns, ownernsf, species.CLONE_NEWUSER, usernsmap)
+			}
+			ownernsf.Close()
+		}
+	}
+}
@@ -42,13 +42,14 @@ import (
 // using the namespace links inside the proc filesystem: "/proc/[PID]/ns/...".
 // It does not check any other places, as these are covered by separate
 // discovery functions.
-func discoverFromProc(nstype species.NamespaceType, _ string, result *DiscoveryResult) {
+func discoverFromProc(nstype species.NamespaceType, procroot string, result *DiscoveryResult) {
 	if result.Options.SkipProcs {
 		return
 	}
 	nstypename := nstype.Name()
 	nstypeidx := TypeIndex(nstype)
 	nsmap := result.Namespaces[nstypeidx]
+	result.phaseStats().Processes += len(result.Processes)
 	// For all processes (but not tasks/threads) listed in /proc try to gather
 	// the namespaces of a given type they use.
 	for pid, proc := range result.Processes {
@@ -58,7 +59,7 @@ func discoverFromProc(nstype species.NamespaceType, _ string, result *DiscoveryR
 		// filesystem, but in fact are behaving like hard links. Nevertheless,
 		// we have to follow them like symbolic links in order to find the
 		// identifier in form of the inode # of the referenced namespace.
-		nsref := fmt.Sprintf("/proc/%d/ns/%s", pid, nstypename)
+		nsref := fmt.Sprintf("%s/%d/ns/%s", procroot, pid, nstypename)
 		// Avoid using high-level golang i/o calls, as these like to hand over
 		// to yet another goroutine, something which really doesn't help us
 		// here. Please note that we need the open fd further below in case we
@@ -101,6 +102,21 @@ func discoverFromProc(nstype species.NamespaceType, _ string, result *DiscoveryR
 	}
 	// Now that we know which namespaces are existing with processes joined to
 	// them, let's find out the leader processes in these namespaces...
+	findLeaders(nstypeidx, result)
+	// Try to set namespace references which we hope to be as longlived as
+	// possible; so we use one of the leader processes.
+	for _, ns := range nsmap {
+		if leaders := ns.Leaders(); len(leaders) > 0 {
+			ns.(NamespaceConfigurer).SetRef(
+				fmt.Sprintf("%s/%d/ns/%s", procroot, leaders[0].PID, nstypename))
+		}
+	}
+}
+
+// findLeaders finds the leader processes of the namespaces of the specified
+// type, based on the namespaces the processes are joined to. Processes
+// without a namespace of this type are removed from the process table.
+func findLeaders(nstypeidx NamespaceTypeIndex, result *DiscoveryResult) {
 	for pid, proc := range result.Processes {
 		// In case we got no access to this process, we must skip it. And we
 		// must remove it from our process table, so others won't try to use
@@ -122,12 +138,4 @@ func discoverFromProc(nstype species.NamespaceType, _ string, result *DiscoveryR
 		}
 		p.Namespaces[nstypeidx].(NamespaceConfigurer).AddLeader(p)
 	}
-	// Try to set namespace references which we hope to be as longlived as
-	// possible; so we use one of the leader processes.
-	for _, ns := range nsmap {
-		if leaders := ns.Leaders(); len(leaders) > 0 {
-			ns.(NamespaceConfigurer).SetRef(
-				fmt.Sprintf("/proc/%d/ns/%s", leaders[0].PID, nstypename))
-		}
-	}
 }
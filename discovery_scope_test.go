@@ -0,0 +1,149 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package lxkns
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thediveo/lxkns/ops"
+	"github.com/thediveo/lxkns/species"
+)
+
+var _ = Describe("Discover scoped", func() {
+
+	It("scopes process tables", func() {
+		pt := ProcessTable{}
+		for _, proc := range []*Process{
+			{PID: 1, PPID: 0},
+			{PID: 42, PPID: 1},
+			{PID: 43, PPID: 42},
+			{PID: 666, PPID: 43},
+			{PID: 44, PPID: 1},
+		} {
+			pt[proc.PID] = proc
+		}
+		pt.link()
+		scoped := pt.scope([]PIDType{42, 44})
+		Expect(scoped).To(HaveLen(4))
+		Expect(scoped).To(HaveKey(PIDType(666)))
+		Expect(scoped[42].Parent).To(BeIdenticalTo(pt[1]))
+		Expect(pt.scope([]PIDType{1234})).To(BeEmpty())
+	})
+
+	It("reads only the processes in scope", func() {
+		pt := newProcessTableOf("test/proctable/proc", []PIDType{42, 42, 1234, -1})
+		Expect(pt).To(HaveLen(1))
+		Expect(pt[42].Parent).To(BeNil())
+		pt = newProcessTableOf("test/proctable/proc", []PIDType{42, 1})
+		Expect(pt).To(HaveLen(2))
+		Expect(pt[42].Parent).To(BeIdenticalTo(pt[1]))
+		Expect(pt[1].Children).To(ConsistOf(pt[42]))
+	})
+
+	It("discovers only for specific processes", func() {
+		// Set up a process in a new user and network namespace, and then a
+		// second process joining only the new network namespace, but not
+		// the new user namespace owning it.
+		sleepy := exec.Command("unshare", "-Urn", "sleep", "60")
+		Expect(sleepy.Start()).To(Succeed())
+		defer func() {
+			_ = sleepy.Process.Kill()
+			_ = sleepy.Wait()
+		}()
+		var childusernsid, childnetnsid species.NamespaceID
+		Eventually(func() error {
+			usernsid, err := ops.NamespacePath(fmt.Sprintf("/proc/%d/ns/user", sleepy.Process.Pid)).ID()
+			if err != nil {
+				return err
+			}
+			netnsid, err := ops.NamespacePath(fmt.Sprintf("/proc/%d/ns/net", sleepy.Process.Pid)).ID()
+			if err != nil {
+				return err
+			}
+			myusernsid, _ := ops.NamespacePath("/proc/self/ns/user").ID()
+			if usernsid == myusernsid {
+				return fmt.Errorf("user namespace not yet created")
+			}
+			childusernsid, childnetnsid = usernsid, netnsid
+			return nil
+		}).Should(Succeed())
+
+		joiner := exec.Command("nsenter", "-t", fmt.Sprint(sleepy.Process.Pid), "-n",
+			"sh", "-c", "sleep 60 & exec sleep 61")
+		Expect(joiner.Start()).To(Succeed())
+		defer func() {
+			_ = joiner.Process.Kill()
+			_ = joiner.Wait()
+		}()
+		joinerpid := PIDType(joiner.Process.Pid)
+		var childpid PIDType
+		Eventually(func() error {
+			children, _ := ioutil.ReadFile(fmt.Sprintf(
+				"/proc/%d/task/%d/children", joinerpid, joinerpid))
+			fields := strings.Fields(string(children))
+			if len(fields) == 0 {
+				return fmt.Errorf("no child process yet")
+			}
+			_, err := fmt.Sscan(fields[0], &childpid)
+			if err != nil {
+				return err
+			}
+			netnsid, _ := ops.NamespacePath(fmt.Sprintf("/proc/%d/ns/net", joinerpid)).ID()
+			if netnsid != childnetnsid {
+				return fmt.Errorf("network namespace not yet joined")
+			}
+			return nil
+		}).Should(Succeed())
+
+		opts := FullDiscovery
+		opts.PIDs = []PIDType{joinerpid}
+		allns := Discover(opts)
+		Expect(allns.Processes).To(HaveLen(1))
+		Expect(allns.Processes).To(HaveKey(joinerpid))
+		Expect(allns.Processes).NotTo(HaveKey(PIDType(os.Getpid())))
+
+		netns := allns.Processes[joinerpid].Namespaces[NetNS]
+		Expect(netns).NotTo(BeNil())
+		Expect(netns.ID()).To(Equal(childnetnsid))
+		// The owning user namespace hasn't been joined by any of the scoped
+		// processes, yet it must have been discovered and properly put into
+		// the user namespace hierarchy.
+		owner, ok := netns.Owner().(Namespace)
+		Expect(ok).To(BeTrue())
+		Expect(owner).NotTo(BeNil())
+		Expect(owner.ID()).To(Equal(childusernsid))
+		Expect(allns.Namespaces[UserNS]).To(HaveKey(childusernsid))
+		myuserns := allns.Processes[joinerpid].Namespaces[UserNS]
+		Expect(owner.(Hierarchy).Parent()).To(BeIdenticalTo(myuserns))
+		Expect(allns.UserNSRoots).To(ConsistOf(myuserns))
+
+		opts.WithDescendants = true
+		allns = Discover(opts)
+		Expect(allns.Processes).To(HaveLen(2))
+		Expect(allns.Processes).To(HaveKey(joinerpid))
+		Expect(allns.Processes).To(HaveKey(childpid))
+
+		opts.PIDs = []PIDType{-1}
+		allns = Discover(opts)
+		Expect(allns.Processes).To(BeEmpty())
+	})
+
+})
@@ -0,0 +1,108 @@
+// Hooks into the individual phases of a namespace discovery and records their
+// timing and counts.
+
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// +build linux
+
+package lxkns
+
+import (
+	"time"
+
+	"github.com/thediveo/lxkns/species"
+)
+
+// PhaseStats records what happened during a single discovery phase, that is,
+// a single call of one of the discovery functions, such as scanning the
+// processes for namespaces of a particular type.
+type PhaseStats struct {
+	Phase      string                // name of the discovery phase, such as "proc" or "bindmounts".
+	Type       species.NamespaceType // namespace type(s) to be discovered in this phase.
+	Duration   time.Duration         // time spent in this phase.
+	Processes  int                   // number of processes scanned.
+	Fds        int                   // number of open file descriptors scanned.
+	Reexecs    int                   // number of child processes re-executed.
+	Namespaces int                   // number of namespaces newly found.
+}
+
+// DiscoveryStats records the timing and counts of a discovery, both in total
+// as well as per discovery phase.
+type DiscoveryStats struct {
+	Duration time.Duration // total time spent on the discovery.
+	Phases   []PhaseStats  // statistics per discovery phase, in the order of the phases.
+}
+
+// PhaseHook is called before and after each discovery phase; see
+// DiscoverOpts.BeforePhase and DiscoverOpts.AfterPhase. Before a phase, only
+// the phase name and namespace type(s) of the stats are set, while after a
+// phase the stats are complete. The hook must neither modify the stats, nor
+// keep them after returning.
+type PhaseHook func(stats *PhaseStats, result *DiscoveryResult)
+
+// Totals returns the sums of the counts over all discovery phases, as well as
+// the sum of the phase durations.
+func (s *DiscoveryStats) Totals() (totals PhaseStats) {
+	for _, phase := range s.Phases {
+		totals.Duration += phase.Duration
+		totals.Processes += phase.Processes
+		totals.Fds += phase.Fds
+		totals.Reexecs += phase.Reexecs
+		totals.Namespaces += phase.Namespaces
+	}
+	return
+}
+
+// runPhase runs the specified discoverer for the given namespace type(s),
+// calling the phase hooks before and after, and records the phase's
+// statistics.
+func runPhase(disco discoverer, nstype species.NamespaceType, result *DiscoveryResult) {
+	result.Stats.Phases = append(result.Stats.Phases, PhaseStats{
+		Phase: disco.Name,
+		Type:  nstype,
+	})
+	stats := &result.Stats.Phases[len(result.Stats.Phases)-1]
+	result.phase = stats
+	if result.Options.BeforePhase != nil {
+		result.Options.BeforePhase(stats, result)
+	}
+	nscount := result.Namespaces.count()
+	start := time.Now()
+	disco.Discover(nstype, result.Options.ProcRoot, result)
+	stats.Duration = time.Since(start)
+	stats.Namespaces = result.Namespaces.count() - nscount
+	result.phase = nil
+	if result.Options.AfterPhase != nil {
+		result.Options.AfterPhase(stats, result)
+	}
+}
+
+// phaseStats returns the statistics of the discovery phase currently running,
+// so that discovery functions can update the counts. When called outside a
+// discovery phase, the counts are simply discarded.
+func (dr *DiscoveryResult) phaseStats() *PhaseStats {
+	if dr.phase == nil {
+		return &PhaseStats{}
+	}
+	return dr.phase
+}
+
+// count returns the number of namespaces of all types.
+func (a *AllNamespaces) count() (count int) {
+	for _, nsmap := range a {
+		count += len(nsmap)
+	}
+	return
+}
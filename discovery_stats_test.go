@@ -0,0 +1,75 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package lxkns
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thediveo/lxkns/species"
+)
+
+var _ = Describe("Discovery statistics", func() {
+
+	It("calls phase hooks and records statistics", func() {
+		before := []string{}
+		after := []string{}
+		opts := FullDiscovery
+		opts.SkipBindmounts = true
+		opts.NamespaceTypes = species.CLONE_NEWUSER | species.CLONE_NEWNET
+		opts.BeforePhase = func(stats *PhaseStats, result *DiscoveryResult) {
+			Expect(result).NotTo(BeNil())
+			Expect(stats.Duration).To(BeZero())
+			before = append(before, stats.Phase+":"+stats.Type.Name())
+		}
+		opts.AfterPhase = func(stats *PhaseStats, result *DiscoveryResult) {
+			after = append(after, stats.Phase+":"+stats.Type.Name())
+		}
+		allns := Discover(opts)
+
+		phases := []string{
+			"proc:user", "proc:net",
+			"fd:",
+			"bindmounts:",
+			"hierarchy:user",
+			"owners:",
+			"ownership:user", "ownership:net",
+		}
+		Expect(before).To(Equal(phases))
+		Expect(after).To(Equal(phases))
+
+		stats := allns.Stats
+		Expect(stats.Phases).To(HaveLen(len(phases)))
+		Expect(stats.Duration).To(BeNumerically(">", time.Duration(0)))
+		Expect(stats.Phases[0].Processes).To(BeNumerically(">=", len(allns.Processes)))
+		Expect(stats.Phases[0].Namespaces).To(BeNumerically(">", 0))
+		Expect(stats.Phases[2].Fds).To(BeNumerically(">", 0))
+		Expect(stats.Phases[3].Reexecs).To(BeZero())
+
+		totals := stats.Totals()
+		Expect(totals.Duration).To(BeNumerically("<=", stats.Duration))
+		Expect(totals.Namespaces).To(Equal(
+			len(allns.Namespaces[UserNS]) + len(allns.Namespaces[NetNS])))
+		Expect(totals.Processes).To(BeNumerically(">=", stats.Phases[0].Processes))
+	})
+
+	It("discards counts outside discovery phases", func() {
+		result := &DiscoveryResult{}
+		result.phaseStats().Fds++
+		Expect(result.Stats.Phases).To(BeEmpty())
+	})
+
+})
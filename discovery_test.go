@@ -21,6 +21,16 @@ import (
 	. "github.com/onsi/gomega"
 )
 
+// testDecorator simply records the discovery results it was asked to
+// decorate.
+type testDecorator struct {
+	results []*DiscoveryResult
+}
+
+func (d *testDecorator) Decorate(result *DiscoveryResult) {
+	d.results = append(d.results, result)
+}
+
 var _ = Describe("Discover", func() {
 
 	It("discovers nothing unless told so", func() {
@@ -30,6 +40,17 @@ var _ = Describe("Discover", func() {
 		}
 	})
 
+	It("runs decorators", func() {
+		opts := NoDiscovery
+		opts.SkipProcs = false
+		opts.NamespaceTypes = species.CLONE_NEWNET
+		d := &testDecorator{}
+		opts.Decorators = []Decorator{d, d}
+		allns := Discover(opts)
+		Expect(d.results).To(HaveLen(2))
+		Expect(d.results[0]).To(BeIdenticalTo(allns))
+	})
+
 	It("sorts namespace maps", func() {
 		nsmap := NamespaceMap{
 			species.NamespaceID{Dev: 1, Ino: 5678}: NewNamespace(species.CLONE_NEWNET, species.NamespaceID{Dev: 1, Ino: 5678}, ""),
@@ -43,6 +43,76 @@ discovery. In order to implement this mechanism as painless as possible, process
 using lxkns need to call reexec.CheckAction() as early as possible from their
 main().
 
+Re-executed children get DefaultReexecTimeout time to finish their discovery,
+unless DiscoverOpts.ReexecTimeout says otherwise. Children failing to switch
+into other namespaces, failing in their discovery, or running late don't spoil
+the whole discovery; instead, their failures end up as *ReexecError in the
+discovery result's Diagnostics.
+
+Discovery runs in several phases, such as scanning the processes for
+namespaces of a particular type, or looking for bind-mounted namespaces. The
+time spent per phase, as well as the number of processes, file descriptors,
+re-executed children, and namespaces found, are recorded in the discovery
+result's Stats. Additionally, DiscoverOpts.BeforePhase and
+DiscoverOpts.AfterPhase hooks get called before and after each phase.
+
+Scoped Discovery
+
+Instead of discovering the namespaces of all processes, discovery can be
+scoped to only specific processes, optionally including their descendants,
+such as when only interested in a particular container.
+
+    opts := lxkns.FullDiscovery
+    opts.PIDs = []lxkns.PIDType{pid}
+    opts.WithDescendants = true
+    allns := lxkns.Discover(opts)
+
+A scoped discovery only finds the namespaces the scoped processes are joined
+to, the namespaces referenced by their open file descriptors, and the
+namespaces bind-mounted in their mount namespaces. However, the user and PID
+namespace hierarchies as well as the owning user namespaces are still
+completed, even if no scoped process is joined to them.
+
+Without descendants, discovery reads only the proc filesystem entries of the
+scoped processes. With descendants, discovery needs to scan all processes,
+so the scoped processes keep their Parent and Children pointers to processes
+outside the discovery result's process table, such as to the parent of a
+container's initial process.
+
+Custom Discoverers
+
+Namespaces might also be referenced from places lxkns doesn't know about out
+of the box, such as the namespace stores of container engines or checkpoint
+image directories. Custom Discoverer-s specified in DiscoverOpts.Discoverers
+run as additional discovery phases, either at the BeforeHierarchy or the
+BeforeOwnership stage. They add the namespaces they find using
+DiscoveryResult.AddNamespaceRef, or DiscoveryResult.AddNamespace when only
+knowing the namespace identifiers, so that the built-in discovery phases can
+then complete the hierarchy and ownership of the namespaces added.
+
+    func (d *myDiscoverer) Discover(result *lxkns.DiscoveryResult) {
+        for _, path := range d.paths {
+            if _, err := result.AddNamespaceRef(path); err != nil {
+                result.Diagnostics = append(result.Diagnostics, err)
+            }
+        }
+    }
+
+Offline Discovery
+
+Capture runs a discovery and additionally writes the process and namespace
+state found into a bundle, a tar archive with the proc filesystem files
+needed, as well as the namespace relations gathered by other means, such as
+namespace ioctl()s. DiscoverBundle later reproduces the discovery result from
+such a bundle, even on a different host.
+
+    f, _ := os.Create("lxkns-bundle.tar")
+    _, err := lxkns.Capture(f, lxkns.FullDiscovery)
+    f.Close()
+    ...
+    f, _ = os.Open("lxkns-bundle.tar")
+    allns, info, err := lxkns.DiscoverBundle(f, lxkns.FullDiscovery)
+
 Information Model, Base Level
 
 Not totally unexpectedly, the lxkns discovery information model at its most
@@ -133,6 +203,10 @@ particular namespace hierarchy.
         }
     }
 
+Decorators may also label the processes discovered, such as the systemd
+decorator labelling processes with the systemd units they belong to, see
+Process.Labels.
+
 Ownership
 
 User namespaces play the central role in controlling the access of processes to
@@ -172,6 +246,15 @@ When asking a user namespace for its owner, the parent user namespace is
 returned in accordance with the Linux ioctl()s for discovering the ownership of
 namespaces.
 
+Whether a process has a particular capability in a namespace depends on its
+effective capabilities, its user namespace, the user namespace owning the
+namespace, and the user namespace hierarchy in between. NsCapable applies the
+same rules as the Linux kernel's ns_capable() to processes discovered with
+DiscoverOpts.WithProcessStatus, and also returns the decision path taken.
+
+    check, _ := lxkns.NsCapable(proc, lxkns.CapabilityByName("CAP_NET_ADMIN"), netns)
+    println(check.Allowed, check.Reason.String())
+
 Namespaces and Processes
 
 The lxkns discovery information model also relates processes to namespaces, and
@@ -218,6 +301,110 @@ such system states.
         ...
     }
 
+To keep process discovery cheap, only the few process properties needed for
+namespace discovery are read by default. Setting DiscoverOpts.WithProcessStatus
+additionally reads the credentials, capabilities, seccomp mode, and the exe,
+cwd, and root links of all processes into Process.Status.
+
+    opts := lxkns.FullDiscovery
+    opts.WithProcessStatus = true
+    allns := lxkns.Discover(opts)
+    if allns.Processes[lxkns.PIDType(1)].Status.CapEff.Has(21) {
+        println("init has CAP_SYS_ADMIN")
+    }
+
+PIDs get reused over time, so they are unsuitable for identifying processes
+beyond a single discovery. Process.ID returns a ProcessID instead, which
+combines the PID with the process start time and the boot ID of the system;
+ProcessTable.ByID looks up processes by their identity. To make sure that
+follow-up operations such as Process.Signal hit exactly the processes
+discovered, DiscoverOpts.WithPIDFDs opens process file descriptors for all
+processes discovered.
+
+ProcessTable offers query helpers, such as ByName, ByCmdline, ByUID,
+InNamespace, SameNamespaces, Ancestors, and Descendants, all returning
+processes in a stable order. As the queries rely only on PIDs, PPIDs, and
+namespace identifiers, they work on deserialized discovery results too.
+
+    // Find all processes sharing the network namespace of init(1).
+    for _, proc := range allns.Processes.InNamespace(initprocess.Namespaces[lxkns.NetNS]) {
+        println(proc.Name)
+    }
+
+Walking
+
+Instead of following the hierarchy, ownership, and leader relations by hand,
+Walk traverses discovery results in depth-first order, starting from a set of
+root namespaces. The edges to follow are selected in the WalkOptions, and the
+optional pre- and post-order callbacks get the node visited, together with its
+depth, parent node, and the edge it was reached by. Returning SkipChildren
+from the pre-order callback prunes the walk below the current node.
+
+    // Print the user namespace hierarchy with the leader processes.
+    lxkns.Walk(allns.UserNSRoots, lxkns.WalkOptions{
+        Edges: lxkns.WalkChildren | lxkns.WalkLeaders,
+        Pre: func(node *lxkns.WalkNode) error {
+            indent := strings.Repeat("  ", node.Depth)
+            if node.Process != nil {
+                fmt.Printf("%s%s\n", indent, node.Process.Name)
+                return nil
+            }
+            fmt.Printf("%s%s\n", indent, node.Namespace.ID())
+            return nil
+        },
+    })
+
+Sandboxes
+
+Users tend to think in containers rather than in individual namespaces.
+The Sandboxes function groups processes joined to exactly the same set of
+namespaces into Sandbox-es, which usually correspond with containers.
+SharedNamespaces then reports the namespaces shared between sandboxes, such as
+the network namespace shared by the containers of a Kubernetes pod.
+
+    for _, sandbox := range lxkns.Sandboxes(allns.Processes) {
+        println(sandbox.Name, len(sandbox.Processes))
+    }
+
+Decorators
+
+Namespaces have no names, but users tend to think of them in terms of the
+containers or services they belong to. Decorators fill in this missing
+information from sources outside the Linux kernel, such as the state
+directories of container runtimes, and attach it as labels to the namespaces
+discovered. Decorators to run are specified in the discovery options:
+
+    opts := lxkns.FullDiscovery
+    opts.Decorators = []lxkns.Decorator{oci.NewDecorator()}
+    allns := lxkns.Discover(opts)
+    for _, ns := range allns.Namespaces[lxkns.NetNS] {
+        if id, ok := ns.Labels()[oci.ContainerIDLabel]; ok {
+            ...
+        }
+    }
+
+Actions
+
+Applications can run their own code inside other namespaces, such as reading
+configuration files inside the mount namespace of a container. Actions are
+registered with typed arguments and results before calling
+reexec.CheckAction(), and then run in a forked and re-executed child which has
+entered the namespaces; the results stream back while the action is running:
+
+    func init() {
+        lxkns.RegisterAction("read-config", func(path string, emit func([]byte) error) error {
+            data, err := ioutil.ReadFile(path)
+            if err != nil {
+                return err
+            }
+            return emit(data)
+        })
+    }
+
+    var configs [][]byte
+    err := lxkns.RunAction(ctx, "read-config", []lxkns.Namespace{userns, mntns},
+        "/etc/hostname", &configs)
+
 Architecture
 
 Please find more details about the lxkns information model in the architectural
@@ -17,13 +17,22 @@ package lxkns
 import (
 	"os"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	rxtst "github.com/thediveo/gons/reexec/testing"
 )
 
+// sleepyEnvVar tells a copy of the test binary started by some test to just
+// sleep, instead of running any tests.
+const sleepyEnvVar = "LXKNS_TEST_SLEEPY"
+
 func TestMain(m *testing.M) {
+	if os.Getenv(sleepyEnvVar) != "" {
+		time.Sleep(60 * time.Second)
+		os.Exit(0)
+	}
 	// Ensure that the registered handler is run in the re-executed child.
 	// This won't trigger the handler while we're in the parent. We're using
 	// gons' very special coverage profiling support for re-execution.
@@ -151,6 +151,10 @@ type Namespace interface {
 	// times from /proc/[PID]/stat. Me thinks, me has read too many Bernard
 	// Cornwell books. Wyrd bið ful aræd.
 	Ealdorman() *Process
+	// Labels returns the labels attached to this namespace by decorators,
+	// such as container identifiers and names. Labels map label names to
+	// their values; it returns nil if there are no labels attached.
+	Labels() map[string]string
 	// String describes this namespace with type, id, joined leader processes,
 	// and optionally information about owner, children, parent.
 	String() string
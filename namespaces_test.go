@@ -82,6 +82,15 @@ var _ = Describe("namespaces", func() {
 			Expect(pns.Ealdorman()).To(BeNil())
 		})
 
+		It("attaches labels", func() {
+			pns := &plainNamespace{}
+			Expect(pns.Labels()).To(BeNil())
+			pns.SetLabel("foo", "bar")
+			pns.SetLabel("foo", "baz")
+			pns.SetLabel("answer", "42")
+			Expect(pns.Labels()).To(Equal(map[string]string{"foo": "baz", "answer": "42"}))
+		})
+
 		It("lives with errors when detecting the owner", func() {
 			pns := &plainNamespace{}
 			Expect(func() { pns.DetectOwner(nil) }).NotTo(Panic())
@@ -149,6 +158,14 @@ var _ = Describe("namespaces", func() {
 				fmt.Sprintf(`UID %d ("%s")`, os.Geteuid(), u.Username)))
 		})
 
+		It("are parents with ownership", func() {
+			uns := NewNamespace(species.CLONE_NEWUSER, species.NamespaceID{Dev: 1, Ino: 1111}, "")
+			cuns := NewNamespace(species.CLONE_NEWUSER, species.NamespaceID{Dev: 1, Ino: 2222}, "")
+			uns.(HierarchyConfigurer).AddChild(cuns.(Hierarchy))
+			Expect(cuns.(Hierarchy).Parent()).To(BeIdenticalTo(uns))
+			Expect(cuns.(Hierarchy).Parent().(Ownership)).NotTo(BeNil())
+		})
+
 	})
 
 })
@@ -36,6 +36,7 @@ type plainNamespace struct {
 	owner     Ownership
 	ref       string
 	leaders   []*Process
+	labels    map[string]string
 }
 
 var _ Namespace = (*plainNamespace)(nil)
@@ -50,6 +51,7 @@ type NamespaceConfigurer interface {
 	DetectOwner(nsf *ops.NamespaceFile)    // detects owning user namespace id.
 	SetOwner(usernsid species.NamespaceID) // sets the owning user namespace id directly.
 	ResolveOwner(usernsmap NamespaceMap)   // resolves owner ns id into object reference.
+	SetLabel(name string, value string)    // attaches a label to this namespace.
 }
 
 // ID returns the namespace identifier. This identifier is basically a tuple
@@ -112,6 +114,10 @@ func (pns *plainNamespace) LeaderPIDs() []PIDType {
 	return pids
 }
 
+// Labels returns the labels attached to this namespace by decorators. It
+// returns nil if there are no labels attached.
+func (pns *plainNamespace) Labels() map[string]string { return pns.labels }
+
 // String describes this instance of a non-hierarchical ("plain") Linux kernel
 // namespace.
 func (pns *plainNamespace) String() string {
@@ -164,6 +170,15 @@ func (pns *plainNamespace) SetRef(ref string) {
 	pns.ref = ref
 }
 
+// SetLabel attaches a label with the specified name and value to this
+// namespace, replacing any existing label of the same name.
+func (pns *plainNamespace) SetLabel(name string, value string) {
+	if pns.labels == nil {
+		pns.labels = map[string]string{}
+	}
+	pns.labels[name] = value
+}
+
 // DetectOwner gets the ownering user namespace id from Linux, and stores it for
 // later resolution, after when we have a complete map of all user namespaces.
 func (pns *plainNamespace) DetectOwner(nsf *ops.NamespaceFile) {
@@ -185,6 +200,12 @@ func (pns *plainNamespace) SetOwner(usernsid species.NamespaceID) {
 	pns.ownernsid = usernsid
 }
 
+// ownerID returns the namespace ID of the user namespace owning this
+// namespace, as far as known.
+func (pns *plainNamespace) ownerID() species.NamespaceID {
+	return pns.ownernsid
+}
+
 // ResolveOwner sets the owning user namespace reference based on the owning
 // user namespace id discovered earlier.
 func (pns *plainNamespace) ResolveOwner(usernsmap NamespaceMap) {
@@ -84,3 +84,12 @@ func (uns *userNamespace) detectUID(nsf *ops.NamespaceFile) {
 func (uns *userNamespace) ResolveOwner(usernsmap NamespaceMap) {
 	uns.resolveOwner(uns, usernsmap)
 }
+
+// AddChild adds a child user namespace to this (parent) user namespace. Same
+// as with ResolveOwner, we need to override the embedded implementation, so
+// that the child gets the correct instance pointer as its parent, and not a
+// pointer to an embedded instance, which lacks the Ownership interface.
+func (uns *userNamespace) AddChild(child Hierarchy) {
+	child.(HierarchyConfigurer).SetParent(uns)
+	uns.children = append(uns.children, child)
+}
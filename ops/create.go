@@ -0,0 +1,249 @@
+// Creating new namespaces and persisting them in the filesystem.
+
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/thediveo/lxkns/species"
+	"golang.org/x/sys/unix"
+)
+
+// Operation names for creating and persisting namespaces, as reported in
+// NamespaceOperationErrors.
+const (
+	OpUnshare = "unshare"
+	OpClone   = "clone"
+	OpMount   = "mount"
+	OpUnmount = "umount"
+)
+
+// holder is a re-executed child process holding on to the new namespaces it
+// has been created in. In particular, the holder is the init process of a new
+// PID namespace, so the PID namespace stays usable only as long as its holder
+// is alive: as soon as the init process of a PID namespace terminates, no new
+// processes can be created in it anymore.
+type holder struct {
+	mu    sync.Mutex
+	refs  int            // number of references keeping the holder alive.
+	child *exec.Cmd      // the holder child process.
+	stdin io.WriteCloser // closing stdin tells the holder to terminate.
+}
+
+// acquire keeps the holder alive until a matching release.
+func (h *holder) acquire() {
+	h.mu.Lock()
+	h.refs++
+	h.mu.Unlock()
+}
+
+// release terminates the holder after the last reference to it has been
+// released, and then reaps it.
+func (h *holder) release() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.refs--; h.refs > 0 {
+		return
+	}
+	h.stdin.Close()
+	_ = h.child.Wait()
+}
+
+// persistedHolders maps the paths of persisted PID namespaces to the holders
+// of these namespaces, so Unpersist can release them again.
+var persistedHolders = struct {
+	sync.Mutex
+	m map[string]*holder
+}{m: map[string]*holder{}}
+
+// NewNamespace creates a new namespace of the specified type, such as
+// species.CLONE_NEWNET, and returns a NamespaceFile referencing it. The new
+// namespace stays alive as long as the NamespaceFile is kept open, or it has
+// been persisted using Persist().
+//
+// Network, IPC, UTS, cgroup, and mount namespaces are created using a
+// throw-away OS thread, which gets destroyed afterwards. As multi-threaded
+// processes cannot create new user namespaces, and as new PID namespaces only
+// apply to child processes, NewNamespace creates user and PID namespaces by
+// re-executing the current process as a child process created in the new
+// namespace. This re-executed child runs a gons/reexec action instead of the
+// application, so applications need to call reexec.CheckAction() as early as
+// possible in their main()s, and have to be built with cgo. For a new PID
+// namespace, this child is its init process, which reaps orphaned processes
+// and is kept alive until the returned NamespaceFile has been closed and the
+// namespace has been unpersisted, if persisted before. When the init process
+// terminates, the Linux kernel kills all processes in the PID namespace.
+func NewNamespace(nstype species.NamespaceType) (*NamespaceFile, error) {
+	switch nstype {
+	case species.CLONE_NEWNET, species.CLONE_NEWIPC, species.CLONE_NEWUTS,
+		species.CLONE_NEWCGROUP, species.CLONE_NEWNS:
+		return unshareNamespace(nstype)
+	case species.CLONE_NEWUSER, species.CLONE_NEWPID:
+		return cloneNamespace(nstype)
+	}
+	return nil, fmt.Errorf("cannot create namespace of unknown type %s", nstype.String())
+}
+
+// unshareNamespace creates a new namespace of the specified type using a
+// locked OS thread, which is then thrown away.
+func unshareNamespace(nstype species.NamespaceType) (*NamespaceFile, error) {
+	type created struct {
+		nsf *NamespaceFile
+		err error
+	}
+	done := make(chan created)
+	go func() {
+		// Lock, but never unlock the OS thread exclusively powering our Go
+		// routine, so the Go runtime will throw it away after we're done
+		// with it, instead of reusing this thread in a new namespace.
+		runtime.LockOSThread()
+		if err := unix.Unshare(int(nstype)); err != nil {
+			done <- created{err: newNamespaceOperationError(OpUnshare, nstype.Name(), err)}
+			return
+		}
+		nsf, err := openNamespaceFile(
+			fmt.Sprintf("/proc/self/task/%d/ns/%s", unix.Gettid(), nstype.Name()))
+		done <- created{nsf: nsf, err: err}
+	}()
+	c := <-done
+	return c.nsf, c.err
+}
+
+// cloneNamespace creates a new namespace of the specified type by
+// re-executing this process as a new child process created in the new
+// namespace. Only for PID namespaces the child is kept alive, until the
+// returned NamespaceFile has been closed.
+func cloneNamespace(nstype species.NamespaceType) (*NamespaceFile, error) {
+	child, err := holderCommand(nstype)
+	if err != nil {
+		return nil, newNamespaceOperationError(OpClone, nstype.Name(), err)
+	}
+	stdin, err := child.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := child.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := child.Start(); err != nil {
+		return nil, newNamespaceOperationError(OpClone, nstype.Name(), err)
+	}
+	h := &holder{refs: 1, child: child, stdin: stdin}
+	// Wait for the child to become ready, so we know that it is up and
+	// running in its new namespace.
+	if _, err := stdout.Read(make([]byte, 1)); err != nil {
+		h.release()
+		return nil, fmt.Errorf("re-executed child failed to hold new %s namespace: %s",
+			nstype.Name(), err.Error())
+	}
+	nsf, err := openNamespaceFile(fmt.Sprintf("/proc/%d/ns/%s", child.Process.Pid, nstype.Name()))
+	if err != nil || nstype != species.CLONE_NEWPID {
+		// Releasing the child by closing its stdin; as we now have an open
+		// file descriptor referencing the new namespace, the namespace stays
+		// alive without the child.
+		h.release()
+		return nsf, err
+	}
+	nsf.holder = h
+	return nsf, nil
+}
+
+// openNamespaceFile opens the namespace at path, returning a NamespaceFile or
+// a NamespaceOperationError.
+func openNamespaceFile(path string) (*NamespaceFile, error) {
+	nsf, err := NewNamespaceFile(os.Open(path))
+	if err != nil {
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			err = pathErr.Err
+		}
+		return nil, newNamespaceOperationError(OpOpen, path, err)
+	}
+	return nsf, nil
+}
+
+// Persist bind-mounts the referenced namespace onto the specified path, so
+// that the namespace stays alive even without any processes attached to it or
+// open file descriptors referencing it, similar to "ip netns add". If the
+// path doesn't exist yet, then Persist creates it as an empty file, as well
+// as any missing parent directories.
+//
+// Please note that a mount namespace can only be persisted in a mount
+// namespace created before it, and not in the persisted mount namespace
+// itself. Additionally, the path must not be located on a mount with shared
+// propagation.
+func Persist(nsref Referrer, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 0444)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	fd, close, err := nsref.Reference()
+	if err != nil {
+		return err
+	}
+	if close {
+		defer unix.Close(fd)
+	}
+	defer runtime.KeepAlive(nsref)
+	if err := unix.Mount(fmt.Sprintf("/proc/self/fd/%d", fd), path, "none", unix.MS_BIND, ""); err != nil {
+		return newNamespaceOperationError(OpMount, path, err)
+	}
+	// Keep the init process of a PID namespace created by NewNamespace alive
+	// while the PID namespace is persisted.
+	if nsf, ok := nsref.(*NamespaceFile); ok && nsf.holder != nil {
+		nsf.holder.acquire()
+		persistedHolders.Lock()
+		previous := persistedHolders.m[filepath.Clean(path)]
+		persistedHolders.m[filepath.Clean(path)] = nsf.holder
+		persistedHolders.Unlock()
+		if previous != nil {
+			previous.release()
+		}
+	}
+	return nil
+}
+
+// Unpersist unmounts a namespace persisted at the specified path and then
+// removes the then-empty path. If no other references to the namespace exist
+// anymore, then the namespace gets destroyed. For a PID namespace created
+// using NewNamespace, its init process gets terminated when the PID namespace
+// has been unpersisted and its NamespaceFile has been closed.
+func Unpersist(path string) error {
+	if err := unix.Unmount(path, unix.MNT_DETACH); err != nil {
+		return newNamespaceOperationError(OpUnmount, path, err)
+	}
+	persistedHolders.Lock()
+	h := persistedHolders.m[filepath.Clean(path)]
+	delete(persistedHolders.m, filepath.Clean(path))
+	persistedHolders.Unlock()
+	if h != nil {
+		h.release()
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,138 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thediveo/lxkns/species"
+)
+
+// forkedPIDNS forks a process into the referenced PID namespace and returns
+// the ID of the PID namespace the process actually ended up in.
+func forkedPIDNS(pidns Referrer) (interface{}, error) {
+	return Execute(func() interface{} {
+		sleepy := exec.Command("sleep", "10")
+		if err := sleepy.Start(); err != nil {
+			return err
+		}
+		defer func() {
+			_ = sleepy.Process.Kill()
+			_ = sleepy.Wait()
+		}()
+		id, err := NamespacePath(fmt.Sprintf("/proc/%d/ns/pid", sleepy.Process.Pid)).ID()
+		if err != nil {
+			return err
+		}
+		return id
+	}, pidns)
+}
+
+var _ = Describe("Creating Namespaces", func() {
+
+	BeforeEach(func() {
+		if os.Geteuid() != 0 {
+			Skip("needs root")
+		}
+	})
+
+	It("creates namespaces", func() {
+		for _, nstype := range []species.NamespaceType{
+			species.CLONE_NEWNET, species.CLONE_NEWIPC, species.CLONE_NEWUTS,
+			species.CLONE_NEWCGROUP, species.CLONE_NEWNS, species.CLONE_NEWUSER,
+			species.CLONE_NEWPID,
+		} {
+			nsf, err := NewNamespace(nstype)
+			Expect(err).NotTo(HaveOccurred(), nstype.Name())
+			Expect(nsf.Type()).To(Equal(nstype))
+			ownnsid, _ := NamespacePath("/proc/self/ns/" + nstype.Name()).ID()
+			Expect(nsf.ID()).NotTo(Equal(ownnsid), nstype.Name())
+			nsf.Close()
+		}
+		_, err := NewNamespace(species.NaNS)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("persists namespaces", func() {
+		tmpdir, err := ioutil.TempDir("", "lxkns-ops-")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(tmpdir)
+		path := filepath.Join(tmpdir, "netns", "foo")
+
+		nsf, err := NewNamespace(species.CLONE_NEWNET)
+		Expect(err).NotTo(HaveOccurred())
+		netnsid, _ := nsf.ID()
+		Expect(Persist(nsf, path)).To(Succeed())
+		nsf.Close()
+
+		Expect(NamespacePath(path).ID()).To(Equal(netnsid))
+		Expect(Execute(func() interface{} {
+			id, _ := NamespacePath("/proc/thread-self/ns/net").ID()
+			return id
+		}, NamespacePath(path))).To(Equal(netnsid))
+
+		Expect(Unpersist(path)).To(Succeed())
+		Expect(path).NotTo(BeAnExistingFile())
+		Expect(Unpersist(path)).NotTo(Succeed())
+	})
+
+	It("keeps new PID namespaces alive", func() {
+		pidns, err := NewNamespace(species.CLONE_NEWPID)
+		Expect(err).NotTo(HaveOccurred())
+		holder := pidns.holder
+		Expect(holder).NotTo(BeNil())
+		pidnsid, _ := pidns.ID()
+		Expect(forkedPIDNS(pidns)).To(Equal(pidnsid))
+
+		tmpdir, err := ioutil.TempDir("", "lxkns-ops-")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(tmpdir)
+		path := filepath.Join(tmpdir, "pidns")
+		Expect(Persist(pidns, path)).To(Succeed())
+		Expect(pidns.Close()).To(Succeed())
+		Expect(pidns.Close()).NotTo(Succeed())
+		Expect(forkedPIDNS(NamespacePath(path))).To(Equal(pidnsid))
+
+		Expect(Unpersist(path)).To(Succeed())
+		Expect(holder.child.ProcessState).NotTo(BeNil())
+		Expect(holder.child.ProcessState.Exited()).To(BeTrue())
+	})
+
+	It("reaps orphans in new PID namespaces", func() {
+		pidns, err := NewNamespace(species.CLONE_NEWPID)
+		Expect(err).NotTo(HaveOccurred())
+		defer pidns.Close()
+		holderpid := pidns.holder.child.Process.Pid
+		// The shell terminates immediately, orphaning its sleeping child,
+		// which then gets reparented to the holder as the init process of
+		// the PID namespace.
+		Expect(Execute(func() interface{} {
+			return exec.Command("sh", "-c", "sleep 0.5 &").Run()
+		}, pidns)).To(BeNil())
+		children := func() string {
+			c, _ := ioutil.ReadFile(fmt.Sprintf("/proc/%d/task/%d/children", holderpid, holderpid))
+			return string(c)
+		}
+		Eventually(children).ShouldNot(BeEmpty())
+		Eventually(children, "2s").Should(BeEmpty())
+	})
+
+})
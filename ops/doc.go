@@ -24,6 +24,16 @@ ID query):
     * OwnerUID() returns the UID of the owner of the referenced namespace.
     * Type() returns the type of referenced namespace; CLONE_NEWNS, ...
 
+For user and PID namespaces, which form hierarchies, the following functions
+navigate the hierarchy of a referenced namespace, taking care of opening and
+closing the file descriptors referencing the intermediate namespaces:
+
+    * Ancestors() returns the IDs of all ancestor namespaces.
+    * Depth() returns the depth of a namespace in its hierarchy.
+    * IsAncestorOf() checks whether a namespace is an ancestor of another one.
+    * CommonAncestor() returns the lowest common ancestor of two namespaces.
+    * WalkAncestors() calls a function for each ancestor namespace.
+
 NamespacePath and NamespaceFd can be easily converted from or to string and
 uintptr respectively.
 
@@ -57,6 +67,19 @@ struct instead of a pointer to it we mimic the original handling as close as
 possible, avoiding situations where a non-nil NamespaceFile points to a nil
 *os.File.
 
+Errors
+
+Failing namespace operations return NamespaceOperationErrors, which tell the
+operation that failed (such as "NS_GET_PARENT" or "setns"), the namespace
+reference, and the underlying error, usually a syscall.Errno. Instead of
+interpreting errnos themselves, callers should use errors.Is() with the
+sentinel errors ErrNoParent, ErrNotANamespace, and ErrPermission:
+
+    parent, err := ops.NamespacePath("/proc/self/ns/pid").Parent()
+    if errors.Is(err, ops.ErrNoParent) {
+        // initial PID namespace, or parent out of reach.
+    }
+
 Switching Namespaces
 
 Switching namespaces is a slightly messy business in Golang: it is subject to
@@ -94,6 +117,54 @@ throw-away Go routine, so the Golang runtime can easily throw away the tainted
 OS thread which is locked to it afterwards. Sometimes, throwing things away is
 much cleaner (and not only for certain types of PPE).
 
+Execute() runs a function synchronously in the specified namespace(s),
+returning the function's result. In order to not wait forever for a function
+which might hang, such as when talking to an unresponsive service in another
+network namespace, ExecuteContext() and GoContext() additionally accept a
+context. When the context's deadline expires they return a TimeoutError, and
+when the context gets cancelled they return the context's error instead.
+
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    result, err := ops.ExecuteContext(ctx, func() interface{} {
+        return ...
+    }, netns)
+
+To join several namespaces of the same process, ProcessNamespaces references
+these namespaces based on a pidfd, which is immune to PID reuse (Linux kernel
+5.3+). Go() and Execute() then join the namespaces of the process in a single
+atomic setns(2) call on Linux kernels 5.8 and later, and otherwise fall back to
+joining the namespaces individually via their /proc/[PID]/ns/... paths.
+
+    procns, err := ops.NewProcessNamespaces(pid,
+        species.CLONE_NEWNET|species.CLONE_NEWUTS)
+    if err == nil {
+        defer procns.Close()
+        err = ops.Go(func() { ... }, procns)
+    }
+
+In case a function needs to run synchronously on the current Go routine, such
+as when running several functions one after another in a foreign namespace,
+Visit() locks the current OS thread, switches it into the specified namespaces,
+calls the function, and finally switches the thread back into its original
+namespaces before unlocking it.
+
+    err := ops.Visit(func() {
+        fmt.Println("Nobody expects the Spanish Inquisition!")
+    }, netns)
+    if err != nil {
+        ...
+    }
+
+However, Visit() only supports namespace types which a thread can safely leave
+again: these are network, IPC, UTS, and cgroup namespaces. Mount and user
+namespaces cannot be switched anymore after the Golang runtime has started,
+and switching PID (and time) namespaces affects only child processes and cannot
+be undone. Visit() thus rejects these namespace types without switching any
+namespaces. Should switching back fail, then Visit() panics, keeping the
+tainted OS thread locked to its Go routine, so it gets thrown away when the Go
+routine terminates.
+
 If a Golang process needs to switch mount, PID, and user namespaces, we
 recommend using the gons package https://github.com/thediveo/gons in combination
 with its reexec subpackage (gons provide namespace switching before the Golang
@@ -101,6 +172,36 @@ runtime starts, while reexec forks a Golang process and reexecutes it, with the
 reexecuted child then runnining a specific function only in the specified
 namespaces).
 
+Creating and Persisting Namespaces
+
+NewNamespace() creates a new namespace of a given type and returns a
+NamespaceFile referencing it, which can be directly used with Go(), Execute(),
+et cetera. Persist() then bind-mounts a namespace onto a path in the
+filesystem, such as "/run/netns/foo", keeping it alive even after the
+NamespaceFile has been closed; lxkns discoveries then find it as a
+bind-mounted namespace. Unpersist() removes such a bind-mounted namespace
+again.
+
+    netns, err := ops.NewNamespace(species.CLONE_NEWNET)
+    if err == nil {
+        err = ops.Persist(netns, "/run/netns/foo")
+        netns.Close()
+    }
+    // ...
+    ops.Unpersist("/run/netns/foo")
+
+Please note that new user and PID namespaces can only be created by creating
+a new child process in them. NewNamespace thus re-executes the application,
+with the re-executed child running a gons/reexec action instead of the
+application's main(). Applications thus must call reexec.CheckAction() as
+early as possible in their main()s, and need to be built with cgo. For a new
+PID namespace, this child is the namespace's init process, which reaps any
+orphaned processes in its namespace and is kept alive until the
+NamespaceFile has been closed and the namespace has been unpersisted again
+(if persisted before). When the init process terminates, the Linux kernel
+kills all processes in the PID namespace and no new processes can be created
+in it anymore.
+
 Namespace IDs
 
 This package works with namespace identifiers in the form of tuples made from
@@ -0,0 +1,111 @@
+// Typed errors for namespace operations.
+
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// Sentinel errors for use with errors.Is() in order to check for typical
+// reasons of failed namespace operations.
+var (
+	// ErrNoParent indicates that a namespace has no parent namespace: either
+	// it is an initial namespace, the parent namespace is outside the
+	// caller's namespace scope, or the namespace isn't hierarchical at all.
+	ErrNoParent = errors.New("no parent namespace")
+	// ErrNotANamespace indicates that a reference doesn't reference a
+	// namespace, but some other file.
+	ErrNotANamespace = errors.New("not a namespace")
+	// ErrPermission indicates that the caller lacks the privileges for a
+	// namespace operation, or that a namespace is outside the caller's
+	// namespace scope.
+	ErrPermission = errors.New("permission denied")
+)
+
+// Names of the namespace operations reported in NamespaceOperationErrors.
+const (
+	OpOpen            = "open"
+	OpStat            = "stat"
+	OpSetns           = "setns"
+	OpNsGetUserns     = "NS_GET_USERNS"
+	OpNsGetParent     = "NS_GET_PARENT"
+	OpNsGetNstype     = "NS_GET_NSTYPE"
+	OpNsGetOwnerUID   = "NS_GET_OWNER_UID"
+	OpPidfdOpen       = "pidfd_open"
+	OpPidfdSendSignal = "pidfd_send_signal"
+)
+
+// NamespaceOperationError describes a failed operation on a namespace
+// reference, such as querying the parent of a namespace, or switching into a
+// namespace. Use errors.Is() with ErrNoParent, ErrNotANamespace, and
+// ErrPermission to check for typical reasons, or errors.As() in order to get
+// the underlying syscall.Errno.
+type NamespaceOperationError struct {
+	Op  string // operation, such as "NS_GET_PARENT" or "setns".
+	Ref string // textual namespace reference, such as a path or "fd 42".
+	Err error  // underlying error, usually a syscall.Errno.
+}
+
+// Error returns a textual description of this namespace operation error.
+func (e *NamespaceOperationError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.Op, e.Ref, e.Err.Error())
+}
+
+// Unwrap returns the underlying error, usually a syscall.Errno.
+func (e *NamespaceOperationError) Unwrap() error {
+	return e.Err
+}
+
+// Is returns true if the specified target is one of the sentinel errors
+// matching the operation and errno of this namespace operation error.
+func (e *NamespaceOperationError) Is(target error) bool {
+	var errno unix.Errno
+	if !errors.As(e.Err, &errno) {
+		return false
+	}
+	switch target {
+	case ErrNoParent:
+		// See ioctl_ns(2): EPERM when asking for the parent of an initial
+		// namespace or when the parent is outside the caller's namespace
+		// scope, and EINVAL for non-hierarchical namespaces.
+		return e.Op == OpNsGetParent && (errno == unix.EPERM || errno == unix.EINVAL)
+	case ErrNotANamespace:
+		return errno == unix.ENOTTY || (errno == unix.EINVAL && e.Op == OpSetns)
+	case ErrPermission:
+		return e.Op != OpNsGetParent && (errno == unix.EPERM || errno == unix.EACCES)
+	}
+	return false
+}
+
+// newNamespaceOperationError returns a new NamespaceOperationError for the
+// specified operation, namespace reference, and error; if err is nil, then
+// nil is returned instead.
+func newNamespaceOperationError(op string, ref string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &NamespaceOperationError{Op: op, Ref: ref, Err: err}
+}
+
+// fdRef returns the textual reference for a namespace referenced by an open
+// file descriptor.
+func fdRef(fd int) string {
+	return fmt.Sprintf("fd %d", fd)
+}
@@ -0,0 +1,75 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/sys/unix"
+)
+
+var _ = Describe("Namespace Operation Errors", func() {
+
+	It("reports operation, reference, and errno", func() {
+		_, err := NamespacePath("/foobar").Type()
+		Expect(err).To(HaveOccurred())
+		var nserr *NamespaceOperationError
+		Expect(errors.As(err, &nserr)).To(BeTrue())
+		Expect(nserr.Op).To(Equal(OpOpen))
+		Expect(nserr.Ref).To(Equal("/foobar"))
+		Expect(errors.Is(err, unix.ENOENT)).To(BeTrue())
+		Expect(err.Error()).To(Equal("open /foobar: no such file or directory"))
+
+		_, err = NamespaceFd(-1).ID()
+		Expect(errors.As(err, &nserr)).To(BeTrue())
+		Expect(nserr.Op).To(Equal(OpStat))
+		Expect(nserr.Ref).To(Equal("fd -1"))
+	})
+
+	It("detects references to non-namespaces", func() {
+		_, err := NamespacePath("/").User()
+		Expect(errors.Is(err, ErrNotANamespace)).To(BeTrue())
+		Expect(errors.Is(err, ErrNoParent)).To(BeFalse())
+		Expect(errors.Is(err, ErrPermission)).To(BeFalse())
+	})
+
+	It("detects missing parents", func() {
+		_, err := NamespacePath("/proc/self/ns/net").Parent()
+		Expect(err).To(HaveOccurred())
+		Expect(errors.Is(err, ErrNoParent)).To(BeTrue())
+		Expect(errors.Is(err, ErrNotANamespace)).To(BeFalse())
+
+		Expect(errors.Is(&NamespaceOperationError{
+			Op: OpNsGetParent, Ref: "/proc/1/ns/user", Err: unix.EPERM,
+		}, ErrNoParent)).To(BeTrue())
+		Expect(errors.Is(&NamespaceOperationError{
+			Op: OpNsGetParent, Ref: "/proc/1/ns/user", Err: unix.EPERM,
+		}, ErrPermission)).To(BeFalse())
+	})
+
+	It("detects insufficient privileges", func() {
+		for _, errno := range []unix.Errno{unix.EPERM, unix.EACCES} {
+			err := &NamespaceOperationError{Op: OpSetns, Ref: "fd 42", Err: errno}
+			Expect(errors.Is(err, ErrPermission)).To(BeTrue())
+			Expect(errors.Is(err, ErrNoParent)).To(BeFalse())
+		}
+		Expect(errors.Is(&NamespaceOperationError{
+			Op: OpSetns, Ref: "fd 42", Err: errors.New("D'oh!"),
+		}, ErrPermission)).To(BeFalse())
+	})
+
+})
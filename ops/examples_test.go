@@ -50,3 +50,12 @@ func Example_type() {
 	// 0x20000000
 	// CLONE_NEWPID
 }
+
+func ExampleVisit() {
+	netns := NamespacePath("/proc/self/ns/net")
+	if err := Visit(func() {
+		fmt.Println("Nobody expects the Spanish Inquisition!")
+	}, netns); err != nil {
+		fmt.Println("cannot visit:", err.Error())
+	}
+}
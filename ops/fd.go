@@ -29,7 +29,7 @@ type NamespaceFd int
 // file descriptor. Please note that a Linux kernel version 4.11 or later is
 // required.
 func (nsfd NamespaceFd) Type() (species.NamespaceType, error) {
-	t, err := ioctl(int(nsfd), _NS_GET_NSTYPE)
+	t, err := ioctl(int(nsfd), NS_GET_NSTYPE, fdRef(int(nsfd)))
 	return species.NamespaceType(t), err
 }
 
@@ -38,7 +38,7 @@ func (nsfd NamespaceFd) Type() (species.NamespaceType, error) {
 // even returns an inode number if the file descriptor doesn't reference a
 // namespace but instead some other open file.
 func (nsfd NamespaceFd) ID() (species.NamespaceID, error) {
-	return fdID(int(nsfd))
+	return fdID(int(nsfd), fdRef(int(nsfd)))
 }
 
 // User returns the owning user namespace the namespace referenced by this open
@@ -46,7 +46,7 @@ func (nsfd NamespaceFd) ID() (species.NamespaceID, error) {
 // NamespaceFile reference. For user namespaces, User() behaves identical to
 // Parent(). A Linux kernel version 4.9 or later is required.
 func (nsfd NamespaceFd) User() (*NamespaceFile, error) {
-	return namespaceFileFromFd(ioctl(int(nsfd), _NS_GET_USERNS))
+	return namespaceFileFromFd(ioctl(int(nsfd), NS_GET_USERNS, fdRef(int(nsfd))))
 }
 
 // Parent returns the parent namespace of the Linux-kernel namespace referenced
@@ -54,25 +54,25 @@ func (nsfd NamespaceFd) User() (*NamespaceFile, error) {
 // PID or user. For user namespaces, Parent() and User() behave identical. A
 // Linux kernel version 4.9 or later is required.
 func (nsfd NamespaceFd) Parent() (*NamespaceFile, error) {
-	return namespaceFileFromFd(ioctl(int(nsfd), _NS_GET_PARENT))
+	return namespaceFileFromFd(ioctl(int(nsfd), NS_GET_PARENT, fdRef(int(nsfd))))
 }
 
 // OwnerUID returns the user id (UID) of the user namespace referenced by this
 // open file descriptor. A Linux kernel version 4.11 or later is required.
 func (nsfd NamespaceFd) OwnerUID() (int, error) {
-	return ownerUID(int(nsfd))
+	return ownerUID(int(nsfd), fdRef(int(nsfd)))
 }
 
 // fdID stats the given file descriptor in order to get the dev and inode
 // numbers, and returns it as a NamespaceID. This is an internal convenience
 // function to avoid duplicate code and is used also by the NamespaceFile and
 // NamespacePath reference types.
-func fdID(fd int) (species.NamespaceID, error) {
+func fdID(fd int, ref string) (species.NamespaceID, error) {
 	var stat unix.Stat_t
 	if err := unix.Fstat(fd, &stat); err != nil {
-		return species.NoneID, err
+		return species.NoneID, newNamespaceOperationError(OpStat, ref, err)
 	}
-	return species.NamespaceID{Dev: stat.Dev, Ino: stat.Ino}, nil
+	return species.NamespaceID{Dev: uint64(stat.Dev), Ino: uint64(stat.Ino)}, nil
 }
 
 // Ensures that NamespaceFd implements the Relation interface.
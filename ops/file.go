@@ -31,6 +31,10 @@ type NamespaceFile struct {
 	// indirection in mind, we simply skip yet another level of indirection,
 	// hopefully reducing pointer chasing.
 	os.File
+	// holder optionally is the init process of a new PID namespace created
+	// by NewNamespace, which needs to be kept alive while the PID namespace
+	// is still in use.
+	holder *holder
 }
 
 // NewNamespaceFile returns a new NamespaceFile given an *os.File and a nil
@@ -38,42 +42,64 @@ type NamespaceFile struct {
 // *NamespaceFile instead, together with the error.
 func NewNamespaceFile(f *os.File, err error) (*NamespaceFile, error) {
 	if err == nil && f != nil {
-		return &NamespaceFile{*f}, nil
+		return &NamespaceFile{File: *f}, nil
 	}
 	return nil, err
 }
 
+// Close closes the namespace file. For a PID namespace created using
+// NewNamespace, this also terminates its init process, unless the PID
+// namespace has been persisted.
+func (nsf *NamespaceFile) Close() error {
+	err := nsf.File.Close()
+	if nsf.holder != nil {
+		nsf.holder.release()
+		nsf.holder = nil
+	}
+	return err
+}
+
 // Type returns the type of the Linux-kernel namespace referenced by this open
 // file. Please note that a Linux kernel version 4.11 or later is required.
 func (nsf NamespaceFile) Type() (species.NamespaceType, error) {
-	t, err := ioctl(int(nsf.Fd()), _NS_GET_NSTYPE)
+	t, err := ioctl(int(nsf.Fd()), NS_GET_NSTYPE, nsf.ref())
 	return species.NamespaceType(t), err
 }
 
 // ID returns the namespace ID in form of its inode number for any given
 // Linux kernel namespace reference.
 func (nsf NamespaceFile) ID() (species.NamespaceID, error) {
-	return fdID(int(nsf.Fd()))
+	return fdID(int(nsf.Fd()), nsf.ref())
 }
 
 // User returns the owning user namespace of any namespace, as a NamespaceFile
 // reference. For user namespaces, User() behaves identical to Parent(). A Linux
 // kernel version 4.9 or later is required.
 func (nsf NamespaceFile) User() (*NamespaceFile, error) {
-	return namespaceFileFromFd(ioctl(int(nsf.Fd()), _NS_GET_USERNS))
+	return namespaceFileFromFd(ioctl(int(nsf.Fd()), NS_GET_USERNS, nsf.ref()))
 }
 
 // Parent returns the parent namespace of a hierarchical namespaces, that is, of
 // PID and user namespaces. For user namespaces, Parent() and User() behave
 // identical. A Linux kernel version 4.9 or later is required.
 func (nsf NamespaceFile) Parent() (*NamespaceFile, error) {
-	return namespaceFileFromFd(ioctl(int(nsf.Fd()), _NS_GET_PARENT))
+	return namespaceFileFromFd(ioctl(int(nsf.Fd()), NS_GET_PARENT, nsf.ref()))
 }
 
 // OwnerUID returns the user id (UID) of the user namespace referenced by this
 // open file descriptor. A Linux kernel version 4.11 or later is required.
 func (nsf NamespaceFile) OwnerUID() (int, error) {
-	return ownerUID(int(nsf.Fd()))
+	return ownerUID(int(nsf.Fd()), nsf.ref())
+}
+
+// ref returns a textual reference to the namespace referenced by this open
+// file, for use in error messages: this is either the file name, or otherwise
+// the file descriptor number.
+func (nsf NamespaceFile) ref() string {
+	if name := nsf.Name(); name != "" {
+		return name
+	}
+	return fdRef(int(nsf.Fd()))
 }
 
 // Internal convenience helper which takes a file descriptor and an error,
@@ -83,7 +109,7 @@ func namespaceFileFromFd(fd uint, err error) (*NamespaceFile, error) {
 		return nil, err
 	}
 	if f := os.NewFile(uintptr(fd), ""); f != nil {
-		return &NamespaceFile{*f}, nil
+		return &NamespaceFile{File: *f}, nil
 	}
 	return nil, errors.New("nil namespace file descriptor")
 }
@@ -0,0 +1,207 @@
+// Navigating the hierarchies of user and PID namespaces.
+
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/thediveo/lxkns/species"
+	"golang.org/x/sys/unix"
+)
+
+// WalkAncestors calls the specified function for each ancestor of the
+// referenced user or PID namespace, starting with its parent and climbing up
+// the hierarchy until either the topmost ancestor visible to the caller has
+// been reached, or the function returns false. The ancestor NamespaceFile
+// passed to the function is only valid during the call, as WalkAncestors
+// takes care of closing it afterwards; use Parent() on the ancestor in order
+// to keep a reference beyond the call.
+func WalkAncestors(r Relation, fn func(ancestor *NamespaceFile) bool) error {
+	if err := hierarchical(r); err != nil {
+		return err
+	}
+	ancestor, err := r.Parent()
+	if errors.Is(err, unix.EINVAL) {
+		// Without NS_GET_NSTYPE, hierarchical() might have let through a
+		// non-hierarchical namespace, which NS_GET_PARENT now rejects.
+		return fmt.Errorf("namespace is not hierarchical: %w", err)
+	}
+	for {
+		if err != nil {
+			if errors.Is(err, ErrNoParent) {
+				// We've reached the end of the line, as far as we can see.
+				return nil
+			}
+			return err
+		}
+		if !fn(ancestor) {
+			ancestor.Close()
+			return nil
+		}
+		var parent *NamespaceFile
+		parent, err = ancestor.Parent()
+		ancestor.Close()
+		ancestor = parent
+	}
+}
+
+// Ancestors returns the IDs of the ancestors of the referenced user or PID
+// namespace, starting with its parent and ending with the topmost ancestor
+// visible to the caller. For the initial user and PID namespaces, the
+// returned list is empty.
+func Ancestors(r Relation) ([]species.NamespaceID, error) {
+	ancestors := []species.NamespaceID{}
+	var iderr error
+	err := WalkAncestors(r, func(ancestor *NamespaceFile) bool {
+		var id species.NamespaceID
+		if id, iderr = ancestor.ID(); iderr != nil {
+			return false
+		}
+		ancestors = append(ancestors, id)
+		return true
+	})
+	if err == nil {
+		err = iderr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ancestors, nil
+}
+
+// Depth returns the depth of the referenced user or PID namespace in its
+// hierarchy, as visible to the caller: the topmost visible namespace, such as
+// the initial user namespace, has depth 0, its children have depth 1, and so
+// on.
+func Depth(r Relation) (int, error) {
+	depth := 0
+	err := WalkAncestors(r, func(*NamespaceFile) bool {
+		depth++
+		return true
+	})
+	return depth, err
+}
+
+// IsAncestorOf returns true if the namespace referenced by ancestor is an
+// ancestor of the namespace referenced by descendant. A namespace is not an
+// ancestor of itself.
+func IsAncestorOf(ancestor Relation, descendant Relation) (bool, error) {
+	id, err := sameHierarchy(ancestor, descendant)
+	if err != nil {
+		return false, err
+	}
+	found := false
+	var iderr error
+	err = WalkAncestors(descendant, func(a *NamespaceFile) bool {
+		var aid species.NamespaceID
+		if aid, iderr = a.ID(); iderr != nil {
+			return false
+		}
+		found = aid == id
+		return !found
+	})
+	if err == nil {
+		err = iderr
+	}
+	return found, err
+}
+
+// CommonAncestor returns the ID of the lowest namespace which is either the
+// same as or an ancestor of both of the referenced user or PID namespaces.
+// If there is no such common namespace visible to the caller, then
+// species.NoneID is returned.
+func CommonAncestor(r1 Relation, r2 Relation) (species.NamespaceID, error) {
+	id1, err := sameHierarchy(r1, r2)
+	if err != nil {
+		return species.NoneID, err
+	}
+	lineage, err := Ancestors(r1)
+	if err != nil {
+		return species.NoneID, err
+	}
+	lineage1 := map[species.NamespaceID]bool{id1: true}
+	for _, id := range lineage {
+		lineage1[id] = true
+	}
+	id2, err := r2.ID()
+	if err != nil {
+		return species.NoneID, err
+	}
+	if lineage1[id2] {
+		return id2, nil
+	}
+	common := species.NoneID
+	var iderr error
+	err = WalkAncestors(r2, func(a *NamespaceFile) bool {
+		var aid species.NamespaceID
+		if aid, iderr = a.ID(); iderr != nil {
+			return false
+		}
+		if lineage1[aid] {
+			common = aid
+			return false
+		}
+		return true
+	})
+	if err == nil {
+		err = iderr
+	}
+	return common, err
+}
+
+// hierarchical returns an error if the referenced namespace is neither a user
+// nor a PID namespace. On Linux kernels before 4.11 lacking NS_GET_NSTYPE,
+// hierarchical cannot tell and leaves it to NS_GET_PARENT to reject any
+// non-hierarchical namespace, so that navigating hierarchies still works with
+// kernel 4.9.
+func hierarchical(r Relation) error {
+	nstype, err := r.Type()
+	if err != nil {
+		if errors.Is(err, unix.ENOTTY) {
+			return nil
+		}
+		return err
+	}
+	if nstype != species.CLONE_NEWUSER && nstype != species.CLONE_NEWPID {
+		return fmt.Errorf("%s namespace is not hierarchical", nstype.Name())
+	}
+	return nil
+}
+
+// sameHierarchy returns the ID of the first referenced namespace, if both
+// referenced namespaces are of the same hierarchical type; otherwise, it
+// returns an error. Without NS_GET_NSTYPE support, the types of the referenced
+// namespaces cannot be compared, so two namespaces from different hierarchies
+// then simply turn out to be unrelated.
+func sameHierarchy(r1 Relation, r2 Relation) (species.NamespaceID, error) {
+	if err := hierarchical(r1); err != nil {
+		return species.NoneID, err
+	}
+	t1, err1 := r1.Type()
+	t2, err := r2.Type()
+	switch {
+	case errors.Is(err1, unix.ENOTTY) || errors.Is(err, unix.ENOTTY):
+		// Can't tell, so let's hope for the best.
+	case err != nil:
+		return species.NoneID, err
+	case t1 != t2:
+		return species.NoneID, fmt.Errorf("cannot relate %s namespace to %s namespace",
+			t1.Name(), t2.Name())
+	}
+	return r1.ID()
+}
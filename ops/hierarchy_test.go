@@ -0,0 +1,149 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thediveo/lxkns/species"
+	"golang.org/x/sys/unix"
+)
+
+// preNstypeRelation references a namespace as if on a Linux kernel before
+// 4.11, which doesn't support NS_GET_NSTYPE yet.
+type preNstypeRelation struct{ NamespacePath }
+
+func (r preNstypeRelation) Type() (species.NamespaceType, error) {
+	return 0, newNamespaceOperationError(OpNsGetNstype, string(r.NamespacePath), unix.ENOTTY)
+}
+
+var _ = Describe("Namespace Hierarchies", func() {
+
+	var ownpidns NamespacePath
+	var ownpidnsid species.NamespaceID
+	var owndepth int
+
+	BeforeEach(func() {
+		if os.Geteuid() != 0 {
+			Skip("needs root")
+		}
+		ownpidns = NamespacePath("/proc/self/ns/pid")
+		ownpidnsid, _ = ownpidns.ID()
+		var err error
+		owndepth, err = Depth(ownpidns)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("navigates a child PID namespace", func() {
+		child, err := NewNamespace(species.CLONE_NEWPID)
+		Expect(err).NotTo(HaveOccurred())
+		defer child.Close()
+		childid, _ := child.ID()
+
+		Expect(Depth(child)).To(Equal(owndepth + 1))
+		Expect(Depth(NamespaceFd(child.Fd()))).To(Equal(owndepth + 1))
+		ancestors, err := Ancestors(child)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ancestors).To(HaveLen(owndepth + 1))
+		Expect(ancestors[0]).To(Equal(ownpidnsid))
+
+		Expect(IsAncestorOf(ownpidns, child)).To(BeTrue())
+		Expect(IsAncestorOf(child, ownpidns)).To(BeFalse())
+		Expect(IsAncestorOf(ownpidns, ownpidns)).To(BeFalse())
+
+		sibling, err := NewNamespace(species.CLONE_NEWPID)
+		Expect(err).NotTo(HaveOccurred())
+		defer sibling.Close()
+		Expect(CommonAncestor(child, sibling)).To(Equal(ownpidnsid))
+		Expect(CommonAncestor(child, ownpidns)).To(Equal(ownpidnsid))
+		Expect(CommonAncestor(child, child)).To(Equal(childid))
+	})
+
+	It("navigates nested PID namespaces", func() {
+		nested := exec.Command("unshare", "--pid", "--fork",
+			"unshare", "--pid", "--fork", "sleep", "60")
+		Expect(nested.Start()).To(Succeed())
+		defer func() {
+			_ = nested.Process.Kill()
+			_ = nested.Wait()
+		}()
+		// Find the innermost "sleep" process, climbing down the process tree.
+		var innermost int
+		Eventually(func() string {
+			innermost = nested.Process.Pid
+			for {
+				children, _ := ioutil.ReadFile(
+					fmt.Sprintf("/proc/%d/task/%d/children", innermost, innermost))
+				fields := strings.Fields(string(children))
+				if len(fields) == 0 {
+					break
+				}
+				fmt.Sscan(fields[0], &innermost)
+			}
+			comm, _ := ioutil.ReadFile(fmt.Sprintf("/proc/%d/comm", innermost))
+			return strings.TrimSpace(string(comm))
+		}).Should(Equal("sleep"))
+		innerpidns := NamespacePath(fmt.Sprintf("/proc/%d/ns/pid", innermost))
+		Expect(Depth(innerpidns)).To(Equal(owndepth + 2))
+		ancestors, err := Ancestors(innerpidns)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ancestors).To(HaveLen(owndepth + 2))
+		Expect(ancestors[1]).To(Equal(ownpidnsid))
+		Expect(IsAncestorOf(ownpidns, innerpidns)).To(BeTrue())
+
+		child, err := NewNamespace(species.CLONE_NEWPID)
+		Expect(err).NotTo(HaveOccurred())
+		defer child.Close()
+		Expect(CommonAncestor(innerpidns, child)).To(Equal(ownpidnsid))
+
+		n := 0
+		Expect(WalkAncestors(innerpidns, func(*NamespaceFile) bool {
+			n++
+			return false
+		})).To(Succeed())
+		Expect(n).To(Equal(1))
+	})
+
+	It("rejects non-hierarchical namespaces", func() {
+		_, err := Depth(NamespacePath("/proc/self/ns/net"))
+		Expect(err).To(MatchError(ContainSubstring("not hierarchical")))
+		_, err = IsAncestorOf(ownpidns, NamespacePath("/proc/self/ns/user"))
+		Expect(err).To(HaveOccurred())
+		_, err = CommonAncestor(NamespacePath("/proc/self/ns/net"), ownpidns)
+		Expect(err).To(HaveOccurred())
+		_, err = Ancestors(NamespacePath("/foobar"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("navigates without NS_GET_NSTYPE", func() {
+		Expect(Depth(preNstypeRelation{ownpidns})).To(Equal(owndepth))
+		child, err := NewNamespace(species.CLONE_NEWPID)
+		Expect(err).NotTo(HaveOccurred())
+		defer child.Close()
+		childpidns := preNstypeRelation{NamespacePath(fmt.Sprintf("/proc/self/fd/%d", child.Fd()))}
+		Expect(IsAncestorOf(preNstypeRelation{ownpidns}, childpidns)).To(BeTrue())
+		Expect(CommonAncestor(childpidns, ownpidns)).To(Equal(ownpidnsid))
+
+		_, err = Depth(preNstypeRelation{NamespacePath("/proc/self/ns/net")})
+		Expect(err).To(MatchError(ContainSubstring("not hierarchical")))
+	})
+
+})
@@ -0,0 +1,94 @@
+// Holding on to new user and PID namespaces using re-executed children.
+
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build cgo
+
+package ops
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/thediveo/gons/reexec"
+	"github.com/thediveo/lxkns/species"
+	"golang.org/x/sys/unix"
+)
+
+// holdNamespaceAction is the name of the gons/reexec action run by a
+// re-executed child holding on to the new namespaces it has been created in.
+const holdNamespaceAction = "lxkns-ops-hold-namespace"
+
+// reexecActionEnvVar is the environment variable gons/reexec checks in its
+// CheckAction() for the name of the action to run. We cannot use
+// reexec.ForkReexec() here, as it neither creates the child in new namespaces
+// nor gives us control over the child process.
+const reexecActionEnvVar = "gons_reexec_action"
+
+// Registers the namespace holder as a gons/reexec action, so it gets only
+// run in re-executed children of applications calling reexec.CheckAction().
+func init() {
+	reexec.Register(holdNamespaceAction, holdNamespace)
+}
+
+// holderCommand returns the command for re-executing this process as a
+// holder child created in a new namespace of the specified type.
+func holderCommand(nstype species.NamespaceType) (*exec.Cmd, error) {
+	child := exec.Command("/proc/self/exe")
+	child.Env = append(os.Environ(), reexecActionEnvVar+"="+holdNamespaceAction)
+	child.SysProcAttr = &syscall.SysProcAttr{Cloneflags: uintptr(nstype)}
+	return child, nil
+}
+
+// holdNamespace runs in a re-executed child which has been created in new
+// namespaces. It signals to its parent that it is ready and then keeps the
+// new namespaces alive until the parent closes the child's stdin. As the
+// child is the init process of a new PID namespace, it meanwhile reaps any
+// orphaned processes in its PID namespace, which got reparented to it.
+func holdNamespace() {
+	sigchld := make(chan os.Signal, 1)
+	signal.Notify(sigchld, unix.SIGCHLD)
+	released := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(ioutil.Discard, os.Stdin)
+		close(released)
+	}()
+	_, _ = os.Stdout.Write([]byte("\n"))
+	for {
+		reapOrphans()
+		select {
+		case <-sigchld:
+		case <-released:
+			os.Exit(0)
+		}
+	}
+}
+
+// reapOrphans reaps all terminated child processes without blocking.
+func reapOrphans() {
+	for {
+		pid, err := unix.Wait4(-1, nil, unix.WNOHANG, nil)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil || pid <= 0 {
+			return
+		}
+	}
+}
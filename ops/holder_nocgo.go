@@ -0,0 +1,33 @@
+// Without cgo there are no re-executed children holding new namespaces.
+
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !cgo
+
+package ops
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/thediveo/lxkns/species"
+)
+
+// holderCommand always fails, as re-executing this process as a holder child
+// relies on gons/reexec, which in turn requires cgo.
+func holderCommand(nstype species.NamespaceType) (*exec.Cmd, error) {
+	return nil, fmt.Errorf("cannot create new %s namespace without cgo support",
+		nstype.Name())
+}
@@ -20,44 +20,32 @@
 package ops
 
 import (
-	"errors"
-
 	"golang.org/x/sys/unix"
 )
 
 /*
    Ugly IOCTL stuff.
 
-   ATTENTION: the following definitions hold only for the "asm-generic"
-   platforms, such as x86, arm, and others. Currently the only platforms
-   having a different ioctl request field mapping are: alpha, mips, powerpc,
-   and sparc.
+   ATTENTION: the layout of ioctl request values differs between the
+   "asm-generic" platforms, such as x86, arm, and others, and the mips and
+   powerpc platforms supported by Go. The latter use only 13 bits for the
+   parameter size, but 3 bits for the direction, and additionally have a
+   non-zero "none" direction. The build-tagged ioctl_*.go files define
+   _IOC_SIZEBITS and _IOC_NONE for the architecture we're being built for.
 
-   Our const definitions here come from:
+   Our definitions here come from:
    https://elixir.bootlin.com/linux/latest/source/include/uapi/asm-generic/ioctl.h
+   https://elixir.bootlin.com/linux/latest/source/arch/mips/include/uapi/asm/ioctl.h
+   https://elixir.bootlin.com/linux/latest/source/arch/powerpc/include/uapi/asm/ioctl.h
 */
 const _IOC_NRBITS = 8
 const _IOC_TYPEBITS = 8
-const _IOC_SIZEBITS = 14
 
 const _IOC_NRSHIFT = 0
 const _IOC_TYPESHIFT = _IOC_NRSHIFT + _IOC_NRBITS
 const _IOC_SIZESHIFT = _IOC_TYPESHIFT + _IOC_TYPEBITS
 const _IOC_DIRSHIFT = _IOC_SIZESHIFT + _IOC_SIZEBITS
 
-const _IOC_NONE = uint(0)
-
-// Returns an ioctl() request value, calculated from the specific ioctl call
-// properties: parameter in/out direction, type of ioctl, command number, and
-// finally parameter size.
-func _IOC(dir, ioctype, nr, size uint) uint {
-	return (dir << _IOC_DIRSHIFT) | (ioctype << _IOC_TYPESHIFT) | (nr << _IOC_NRSHIFT) | (size << _IOC_SIZESHIFT)
-}
-
-func _IO(ioctype, nr uint) uint {
-	return _IOC(_IOC_NONE, ioctype, nr, 0)
-}
-
 // Linux kernel ioctl() command for namespace relationship queries
 // https://elixir.bootlin.com/linux/latest/source/include/uapi/linux/nsfs.h
 const _NSIO = 0xb7
@@ -69,13 +57,33 @@ const (
 	_NS_GET_OWNER_UID = 0x4 // Get owner UID (in the caller's user namespace) for a user namespace
 )
 
+// ioctl() request values for namespace relationship queries, without any
+// parameter (_IO), as encoded for the architecture we've been built for.
+const (
+	NS_GET_USERNS    = _IOC_NONE<<_IOC_DIRSHIFT | _NSIO<<_IOC_TYPESHIFT | _NS_GET_USERNS<<_IOC_NRSHIFT
+	NS_GET_PARENT    = _IOC_NONE<<_IOC_DIRSHIFT | _NSIO<<_IOC_TYPESHIFT | _NS_GET_PARENT<<_IOC_NRSHIFT
+	NS_GET_NSTYPE    = _IOC_NONE<<_IOC_DIRSHIFT | _NSIO<<_IOC_TYPESHIFT | _NS_GET_NSTYPE<<_IOC_NRSHIFT
+	NS_GET_OWNER_UID = _IOC_NONE<<_IOC_DIRSHIFT | _NSIO<<_IOC_TYPESHIFT | _NS_GET_OWNER_UID<<_IOC_NRSHIFT
+)
+
+// ioctlOps maps NSIO request values to their operation names for reporting
+// errors.
+var ioctlOps = map[uint]string{
+	NS_GET_USERNS:    OpNsGetUserns,
+	NS_GET_PARENT:    OpNsGetParent,
+	NS_GET_NSTYPE:    OpNsGetNstype,
+	NS_GET_OWNER_UID: OpNsGetOwnerUID,
+}
+
 // Internal convenience wrapper for calling a NSIO-related ioctl function of a
-// file descriptor using only the particular NSIO command number.
-func ioctl(fd int, nr uint) (uint, error) {
+// file descriptor using only the particular NS_GET_* request value. In case
+// of failure, it returns a NamespaceOperationError mentioning the specified
+// textual namespace reference.
+func ioctl(fd int, req uint, ref string) (uint, error) {
 	nsfd, _, errno := unix.Syscall(unix.SYS_IOCTL,
-		uintptr(fd), uintptr(_IO(_NSIO, nr)), uintptr(0))
+		uintptr(fd), uintptr(req), uintptr(0))
 	if errno != 0 {
-		return ^uint(0), errors.New(errno.Error())
+		return ^uint(0), newNamespaceOperationError(ioctlOps[req], ref, errno)
 	}
 	return uint(nsfd), nil
 }
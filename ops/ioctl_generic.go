@@ -0,0 +1,24 @@
+// Selects the asm-generic ioctl request layout.
+
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build linux
+// +build !mips,!mipsle,!mips64,!mips64le,!ppc,!ppc64,!ppc64le
+
+package ops
+
+// ioctl request layout of the asm-generic platforms.
+const _IOC_SIZEBITS = 14
+const _IOC_NONE = 0
@@ -0,0 +1,120 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"runtime"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"golang.org/x/sys/unix"
+)
+
+// iocLayout describes the ioctl request layout of a Linux platform, so we
+// can check the request values for all platforms in a single test run,
+// regardless of the architecture we've been built for.
+type iocLayout struct {
+	sizebits uint // number of bits for the parameter size.
+	none     uint // "none" direction value.
+}
+
+var (
+	asmGenericLayout = iocLayout{sizebits: 14, none: 0}
+	powerMipsLayout  = iocLayout{sizebits: 13, none: 1}
+)
+
+// _IOC encodes an ioctl request value for this layout.
+func (l iocLayout) _IOC(dir, typ, nr, size uint) uint {
+	dirshift := _IOC_SIZESHIFT + l.sizebits
+	return dir<<dirshift | size<<_IOC_SIZESHIFT | typ<<_IOC_TYPESHIFT | nr<<_IOC_NRSHIFT
+}
+
+// _IO encodes an ioctl request value without any parameter for this layout.
+func (l iocLayout) _IO(typ, nr uint) uint {
+	return l._IOC(l.none, typ, nr, 0)
+}
+
+// archLayouts lists the ioctl request layouts of the Linux platforms
+// supported by Go.
+var archLayouts = map[string]iocLayout{
+	"386":      asmGenericLayout,
+	"amd64":    asmGenericLayout,
+	"arm":      asmGenericLayout,
+	"arm64":    asmGenericLayout,
+	"riscv64":  asmGenericLayout,
+	"s390x":    asmGenericLayout,
+	"mips":     powerMipsLayout,
+	"mipsle":   powerMipsLayout,
+	"mips64":   powerMipsLayout,
+	"mips64le": powerMipsLayout,
+	"ppc64":    powerMipsLayout,
+	"ppc64le":  powerMipsLayout,
+}
+
+var _ = Describe("ioctl", func() {
+
+	DescribeTable("encodes NS_GET_* requests",
+		func(goarch string, userns, parent, nstype, owneruid uint) {
+			layout, ok := archLayouts[goarch]
+			Expect(ok).To(BeTrue())
+			Expect(layout._IO(_NSIO, _NS_GET_USERNS)).To(Equal(userns))
+			Expect(layout._IO(_NSIO, _NS_GET_PARENT)).To(Equal(parent))
+			Expect(layout._IO(_NSIO, _NS_GET_NSTYPE)).To(Equal(nstype))
+			Expect(layout._IO(_NSIO, _NS_GET_OWNER_UID)).To(Equal(owneruid))
+		},
+		// The expected values are the ones generated from the Linux kernel
+		// headers for golang.org/x/sys/unix.
+		Entry("386", "386", uint(0xb701), uint(0xb702), uint(0xb703), uint(0xb704)),
+		Entry("amd64", "amd64", uint(0xb701), uint(0xb702), uint(0xb703), uint(0xb704)),
+		Entry("arm", "arm", uint(0xb701), uint(0xb702), uint(0xb703), uint(0xb704)),
+		Entry("arm64", "arm64", uint(0xb701), uint(0xb702), uint(0xb703), uint(0xb704)),
+		Entry("riscv64", "riscv64", uint(0xb701), uint(0xb702), uint(0xb703), uint(0xb704)),
+		Entry("s390x", "s390x", uint(0xb701), uint(0xb702), uint(0xb703), uint(0xb704)),
+		Entry("mips", "mips", uint(0x2000b701), uint(0x2000b702), uint(0x2000b703), uint(0x2000b704)),
+		Entry("mipsle", "mipsle", uint(0x2000b701), uint(0x2000b702), uint(0x2000b703), uint(0x2000b704)),
+		Entry("mips64", "mips64", uint(0x2000b701), uint(0x2000b702), uint(0x2000b703), uint(0x2000b704)),
+		Entry("mips64le", "mips64le", uint(0x2000b701), uint(0x2000b702), uint(0x2000b703), uint(0x2000b704)),
+		Entry("ppc64", "ppc64", uint(0x2000b701), uint(0x2000b702), uint(0x2000b703), uint(0x2000b704)),
+		Entry("ppc64le", "ppc64le", uint(0x2000b701), uint(0x2000b702), uint(0x2000b703), uint(0x2000b704)),
+	)
+
+	It("encodes directions and sizes", func() {
+		const _IOC_READ = 2
+		Expect(asmGenericLayout._IOC(_IOC_READ, 'X', 1, 4)).To(Equal(uint(0x80045801)))
+		Expect(powerMipsLayout._IOC(_IOC_READ, 'X', 1, 4)).To(Equal(uint(0x40045801)))
+	})
+
+	It("uses the layout of the architecture built for", func() {
+		layout, ok := archLayouts[runtime.GOARCH]
+		Expect(ok).To(BeTrue(), "unknown GOARCH %s", runtime.GOARCH)
+		Expect(layout.sizebits).To(Equal(uint(_IOC_SIZEBITS)))
+		Expect(layout.none).To(Equal(uint(_IOC_NONE)))
+		Expect([]uint{NS_GET_USERNS, NS_GET_PARENT, NS_GET_NSTYPE, NS_GET_OWNER_UID}).To(Equal([]uint{
+			layout._IO(_NSIO, _NS_GET_USERNS),
+			layout._IO(_NSIO, _NS_GET_PARENT),
+			layout._IO(_NSIO, _NS_GET_NSTYPE),
+			layout._IO(_NSIO, _NS_GET_OWNER_UID),
+		}))
+		// Cross-check with the request values from golang.org/x/sys/unix,
+		// which are generated from the Linux kernel headers for the
+		// architecture built for.
+		Expect(uint(NS_GET_USERNS)).To(Equal(uint(unix.NS_GET_USERNS)))
+		Expect(uint(NS_GET_PARENT)).To(Equal(uint(unix.NS_GET_PARENT)))
+		Expect(uint(NS_GET_NSTYPE)).To(Equal(uint(unix.NS_GET_NSTYPE)))
+		Expect(uint(NS_GET_OWNER_UID)).To(Equal(uint(unix.NS_GET_OWNER_UID)))
+	})
+
+})
@@ -15,12 +15,21 @@
 package ops
 
 import (
+	"os"
 	"testing"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	rxtst "github.com/thediveo/gons/reexec/testing"
 )
 
+func TestMain(m *testing.M) {
+	// Ensure that the namespace holder action is run in re-executed children
+	// created by NewNamespace, instead of running the tests again.
+	mm := &rxtst.M{M: m}
+	os.Exit(mm.Run())
+}
+
 func TestRelations(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "lxkns/ops package")
@@ -19,7 +19,6 @@
 package ops
 
 import (
-	"errors"
 	"unsafe"
 
 	"golang.org/x/sys/unix"
@@ -27,8 +26,8 @@ import (
 
 // ownerUID takes an open file descriptor which much reference a user namespace.
 // It then returns the UID of the user "owning" this user namespace, or an
-// error.
-func ownerUID(fd int) (int, error) {
+// error mentioning the specified textual namespace reference.
+func ownerUID(fd int, ref string) (int, error) {
 	// For the reason to use "int" to represent uid_t as the return value,
 	// see: https://github.com/golang/go/issues/6495; however, we must be
 	// careful with the Syscall(), giving it the correct uint32 -- even on
@@ -37,9 +36,9 @@ func ownerUID(fd int) (int, error) {
 	var uid uint32 = ^uint32(0) - 42
 	_, _, errno := unix.Syscall(
 		unix.SYS_IOCTL, uintptr(fd),
-		uintptr(_IO(_NSIO, _NS_GET_OWNER_UID)), uintptr(unsafe.Pointer(&uid)))
+		uintptr(NS_GET_OWNER_UID), uintptr(unsafe.Pointer(&uid)))
 	if errno != 0 {
-		return 0, errors.New(errno.Error())
+		return 0, newNamespaceOperationError(OpNsGetOwnerUID, ref, errno)
 	}
 	return int(uid), nil
 }
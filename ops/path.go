@@ -26,59 +26,59 @@ type NamespacePath string
 // file descriptor. Please note that a Linux kernel version 4.11 or later is
 // required.
 func (nsp NamespacePath) Type() (species.NamespaceType, error) {
-	fd, err := unix.Open(string(nsp), unix.O_RDONLY, 0)
+	fd, err := nsp.open()
 	if err != nil {
 		return 0, err
 	}
 	defer unix.Close(fd)
-	t, err := ioctl(int(fd), _NS_GET_NSTYPE)
+	t, err := ioctl(fd, NS_GET_NSTYPE, string(nsp))
 	return species.NamespaceType(t), err
 }
 
 // ID returns the namespace ID in form of its inode number for any given
 // Linux kernel namespace reference.
 func (nsp NamespacePath) ID() (species.NamespaceID, error) {
-	fd, err := unix.Open(string(nsp), unix.O_RDONLY, 0)
+	fd, err := nsp.open()
 	if err != nil {
 		return species.NoneID, err
 	}
 	defer unix.Close(fd)
-	return fdID(int(fd))
+	return fdID(fd, string(nsp))
 }
 
 // User returns the owning user namespace of any namespace, as a NamespaceFile
 // reference. For user namespaces, User() behaves identical to Parent(). A Linux
 // kernel version 4.9 or later is required.
 func (nsp NamespacePath) User() (*NamespaceFile, error) {
-	fd, err := unix.Open(string(nsp), unix.O_RDONLY, 0)
+	fd, err := nsp.open()
 	if err != nil {
 		return nil, err
 	}
 	defer unix.Close(fd)
-	return namespaceFileFromFd(ioctl(fd, _NS_GET_USERNS))
+	return namespaceFileFromFd(ioctl(fd, NS_GET_USERNS, string(nsp)))
 }
 
 // Parent returns the parent namespace of a hierarchical namespaces, that is, of
 // PID and user namespaces. For user namespaces, Parent() and User() behave
 // identical. A Linux kernel version 4.9 or later is required.
 func (nsp NamespacePath) Parent() (*NamespaceFile, error) {
-	fd, err := unix.Open(string(nsp), unix.O_RDONLY, 0)
+	fd, err := nsp.open()
 	if err != nil {
 		return nil, err
 	}
 	defer unix.Close(fd)
-	return namespaceFileFromFd(ioctl(fd, _NS_GET_PARENT))
+	return namespaceFileFromFd(ioctl(fd, NS_GET_PARENT, string(nsp)))
 }
 
 // OwnerUID returns the user id (UID) of the user namespace referenced by this
 // open file descriptor. A Linux kernel version 4.11 or later is required.
 func (nsp NamespacePath) OwnerUID() (int, error) {
-	fd, err := unix.Open(string(nsp), unix.O_RDONLY, 0)
+	fd, err := nsp.open()
 	if err != nil {
 		return 0, err
 	}
 	defer unix.Close(fd)
-	return ownerUID(fd)
+	return ownerUID(fd, string(nsp))
 }
 
 // Ensures that NamespacePath implements the Relation interface.
@@ -89,11 +89,19 @@ var _ Relation = (*NamespacePath)(nil)
 // descriptor when it doesn't need to reference the namespace anymore, in order
 // to avoid wasting file descriptors.
 func (nsp NamespacePath) Reference() (fd int, close bool, err error) {
-	var fdi int
-	fdi, err = unix.Open(string(nsp), unix.O_RDONLY, 0)
-	fd = int(fdi)
+	fd, err = nsp.open()
 	close = true
 	return
 }
 
+// open returns a new file descriptor referencing the namespace, or a
+// NamespaceOperationError.
+func (nsp NamespacePath) open() (int, error) {
+	fd, err := unix.Open(string(nsp), unix.O_RDONLY, 0)
+	if err != nil {
+		return -1, newNamespaceOperationError(OpOpen, string(nsp), err)
+	}
+	return fd, nil
+}
+
 var _ Referrer = (*NamespacePath)(nil)
@@ -0,0 +1,197 @@
+// Referencing the namespaces of a process using a pidfd.
+
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/thediveo/lxkns/species"
+	"golang.org/x/sys/unix"
+)
+
+// ProcessNamespaces references a set of namespaces of a particular process,
+// such as its network and UTS namespaces. Where supported (Linux kernel 5.3 or
+// later), ProcessNamespaces holds a pidfd to the process, so the reference
+// cannot accidentally switch over to a different process when the PID gets
+// reused. Go() and Execute() then join all the referenced namespaces of the
+// process in a single atomic setns(2) call on Linux kernels 5.8 or later, and
+// otherwise fall back to joining the namespaces one after another through
+// their /proc/[PID]/ns/... paths.
+//
+// Please note that ProcessNamespaces should be closed using Close() when not
+// needed anymore, in order to release its pidfd.
+type ProcessNamespaces struct {
+	PID   int                   // PID of the process whose namespaces are referenced.
+	Types species.NamespaceType // set of namespace types, CLONE_NEWNET|CLONE_NEWUTS|...
+	pidfd int                   // pidfd referencing the process, or -1 if unsupported.
+}
+
+// processNamespaceTypes lists the namespace types in the order they are to be
+// joined one after another, if a single atomic setns(2) isn't supported. This
+// order mirrors the order used by nsenter(1).
+var processNamespaceTypes = []species.NamespaceType{
+	species.CLONE_NEWUSER,
+	species.CLONE_NEWCGROUP,
+	species.CLONE_NEWIPC,
+	species.CLONE_NEWUTS,
+	species.CLONE_NEWNET,
+	species.CLONE_NEWPID,
+	species.CLONE_NEWNS,
+}
+
+// NewProcessNamespaces returns a reference to the namespaces of the specified
+// types of the process with the specified PID. The namespace types are
+// specified as a set of CLONE_NEWxxx constants. In case the process doesn't
+// exist, an error is returned instead.
+func NewProcessNamespaces(pid int, nstypes species.NamespaceType) (*ProcessNamespaces, error) {
+	pidfd, err := pidfdOpen(pid)
+	if err == unix.ENOSYS {
+		// Linux kernels before 5.3 don't support pidfds, so we have to live
+		// with the risk of PID reuse.
+		if _, err := os.Stat(fmt.Sprintf("/proc/%d", pid)); err != nil {
+			return nil, err
+		}
+		pidfd = -1
+	} else if err != nil {
+		return nil, newNamespaceOperationError(OpPidfdOpen, fmt.Sprintf("process %d", pid), err)
+	}
+	return &ProcessNamespaces{PID: pid, Types: nstypes, pidfd: pidfd}, nil
+}
+
+// Close releases the pidfd held by this reference to the namespaces of a
+// process.
+func (p *ProcessNamespaces) Close() error {
+	if p.pidfd < 0 {
+		return nil
+	}
+	err := unix.Close(p.pidfd)
+	p.pidfd = -1
+	return err
+}
+
+// Reference returns the pidfd referencing the process. Please note that a
+// pidfd can only be used with setns(2) when specifying the set of namespace
+// types to join, as opposed to other namespace references, which can be used
+// with a zero namespace type. Go() and Execute() take care of this.
+func (p *ProcessNamespaces) Reference() (fd int, close bool, err error) {
+	if p.pidfd < 0 {
+		err = fmt.Errorf("no pidfd for process %d", p.PID)
+		return
+	}
+	return p.pidfd, false, nil
+}
+
+var _ Referrer = (*ProcessNamespaces)(nil)
+
+// ref returns a textual reference to the namespaces of the process, for use
+// in error messages.
+func (p *ProcessNamespaces) ref() string {
+	return fmt.Sprintf("process %d", p.PID)
+}
+
+// setns switches the current OS thread into the referenced namespaces of the
+// process, preferably in a single atomic step.
+func (p *ProcessNamespaces) setns() error {
+	if p.pidfd >= 0 {
+		// Linux kernels before 5.8 reject pidfds in setns(2) with EINVAL, so
+		// we need to fall back to the individual namespace references in
+		// this case.
+		err := unix.Setns(p.pidfd, int(p.Types))
+		if err != unix.EINVAL {
+			return newNamespaceOperationError(OpSetns, p.ref(), err)
+		}
+	}
+	nsfiles, err := p.files()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, nsf := range nsfiles {
+			nsf.Close()
+		}
+	}()
+	for _, nsf := range nsfiles {
+		if err := unix.Setns(int(nsf.Fd()), 0); err != nil {
+			return newNamespaceOperationError(OpSetns, nsf.ref(), err)
+		}
+	}
+	return nil
+}
+
+// files opens the individual namespaces of the referenced process and returns
+// them in the order they need to be joined. If there is a pidfd, then files
+// checks after opening that the process is still alive, so that the opened
+// namespaces cannot belong to a different process reusing the same PID.
+func (p *ProcessNamespaces) files() (nsfiles []*NamespaceFile, err error) {
+	for _, nstype := range processNamespaceTypes {
+		if p.Types&nstype == 0 {
+			continue
+		}
+		path := fmt.Sprintf("/proc/%d/ns/%s", p.PID, nstype.Name())
+		nsf, err := NewNamespaceFile(os.Open(path))
+		if err != nil {
+			var pathErr *os.PathError
+			if errors.As(err, &pathErr) {
+				err = pathErr.Err
+			}
+			err = newNamespaceOperationError(OpOpen, path, err)
+			for _, nsf := range nsfiles {
+				nsf.Close()
+			}
+			return nil, err
+		}
+		nsfiles = append(nsfiles, nsf)
+	}
+	if p.pidfd >= 0 {
+		// Only ESRCH tells us that the process has terminated; in particular,
+		// EPERM just means that we aren't allowed to signal another user's
+		// process, yet it is still alive.
+		if err := PidfdSendSignal(p.pidfd, 0); errors.Is(err, unix.ESRCH) {
+			for _, nsf := range nsfiles {
+				nsf.Close()
+			}
+			return nil, newNamespaceOperationError(OpPidfdSendSignal, p.ref(), err)
+		}
+	}
+	return
+}
+
+// pidfdOpen returns a pidfd for the process with the specified PID, see also
+// pidfd_open(2).
+func pidfdOpen(pid int) (int, error) {
+	fd, _, errno := unix.Syscall(unix.SYS_PIDFD_OPEN, uintptr(pid), 0, 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+// PidfdSendSignal sends a signal to the process referenced by a pidfd, see
+// also pidfd_send_signal(2). Sending signal 0 only checks that the process is
+// still alive: only a unix.ESRCH error then tells that the process has
+// terminated, while unix.EPERM tells that the process is alive, but the
+// caller isn't allowed to signal it.
+func PidfdSendSignal(pidfd int, sig unix.Signal) error {
+	_, _, errno := unix.Syscall6(unix.SYS_PIDFD_SEND_SIGNAL,
+		uintptr(pidfd), uintptr(sig), 0, 0, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thediveo/lxkns/species"
+	"golang.org/x/sys/unix"
+)
+
+var _ = Describe("Process Namespaces", func() {
+
+	var sleepy *exec.Cmd
+	var netnsid, utsnsid species.NamespaceID
+
+	BeforeEach(func() {
+		if os.Geteuid() != 0 {
+			Skip("needs root")
+		}
+		sleepy = exec.Command("unshare", "-n", "-u", "sleep", "60")
+		Expect(sleepy.Start()).To(Succeed())
+		ownnetnsid, _ := NamespacePath("/proc/self/ns/net").ID()
+		netnsref := NamespacePath(fmt.Sprintf("/proc/%d/ns/net", sleepy.Process.Pid))
+		Eventually(func() species.NamespaceID {
+			id, _ := netnsref.ID()
+			return id
+		}).ShouldNot(Equal(ownnetnsid))
+		netnsid, _ = netnsref.ID()
+		utsnsid, _ = NamespacePath(fmt.Sprintf("/proc/%d/ns/uts", sleepy.Process.Pid)).ID()
+	})
+
+	AfterEach(func() {
+		if sleepy != nil {
+			_ = sleepy.Process.Kill()
+			_ = sleepy.Wait()
+		}
+	})
+
+	// threadNamespaces returns the IDs of the net and uts namespaces of the
+	// current OS thread.
+	threadNamespaces := func() interface{} {
+		netid, _ := NamespacePath(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid())).ID()
+		utsid, _ := NamespacePath(fmt.Sprintf("/proc/self/task/%d/ns/uts", unix.Gettid())).ID()
+		return []species.NamespaceID{netid, utsid}
+	}
+
+	It("executes in the namespaces of a process", func() {
+		procns, err := NewProcessNamespaces(sleepy.Process.Pid,
+			species.CLONE_NEWNET|species.CLONE_NEWUTS)
+		Expect(err).NotTo(HaveOccurred())
+		defer procns.Close()
+		Expect(Execute(threadNamespaces, procns)).To(
+			Equal([]species.NamespaceID{netnsid, utsnsid}))
+	})
+
+	It("falls back to individual namespaces", func() {
+		procns, err := NewProcessNamespaces(sleepy.Process.Pid,
+			species.CLONE_NEWNET|species.CLONE_NEWUTS)
+		Expect(err).NotTo(HaveOccurred())
+		defer procns.Close()
+		// Simulate a pidfd that setns(2) doesn't understand...
+		nsfiles, err := procns.files()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nsfiles).To(HaveLen(2))
+		for _, nsf := range nsfiles {
+			nsf.Close()
+		}
+		// ...as well as a kernel without any pidfd support.
+		nopidfd := &ProcessNamespaces{
+			PID:   sleepy.Process.Pid,
+			Types: species.CLONE_NEWNET | species.CLONE_NEWUTS,
+			pidfd: -1,
+		}
+		_, _, err = nopidfd.Reference()
+		Expect(err).To(HaveOccurred())
+		Expect(Execute(threadNamespaces, nopidfd)).To(
+			Equal([]species.NamespaceID{netnsid, utsnsid}))
+	})
+
+	It("visits the namespaces of a process", func() {
+		procns, err := NewProcessNamespaces(sleepy.Process.Pid,
+			species.CLONE_NEWNET|species.CLONE_NEWUTS)
+		Expect(err).NotTo(HaveOccurred())
+		defer procns.Close()
+		var visited interface{}
+		Expect(Visit(func() { visited = threadNamespaces() }, procns)).To(Succeed())
+		Expect(visited).To(Equal([]species.NamespaceID{netnsid, utsnsid}))
+	})
+
+	It("doesn't follow reused PIDs", func() {
+		procns, err := NewProcessNamespaces(sleepy.Process.Pid, species.CLONE_NEWNET)
+		Expect(err).NotTo(HaveOccurred())
+		defer procns.Close()
+		_ = sleepy.Process.Kill()
+		_ = sleepy.Wait()
+		sleepy = nil
+		_, err = Execute(threadNamespaces, procns)
+		Expect(err).To(HaveOccurred())
+		Expect(procns.Close()).To(Succeed())
+		Expect(procns.Close()).To(Succeed())
+	})
+
+	It("rejects non-existing processes", func() {
+		_, err := NewProcessNamespaces(-1, species.CLONE_NEWNET)
+		Expect(err).To(HaveOccurred())
+	})
+
+})
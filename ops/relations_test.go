@@ -74,7 +74,7 @@ var _ = Describe("Namespaces", func() {
 
 		var stat unix.Stat_t
 		Expect(unix.Stat("/proc/self/ns/cgroup", &stat)).ToNot(HaveOccurred())
-		nsid := species.NamespaceID{Dev: stat.Dev, Ino: stat.Ino}
+		nsid := species.NamespaceID{Dev: uint64(stat.Dev), Ino: stat.Ino}
 
 		Expect(NamespacePath("/proc/self/ns/cgroup").ID()).To(Equal(nsid))
 
@@ -90,7 +90,7 @@ var _ = Describe("Namespaces", func() {
 		Expect(err).ToNot(HaveOccurred())
 		defer nsf.Close()
 
-		fd, close, err := (&NamespaceFile{*nsf}).Reference()
+		fd, close, err := (&NamespaceFile{File: *nsf}).Reference()
 		Expect(err).ToNot(HaveOccurred())
 		Expect(close).To(BeFalse())
 		Expect(fd).To(Equal(int(nsf.Fd())))
@@ -208,7 +208,7 @@ read # wait for test to proceed()
 		f, err := os.Open(string(userpath))
 		Expect(err).NotTo(HaveOccurred())
 		defer f.Close()
-		Expect(NamespaceFile{*f}.OwnerUID()).To(Equal(os.Getuid()))
+		Expect(NamespaceFile{File: *f}.OwnerUID()).To(Equal(os.Getuid()))
 
 		Expect(NamespaceFd(f.Fd()).OwnerUID()).To(Equal(os.Getuid()))
 
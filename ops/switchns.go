@@ -17,8 +17,11 @@
 package ops
 
 import (
+	"context"
+	"fmt"
 	"runtime"
 
+	"github.com/thediveo/lxkns/species"
 	"golang.org/x/sys/unix"
 )
 
@@ -48,8 +51,22 @@ type Referrer interface {
 // executed after invoking Go(). Go() returns nil if switching namespaces
 // succeeded, else an error. Please note that Go() returns as soon as switching
 // namespaces has finished. The specified function is then run in its own Go
-// routine.
+// routine. When specifying a ProcessNamespaces reference, Go() joins the
+// referenced namespaces of the process in a single atomic step, where
+// supported by the Linux kernel.
 func Go(f func(), nsrefs ...Referrer) error {
+	return GoContext(context.Background(), f, nsrefs...)
+}
+
+// GoContext works like Go(), but additionally aborts switching namespaces as
+// soon as the specified context gets cancelled or its deadline expires. In
+// this case, the specified function won't be called and GoContext returns
+// either a TimeoutError or the context's cancellation error.
+func GoContext(ctx context.Context, f func(), nsrefs ...Referrer) error {
+	// As the started channel is unbuffered, either our caller receives the
+	// outcome of switching namespaces, or the context was done in the
+	// meantime and the Go routine gives up. In both cases there will be no
+	// Go routine blocked forever on the started channel.
 	started := make(chan error)
 	go func() {
 		// Lock, but never unlock the OS thread exclusively powering our Go
@@ -58,51 +75,294 @@ func Go(f func(), nsrefs ...Referrer) error {
 		runtime.LockOSThread()
 		// Switch our highly exclusive OS thread into the specified
 		// namespaces...
+		var err error
 		for _, nsref := range nsrefs {
-			// Important: since nsref.Reference() returns a file descriptor
-			// which potentially is derived from an open os.File, the latter
-			// must not get garbage collected while we attempt to use the file
-			// descriptor, as otherwise the os.File's finalizer will have closed
-			// the fd prematurely. Luckily (hopefully not!) the (varargs) slice
-			// won't be collectible until the iteration terminates, keeping its
-			// slice elements and thus its os.Files (if any) alive. In
-			// consequence, we don't need an explicit runtime.KeepAlive(...)
-			// here.
-			fd, close, err := nsref.Reference()
-			if err != nil {
-				started <- err
-				return // ex-terminate ;)
+			if err = ctx.Err(); err != nil {
+				break
 			}
-			err = unix.Setns(fd, 0)
-			if close {
-				// Don't leak open file descriptors...
-				unix.Close(int(fd))
+			if err = switchTo(nsref); err != nil {
+				break
 			}
+		}
+		select {
+		case started <- err:
 			if err != nil {
-				started <- err
-				return
+				return // ex-terminate ;)
 			}
+		case <-ctx.Done():
+			return
 		}
 		// Our preparations are finally done, so let's call the desired function and
 		// then call it a day.
-		started <- nil
 		f()
 	}()
 	// Wait for the goroutine to have finished switching namespaces and about to
 	// invoke the specified function. We're lazy and are never closing the
 	// channel, but it will get garbage collected anyway.
-	return <-started
+	select {
+	case err := <-started:
+		if err == ctx.Err() && err != nil {
+			return contextError(ctx)
+		}
+		return err
+	case <-ctx.Done():
+		return contextError(ctx)
+	}
+}
+
+// switchTo switches the current OS thread into the referenced namespace(s).
+func switchTo(nsref Referrer) error {
+	if procns, ok := nsref.(*ProcessNamespaces); ok {
+		return procns.setns()
+	}
+	// Important: since nsref.Reference() returns a file descriptor which
+	// potentially is derived from an open os.File, the latter must not get
+	// garbage collected while we attempt to use the file descriptor, as
+	// otherwise the os.File's finalizer will have closed the fd prematurely.
+	fd, close, err := nsref.Reference()
+	if err != nil {
+		return err
+	}
+	err = newNamespaceOperationError(OpSetns, referrerRef(nsref, fd), unix.Setns(fd, 0))
+	if close {
+		// Don't leak open file descriptors...
+		unix.Close(int(fd))
+	}
+	runtime.KeepAlive(nsref)
+	return err
+}
+
+// referrerRef returns a textual reference for the specified namespace
+// referrer, given the file descriptor it returned, for use in error messages.
+func referrerRef(nsref Referrer, fd int) string {
+	switch ref := nsref.(type) {
+	case NamespacePath:
+		return string(ref)
+	case NamespaceFile:
+		return ref.ref()
+	case *NamespaceFile:
+		return ref.ref()
+	case *ProcessNamespaces:
+		return ref.ref()
+	}
+	return fdRef(fd)
 }
 
 // Execute a function synchronously while switched into the specified
 // namespaces, then returns the interface{} outcome of calling the specified
 // function. If switching fails, Execute returns an error instead.
 func Execute(f func() interface{}, nsrefs ...Referrer) (interface{}, error) {
-	result := make(chan interface{})
-	if err := Go(func() {
+	return ExecuteContext(context.Background(), f, nsrefs...)
+}
+
+// ExecuteContext works like Execute(), but stops waiting for the specified
+// function to return as soon as the specified context gets cancelled or its
+// deadline expires. ExecuteContext then returns either a TimeoutError or the
+// context's cancellation error.
+//
+// Please note that the function cannot be forcefully stopped, so it should
+// watch the context itself where it might block. In any case, the OS thread
+// on which the function runs in the specified namespaces is destroyed after
+// the function finally returns, and never gets reused.
+func ExecuteContext(ctx context.Context, f func() interface{}, nsrefs ...Referrer) (interface{}, error) {
+	// The result channel is buffered, so that the Go routine running f can
+	// always deliver its result and terminate, even if we're not waiting
+	// anymore for it.
+	result := make(chan interface{}, 1)
+	if err := GoContext(ctx, func() {
 		result <- f()
 	}, nsrefs...); err != nil {
 		return nil, err
 	}
-	return <-result, nil
+	select {
+	case r := <-result:
+		return r, nil
+	case <-ctx.Done():
+		return nil, contextError(ctx)
+	}
+}
+
+// TimeoutError is returned by GoContext() and ExecuteContext() when their
+// context's deadline expired before switching namespaces or before the
+// function executed in other namespaces returned.
+type TimeoutError struct {
+	Err error // the context's error, that is, context.DeadlineExceeded.
+}
+
+// Error returns a textual description of this timeout error.
+func (e *TimeoutError) Error() string {
+	return "namespace operation timed out: " + e.Err.Error()
+}
+
+// Unwrap returns the underlying context error.
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout returns always true, as TimeoutErrors are timeouts.
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// contextError returns a TimeoutError if the context's deadline has expired,
+// and otherwise the context's (cancellation) error.
+func contextError(ctx context.Context) error {
+	if err := ctx.Err(); err != context.DeadlineExceeded {
+		return err
+	}
+	return &TimeoutError{Err: ctx.Err()}
+}
+
+// Visit locks the OS thread executing the current Go routine, then switches
+// this thread into the specified namespaces, and finally calls the specified
+// function f synchronously. After f returns, Visit switches the thread back
+// into its original namespaces and unlocks the thread again. Visit returns nil
+// if switching into the specified namespaces succeeded and f was called, else
+// an error; in the latter case, f has not been called.
+//
+// Only namespaces which can be both entered and left again by a single thread
+// of a multi-threaded process can be visited; these are network, IPC, UTS, and
+// cgroup namespaces. Attempts to visit mount, user, or PID namespaces are
+// rejected without switching any namespaces, please use Go() or the gons
+// package instead in these cases.
+//
+// If switching back into the original namespaces fails, then Visit panics,
+// as the current OS thread is in an unknown namespace state and must not be
+// reused anymore. In order to ensure this, the OS thread then stays locked to
+// the Go routine, so that the Go runtime destroys the thread when the Go
+// routine terminates.
+func Visit(f func(), nsrefs ...Referrer) error {
+	runtime.LockOSThread()
+	// As we need to know the original namespace for each namespace type
+	// we're going to switch, we need to visit the namespaces of a process
+	// one after another, instead of atomically switching them all at once.
+	var refs []Referrer
+	for _, nsref := range nsrefs {
+		procns, ok := nsref.(*ProcessNamespaces)
+		if !ok {
+			refs = append(refs, nsref)
+			continue
+		}
+		nsfiles, err := procns.files()
+		if err != nil {
+			restore(nil)
+			return err
+		}
+		for _, nsf := range nsfiles {
+			refs = append(refs, nsf)
+			defer nsf.Close()
+		}
+	}
+	// Check all namespaces before switching any of them, so that we don't
+	// switch back and forth in vain.
+	for _, ref := range refs {
+		if err := checkVisitable(ref); err != nil {
+			restore(nil)
+			return err
+		}
+	}
+	// The stack of open file descriptors referencing the original namespaces
+	// of this OS thread, in the order we switched away from them.
+	var originals []originalNamespace
+	for _, ref := range refs {
+		original, err := enter(ref)
+		if err != nil {
+			restore(originals)
+			return err
+		}
+		originals = append(originals, original)
+	}
+	defer restore(originals)
+	f()
+	return nil
+}
+
+// originalNamespace references a namespace our OS thread was attached to
+// before visiting another namespace of the same type.
+type originalNamespace struct {
+	fd     int
+	nstype species.NamespaceType
+}
+
+// visitable returns true if the current OS thread can be switched into a
+// namespace of the specified type and then safely back again. Mount and user
+// namespaces cannot be switched by multi-threaded processes at all, switching
+// PID and time namespaces only affects future child processes, and switching
+// the PID namespace cannot be undone.
+func visitable(nstype species.NamespaceType) bool {
+	switch nstype {
+	case species.CLONE_NEWNET, species.CLONE_NEWIPC, species.CLONE_NEWUTS, species.CLONE_NEWCGROUP:
+		return true
+	}
+	return false
+}
+
+// checkVisitable returns an error if the referenced namespace cannot be
+// visited, see also visitable.
+func checkVisitable(nsref Referrer) error {
+	fd, close, err := nsref.Reference()
+	if err != nil {
+		return err
+	}
+	defer runtime.KeepAlive(nsref)
+	if close {
+		defer unix.Close(fd)
+	}
+	nstype, err := NamespaceFd(fd).Type()
+	if err != nil {
+		return err
+	}
+	if !visitable(nstype) {
+		return fmt.Errorf("cannot visit %s namespace", nstype.Name())
+	}
+	return nil
+}
+
+// enter switches the current (locked) OS thread into the referenced namespace
+// and returns a reference to the namespace of the same type the thread was
+// attached to before.
+func enter(nsref Referrer) (original originalNamespace, err error) {
+	fd, close, err := nsref.Reference()
+	if err != nil {
+		return
+	}
+	// Make sure that the namespace reference (and any os.File it might hold)
+	// doesn't get garbage collected while we're still using its fd.
+	defer runtime.KeepAlive(nsref)
+	if close {
+		defer unix.Close(fd)
+	}
+	nstype, err := NamespaceFd(fd).Type()
+	if err != nil {
+		return
+	}
+	// Get hold of the current namespace of the same type before switching,
+	// as we otherwise couldn't find our way back anymore.
+	origpath := fmt.Sprintf("/proc/self/task/%d/ns/%s", unix.Gettid(), nstype.Name())
+	origfd, err := unix.Open(origpath, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		err = newNamespaceOperationError(OpOpen, origpath, err)
+		return
+	}
+	if err = unix.Setns(fd, int(nstype)); err != nil {
+		err = newNamespaceOperationError(OpSetns, referrerRef(nsref, fd), err)
+		unix.Close(origfd)
+		return
+	}
+	return originalNamespace{fd: origfd, nstype: nstype}, nil
+}
+
+// restore switches the current OS thread back into the original namespaces,
+// in reverse order of switching away from them, and then unlocks the thread.
+// If switching back fails, restore panics and leaves the OS thread locked.
+func restore(originals []originalNamespace) {
+	for idx := len(originals) - 1; idx >= 0; idx-- {
+		err := unix.Setns(originals[idx].fd, int(originals[idx].nstype))
+		if err != nil {
+			panic(fmt.Sprintf("cannot restore original %s namespace of OS thread %d: %s",
+				originals[idx].nstype.Name(), unix.Gettid(), err.Error()))
+		}
+		unix.Close(originals[idx].fd)
+	}
+	runtime.UnlockOSThread()
 }
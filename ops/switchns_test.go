@@ -15,8 +15,12 @@
 package ops
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -69,3 +73,112 @@ read # wait for test to proceed()
 	})
 
 })
+
+var _ = Describe("Visit Namespaces", func() {
+
+	It("visits other namespaces and returns", func() {
+		if os.Geteuid() != 0 {
+			Skip("needs root")
+		}
+		sleepy := exec.Command("unshare", "-n", "-u", "sleep", "60")
+		Expect(sleepy.Start()).To(Succeed())
+		defer func() {
+			_ = sleepy.Process.Kill()
+			_ = sleepy.Wait()
+		}()
+		// Wait for unshare to have created the new namespaces and exec'ed
+		// into sleep.
+		netnsref := NamespacePath(fmt.Sprintf("/proc/%d/ns/net", sleepy.Process.Pid))
+		utsnsref := NamespacePath(fmt.Sprintf("/proc/%d/ns/uts", sleepy.Process.Pid))
+		ownnetnsid, _ := NamespacePath("/proc/self/ns/net").ID()
+		Eventually(func() species.NamespaceID {
+			id, _ := netnsref.ID()
+			return id
+		}).ShouldNot(Equal(ownnetnsid))
+		netnsid, _ := netnsref.ID()
+		utsnsid, _ := utsnsref.ID()
+
+		var visitedtid int
+		Expect(Visit(func() {
+			visitedtid = unix.Gettid()
+			id, _ := NamespacePath(fmt.Sprintf("/proc/self/task/%d/ns/net", visitedtid)).ID()
+			Expect(id).To(Equal(netnsid))
+			id, _ = NamespacePath(fmt.Sprintf("/proc/self/task/%d/ns/uts", visitedtid)).ID()
+			Expect(id).To(Equal(utsnsid))
+		}, netnsref, utsnsref)).To(Succeed())
+		Expect(visitedtid).NotTo(BeZero())
+		// The visiting thread must have switched back, yet must not have been
+		// terminated.
+		id, err := NamespacePath(fmt.Sprintf("/proc/self/task/%d/ns/net", visitedtid)).ID()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(Equal(ownnetnsid))
+	})
+
+	It("rejects unvisitable namespaces", func() {
+		called := false
+		Expect(Visit(func() { called = true },
+			NamespacePath("/proc/self/ns/net"),
+			NamespacePath("/proc/self/ns/mnt"))).To(MatchError(ContainSubstring("cannot visit mnt namespace")))
+		Expect(called).To(BeFalse())
+		// The network namespace must only have been checked, but not entered.
+		netns := &countingReferrer{Referrer: NamespacePath("/proc/self/ns/net")}
+		Expect(Visit(func() { called = true },
+			netns, NamespacePath("/proc/self/ns/user"))).To(HaveOccurred())
+		Expect(netns.n).To(Equal(1))
+		Expect(Visit(func() { called = true },
+			NamespacePath("/nonexisting"))).To(HaveOccurred())
+		Expect(called).To(BeFalse())
+	})
+
+})
+
+// countingReferrer counts how often a namespace reference gets referenced.
+type countingReferrer struct {
+	Referrer
+	n int
+}
+
+func (r *countingReferrer) Reference() (int, bool, error) {
+	r.n++
+	return r.Referrer.Reference()
+}
+
+var _ = Describe("Context-aware Namespace Switching", func() {
+
+	It("executes with a context", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		Expect(ExecuteContext(ctx, func() interface{} { return 42 })).To(Equal(42))
+	})
+
+	It("times out", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		hang := make(chan struct{})
+		defer close(hang)
+		_, err := ExecuteContext(ctx, func() interface{} {
+			<-hang
+			return nil
+		})
+		Expect(err).To(BeAssignableToTypeOf(&TimeoutError{}))
+		Expect(err.(*TimeoutError).Timeout()).To(BeTrue())
+		Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("timed out"))
+	})
+
+	It("doesn't start when cancelled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		called := make(chan struct{}, 1)
+		err := GoContext(ctx, func() { called <- struct{}{} },
+			NamespacePath("/proc/self/ns/net"))
+		Expect(err).To(Equal(context.Canceled))
+		Consistently(called, "100ms").ShouldNot(Receive())
+	})
+
+	It("reports switching errors", func() {
+		Expect(GoContext(context.Background(), func() {},
+			NamespacePath("/nonexisting"))).To(HaveOccurred())
+	})
+
+})
@@ -18,10 +18,16 @@ package lxkns
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+
+	"github.com/thediveo/lxkns/ops"
+	"github.com/thediveo/lxkns/species"
 )
 
 // NamespacedPID is PID in the context of a specific PID namespace.
@@ -50,7 +56,14 @@ func (ns NamespacedPIDs) PIDs() []PIDType {
 // different PID namespaces. Further PIDMap methods then allow simple
 // translation of PIDs between different PID namespaces.
 type PIDMap struct {
-	m map[NamespacedPID]NamespacedPIDs
+	m         map[NamespacedPID]NamespacedPIDs
+	processes ProcessTable               // the processes mapped, by their PIDs as discovered.
+	pids      map[PIDType]NamespacedPIDs // namespaced PIDs by PIDs as discovered.
+	unmapped  map[PIDType]error          // processes which couldn't be mapped, and why.
+	procroot  string                     // proc filesystem to read task details from.
+	offline   bool                       // mapped from a bundle, so there are no tasks to map.
+	tidsOnce  sync.Once                  // tasks get mapped only on demand.
+	tids      map[NamespacedPID]*namespacedTask
 }
 
 // Translate translates a PID "pid" in PID namespace "from" to the
@@ -85,38 +98,91 @@ func (pm *PIDMap) NamespacedPIDs(pid PIDType, from Namespace) NamespacedPIDs {
 	return nil
 }
 
+// ProcessPIDs returns the list of all PIDs the specified process has been
+// given in different PID namespaces, ordered from the topmost PID namespace
+// down to the PID namespace the process is joined to. Returns nil if the
+// process couldn't be mapped.
+func (pm *PIDMap) ProcessPIDs(proc *Process) NamespacedPIDs {
+	namespacedpids, ok := pm.pids[proc.PID]
+	if !ok {
+		return nil
+	}
+	size := len(namespacedpids)
+	nspids := make([]NamespacedPID, size)
+	for idx, el := range namespacedpids {
+		nspids[size-1-idx] = el
+	}
+	return nspids
+}
+
+// Unmapped returns the processes which couldn't be mapped, together with the
+// reasons why.
+func (pm *PIDMap) Unmapped() map[PIDType]error {
+	return pm.unmapped
+}
+
 // NewPIDMap returns a new PID map based on the specified discovery results
-// and further information gathered from the /proc filesystem.
+// and further information gathered from the proc filesystem the discovery
+// used. Processes which cannot be mapped are skipped and recorded in
+// Unmapped(). When the Linux kernel doesn't tell the namespaced PIDs of
+// processes, then NewPIDMap falls back to looking up the PIDs from inside the
+// PID namespaces, using re-execution.
 func NewPIDMap(res *DiscoveryResult) *PIDMap {
+	return newPIDMap(res, NSpid)
+}
+
+// newPIDMap implements NewPIDMap, allowing to test the fallback when NSpid
+// isn't available.
+func newPIDMap(res *DiscoveryResult, nspid func(*Process, string) ([]PIDType, error)) *PIDMap {
 	pm := &PIDMap{
-		m: map[NamespacedPID]NamespacedPIDs{},
+		m:         map[NamespacedPID]NamespacedPIDs{},
+		processes: res.Processes,
+		pids:      map[PIDType]NamespacedPIDs{},
+		unmapped:  map[PIDType]error{},
+		procroot:  res.Options.ProcRoot,
+		offline:   res.nspids != nil,
+	}
+	procroot := res.Options.ProcRoot
+	if pm.offline {
+		nspid = res.capturedNSpid
 	}
+	lookups := map[Namespace]*localPIDsLookup{}
 	for _, proc := range res.Processes {
-		// For each process, first get its list of namespaced PIDs, which
-		// lists the PIDs starting from the PID namespace we're currently in
-		// and continues into nested child PID namespaces.
-		pids := NSpid(proc)
-		pidns := proc.Namespaces[PIDNS].(Hierarchy)
+		pidns, ok := proc.Namespaces[PIDNS].(Hierarchy)
+		if !ok {
+			pm.unmapped[proc.PID] = ErrIncompletePIDHierarchy
+			continue
+		}
 		// The namespaced PIDs are top-down, while we have to go bottom-up
 		// from the process' current PID namespace, in order to assemble the
 		// list of NamespacedPIDs correctly.
+		pidnses := []Namespace{}
+		for ; pidns != nil; pidns = pidns.Parent() {
+			pidnses = append(pidnses, pidns.(Namespace))
+		}
+		// For each process, first get its list of namespaced PIDs, which
+		// lists the PIDs starting from the PID namespace we're currently in
+		// and continues into nested child PID namespaces.
+		pids, err := nspid(proc, procroot)
+		if errors.Is(err, ErrNoNSpid) && !pm.offline {
+			pids, err = localPIDs(proc, pidnses, lookups, res)
+		}
+		if err != nil {
+			pm.unmapped[proc.PID] = err
+			continue
+		}
 		pidslen := len(pids)
-		if pidslen == 0 {
+		if pidslen != len(pidnses) {
+			// Did someone forgot to also discover the hierarchy???
+			pm.unmapped[proc.PID] = ErrIncompletePIDHierarchy
 			continue
 		}
 		namespacedpids := make(NamespacedPIDs, pidslen)
-		idx := 0
-		for pidns != nil {
+		for idx, pidns := range pidnses {
 			namespacedpids[idx] = NamespacedPID{
-				PIDNS: pidns.(Namespace),
+				PIDNS: pidns,
 				PID:   pids[pidslen-idx-1],
 			}
-			pidns = pidns.Parent()
-			idx++
-		}
-		if idx != pidslen {
-			// Did someone forgot to also discover the hierarchy???
-			continue
 		}
 		// Now index these NamespacedPIDs by the list NamespacedPID elements,
 		// so we can later quickly look up the list of namespaced PIDs for
@@ -124,21 +190,53 @@ func NewPIDMap(res *DiscoveryResult) *PIDMap {
 		for _, namespacedpid := range namespacedpids {
 			pm.m[namespacedpid] = namespacedpids
 		}
+		pm.pids[proc.PID] = namespacedpids
 	}
 	return pm
 }
 
+// capturedNSpid returns the namespaced PIDs captured in a bundle for the
+// process proc. As the PID namespaces of the captured host cannot be entered,
+// there is no way to look up the PIDs of processes without namespaced PIDs.
+func (res *DiscoveryResult) capturedNSpid(proc *Process, _ string) ([]PIDType, error) {
+	if pids, ok := res.nspids[proc.PID]; ok {
+		return pids, nil
+	}
+	return nil, fmt.Errorf("lxkns: process %d: %w", proc.PID, ErrNoNSpid)
+}
+
+// ErrNoNSpid indicates that the Linux kernel doesn't tell the namespaced PIDs
+// of processes in their status, such as before Linux 4.1, or in gVisor.
+var ErrNoNSpid = errors.New("no NSpid element in process status")
+
+// ErrIncompletePIDHierarchy indicates that the PID namespace of a process or
+// the hierarchy of PID namespaces hasn't been discovered.
+var ErrIncompletePIDHierarchy = errors.New("incomplete PID namespace hierarchy")
+
 // NSpid returns the list of namespaced PIDs for the process proc, based on
-// information from the /proc filesystem (the "NSpid:" field in particular).
-// NSpid only returns the list of PIDs, but not the corresponding PID
-// namespaces; this is because the Linux kernel doesn't give us the namespace
-// information as part of the process status. Instead, a caller (such as
-// NewPIDMap) needs to combine a namespaced PIDs list with the hierarchy own
-// PID namespaces to calculate the correct namespacing.
-func NSpid(proc *Process) (pids []PIDType) {
-	f, err := os.Open(fmt.Sprintf("/proc/%d/status", proc.PID))
+// information from the proc filesystem mounted at procroot (the "NSpid:"
+// field in particular); an empty procroot defaults to "/proc". NSpid only
+// returns the list of PIDs, but not the corresponding PID namespaces; this is
+// because the Linux kernel doesn't give us the namespace information as part
+// of the process status. Instead, a caller (such as NewPIDMap) needs to
+// combine a namespaced PIDs list with the hierarchy own PID namespaces to
+// calculate the correct namespacing. If the kernel doesn't tell the
+// namespaced PIDs, then NSpid returns an error wrapping ErrNoNSpid.
+func NSpid(proc *Process, procroot string) (pids []PIDType, err error) {
+	if procroot == "" {
+		procroot = "/proc"
+	}
+	return nspid(fmt.Sprintf("%s/%d/status", procroot, proc.PID),
+		fmt.Sprintf("process %d", proc.PID))
+}
+
+// nspid returns the list of namespaced PIDs from the "NSpid:" field of the
+// process or task status file at path; what describes the process or task
+// for error messages.
+func nspid(path string, what string) (pids []PIDType, err error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return
+		return nil, err
 	}
 	defer f.Close()
 	scanner := bufio.NewScanner(f)
@@ -152,12 +250,118 @@ func NSpid(proc *Process) (pids []PIDType) {
 			for idx, pidtxt := range pidstxts {
 				pid, err := strconv.Atoi(pidtxt)
 				if err != nil {
-					return []PIDType{}
+					return nil, fmt.Errorf(
+						"lxkns: invalid NSpid element of %s: %w", what, err)
 				}
 				pids[idx] = PIDType(pid)
 			}
 			return
 		}
 	}
-	panic("/proc filesystem broken: no NSpid element in status.")
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("lxkns: %s: %w", what, ErrNoNSpid)
+}
+
+// localPIDsLookup maps processes to their PIDs local to a particular PID
+// namespace, as seen from inside that PID namespace.
+type localPIDsLookup struct {
+	pids map[localProcess]PIDType // zero PIDs mark ambiguous processes.
+	err  error
+}
+
+// localProcess identifies a process independent of the PID namespace it is
+// seen from, and additionally carries the PID local to a PID namespace.
+type localProcess struct {
+	PID       PIDType `json:"pid,omitempty"`
+	Starttime uint64  `json:"starttime"`
+	Name      string  `json:"name"`
+}
+
+// localPIDs returns the namespaced PIDs of a process without the help of the
+// NSpid status field, by looking up the process in the proc filesystems of
+// the PID namespaces in the process' PID namespace hierarchy. The PID
+// namespaces are given bottom-up, while the PIDs are returned top-down.
+func localPIDs(proc *Process, pidnses []Namespace, lookups map[Namespace]*localPIDsLookup, res *DiscoveryResult) ([]PIDType, error) {
+	pids := []PIDType{proc.PID}
+	for idx := len(pidnses) - 2; idx >= 0; idx-- {
+		pidns := pidnses[idx]
+		lookup, ok := lookups[pidns]
+		if !ok {
+			lookup = newLocalPIDsLookup(pidns, res)
+			lookups[pidns] = lookup
+		}
+		if lookup.err != nil {
+			return nil, lookup.err
+		}
+		pid := lookup.pids[localProcess{Starttime: proc.Starttime, Name: proc.Name}]
+		if pid == 0 {
+			return nil, fmt.Errorf("lxkns: process %d not identifiable in PID namespace pid:[%d]",
+				proc.PID, pidns.ID().Ino)
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+// newLocalPIDsLookup looks up the PIDs of the processes in the specified PID
+// namespace from the inside: it re-executes into the mount namespace of the
+// ealdorman of the PID namespace, hoping for a proc filesystem belonging to
+// this PID namespace.
+func newLocalPIDsLookup(pidns Namespace, res *DiscoveryResult) *localPIDsLookup {
+	lookup := &localPIDsLookup{pids: map[localProcess]PIDType{}}
+	ealdorman := pidns.Ealdorman()
+	if ealdorman == nil || ealdorman.Namespaces[MountNS] == nil {
+		lookup.err = fmt.Errorf("lxkns: no mount namespace for PID namespace pid:[%d]",
+			pidns.ID().Ino)
+		return lookup
+	}
+	mntns := ealdorman.Namespaces[MountNS]
+	enterns := []Namespace{mntns}
+	ownusernsid, _ := ops.NamespacePath("/proc/self/ns/user").ID()
+	if userns, ok := mntns.Owner().(Namespace); ok && userns.ID() != ownusernsid {
+		enterns = append(enterns, userns)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), reexecTimeout(res))
+	defer cancel()
+	lookup.err = RunAction(ctx, "lxkns-local-pids", enterns, pidns.ID(),
+		func(proc localProcess) error {
+			key := localProcess{Starttime: proc.Starttime, Name: proc.Name}
+			if _, ok := lookup.pids[key]; ok {
+				proc.PID = 0
+			}
+			lookup.pids[key] = proc.PID
+			return nil
+		})
+	return lookup
+}
+
+// Register the action looking up the local PIDs in a PID namespace.
+func init() {
+	RegisterAction("lxkns-local-pids", discoverLocalPIDs)
+}
+
+// discoverLocalPIDs is the action run inside a mount namespace with a proc
+// filesystem belonging to the specified PID namespace, emitting the processes
+// with their local PIDs.
+func discoverLocalPIDs(pidnsid species.NamespaceID, emit func(localProcess) error) error {
+	procpidnsid, err := ops.NamespacePath("/proc/1/ns/pid").ID()
+	if err != nil {
+		return err
+	}
+	if procpidnsid != pidnsid {
+		return fmt.Errorf("proc filesystem belongs to PID namespace pid:[%d] instead of pid:[%d]",
+			procpidnsid.Ino, pidnsid.Ino)
+	}
+	for _, proc := range newProcessTable("/proc") {
+		if err := emit(localProcess{
+			PID:       proc.PID,
+			Starttime: proc.Starttime,
+			Name:      proc.Name,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
 }
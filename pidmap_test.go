@@ -15,6 +15,12 @@
 package lxkns
 
 import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/thediveo/lxkns/nstest"
@@ -25,7 +31,62 @@ import (
 var _ = Describe("maps PIDs", func() {
 
 	It("returns empty PID slice for non-existing PID", func() {
-		Expect(NSpid(&Process{})).To(BeEmpty())
+		pids, err := NSpid(&Process{}, "")
+		Expect(err).To(HaveOccurred())
+		Expect(pids).To(BeEmpty())
+	})
+
+	It("reports missing and broken NSpid elements", func() {
+		_, err := NSpid(&Process{PID: 1}, "test/pidmap/proc")
+		Expect(errors.Is(err, ErrNoNSpid)).To(BeTrue())
+		_, err = NSpid(&Process{PID: 2}, "test/pidmap/proc")
+		Expect(err).To(MatchError(ContainSubstring("invalid NSpid element of process 2")))
+	})
+
+	It("records unmappable processes", func() {
+		opts := NoDiscovery
+		opts.SkipProcs = false
+		allns := Discover(opts) // ...but without the PID namespace hierarchy.
+		allns.Processes[0] = &Process{}
+		pidmap := NewPIDMap(allns)
+		Expect(pidmap.Unmapped()).To(HaveKeyWithValue(PIDType(0), ErrIncompletePIDHierarchy))
+	})
+
+	It("falls back to looking up PIDs from inside PID namespaces", func() {
+		sleepy := exec.Command("unshare", "--pid", "--kill-child", "--mount-proc", "sleep", "60")
+		Expect(sleepy.Start()).To(Succeed())
+		defer func() {
+			_ = sleepy.Process.Kill()
+			_ = sleepy.Wait()
+		}()
+		var sleepypid PIDType
+		Eventually(func() string {
+			children, _ := ioutil.ReadFile(fmt.Sprintf(
+				"/proc/%d/task/%d/children", sleepy.Process.Pid, sleepy.Process.Pid))
+			fields := strings.Fields(string(children))
+			if len(fields) == 0 {
+				return ""
+			}
+			fmt.Sscan(fields[0], &sleepypid)
+			comm, _ := ioutil.ReadFile(fmt.Sprintf("/proc/%d/comm", sleepypid))
+			return strings.TrimSpace(string(comm))
+		}).Should(Equal("sleep"))
+
+		opts := NoDiscovery
+		opts.SkipProcs = false
+		opts.SkipHierarchy = false
+		allns := Discover(opts)
+		sleepyproc := allns.Processes[sleepypid]
+		Expect(sleepyproc).NotTo(BeNil())
+		pidns := sleepyproc.Namespaces[PIDNS]
+		ownpidns := pidns.(Hierarchy).Parent().(Namespace)
+
+		pidmap := newPIDMap(allns, func(proc *Process, _ string) ([]PIDType, error) {
+			return nil, ErrNoNSpid
+		})
+		Expect(pidmap.Translate(sleepypid, ownpidns, pidns)).To(Equal(PIDType(1)))
+		Expect(pidmap.Translate(1, pidns, ownpidns)).To(Equal(sleepypid))
+		Expect(pidmap.Unmapped()).NotTo(HaveKey(sleepypid))
 	})
 
 	It("doesn't translates non-existing PID/namespace", func() {
@@ -0,0 +1,105 @@
+// Views the processes as seen from inside a particular PID namespace, similar
+// to what "ps" run inside a container would show.
+
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// +build linux
+
+package lxkns
+
+import "sort"
+
+// PIDView is the set of processes visible from inside a particular PID
+// namespace: these are the processes joined to this PID namespace, as well as
+// the processes joined to any of its child PID namespaces.
+type PIDView struct {
+	PIDNS     Namespace      // the PID namespace the processes are seen from.
+	Processes []*ViewProcess // visible processes, sorted by their local PIDs.
+	Roots     []*ViewProcess // topmost visible processes, sorted by their local PIDs.
+}
+
+// ViewProcess is a process as seen from inside a particular PID namespace.
+// Processes whose parents are outside the PID namespace have a local parent
+// PID of zero, just as Linux shows it.
+type ViewProcess struct {
+	Process   *Process       // the process as discovered.
+	PID       PIDType        // PID as seen from inside the PID namespace.
+	PPID      PIDType        // parent PID as seen from inside the PID namespace, or zero.
+	Parent    *ViewProcess   // visible parent process, or nil.
+	Children  []*ViewProcess // visible child processes, sorted by their local PIDs.
+	Namespace Namespace      // PID namespace the process is joined to.
+	PIDs      NamespacedPIDs // PIDs from the viewing PID namespace down to the process' own PID namespace.
+}
+
+// View returns the processes as seen from inside the specified PID
+// namespace, with their PIDs local to this PID namespace, and the local
+// process tree. Processes which couldn't be mapped are not included.
+func (pm *PIDMap) View(pidns Namespace) *PIDView {
+	view := &PIDView{PIDNS: pidns, Processes: []*ViewProcess{}, Roots: []*ViewProcess{}}
+	visible := map[PIDType]*ViewProcess{} // ...indexed by PIDs as discovered.
+	for pid, namespacedpids := range pm.pids {
+		for idx, namespacedpid := range namespacedpids {
+			if namespacedpid.PIDNS == pidns {
+				// The namespaced PIDs are bottom-up, starting with the
+				// process' own PID namespace.
+				pids := make(NamespacedPIDs, idx+1)
+				for pidx := range pids {
+					pids[pidx] = namespacedpids[idx-pidx]
+				}
+				vproc := &ViewProcess{
+					Process:   pm.processes[pid],
+					PID:       namespacedpid.PID,
+					Namespace: namespacedpids[0].PIDNS,
+					PIDs:      pids,
+				}
+				visible[pid] = vproc
+				view.Processes = append(view.Processes, vproc)
+				break
+			}
+		}
+	}
+	sortViewProcesses(view.Processes)
+	// Now that we know which processes are visible, relate them to their
+	// visible parents, if any. Please note that we're working along the
+	// sorted process list, so children automatically get sorted too.
+	for _, vproc := range view.Processes {
+		if parent, ok := visible[vproc.Process.PPID]; ok {
+			vproc.PPID = parent.PID
+			vproc.Parent = parent
+			parent.Children = append(parent.Children, vproc)
+		} else {
+			view.Roots = append(view.Roots, vproc)
+		}
+	}
+	return view
+}
+
+// Process returns the visible process with the specified local PID, or nil.
+func (v *PIDView) Process(pid PIDType) *ViewProcess {
+	idx := sort.Search(len(v.Processes), func(idx int) bool {
+		return v.Processes[idx].PID >= pid
+	})
+	if idx < len(v.Processes) && v.Processes[idx].PID == pid {
+		return v.Processes[idx]
+	}
+	return nil
+}
+
+// sortViewProcesses sorts a list of processes by their local PIDs.
+func sortViewProcesses(vprocs []*ViewProcess) {
+	sort.Slice(vprocs, func(i, j int) bool {
+		return vprocs[i].PID < vprocs[j].PID
+	})
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package lxkns
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PID views", func() {
+
+	It("views processes from inside a PID namespace", func() {
+		sleepy := exec.Command("unshare", "--pid", "--kill-child",
+			"sh", "-c", "sleep 60 & exec sleep 61")
+		Expect(sleepy.Start()).To(Succeed())
+		defer func() {
+			_ = sleepy.Process.Kill()
+			_ = sleepy.Wait()
+		}()
+		// Wait for the PID namespace's init process to have its child.
+		var initpid PIDType
+		Eventually(func() int {
+			children, _ := ioutil.ReadFile(fmt.Sprintf(
+				"/proc/%d/task/%d/children", sleepy.Process.Pid, sleepy.Process.Pid))
+			fields := strings.Fields(string(children))
+			if len(fields) == 0 {
+				return 0
+			}
+			fmt.Sscan(fields[0], &initpid)
+			children, _ = ioutil.ReadFile(fmt.Sprintf(
+				"/proc/%d/task/%d/children", initpid, initpid))
+			return len(strings.Fields(string(children)))
+		}).Should(Equal(1))
+
+		opts := NoDiscovery
+		opts.SkipProcs = false
+		opts.SkipHierarchy = false
+		allns := Discover(opts)
+		pidmap := NewPIDMap(allns)
+		pidns := allns.Processes[initpid].Namespaces[PIDNS]
+
+		view := pidmap.View(pidns)
+		Expect(view.PIDNS).To(BeIdenticalTo(pidns))
+		Expect(view.Processes).To(HaveLen(2))
+		Expect(view.Roots).To(HaveLen(1))
+		init := view.Roots[0]
+		Expect(init.PID).To(Equal(PIDType(1)))
+		Expect(init.PPID).To(BeZero())
+		Expect(init.Process.PID).To(Equal(initpid))
+		Expect(init.Namespace).To(BeIdenticalTo(pidns))
+		Expect(init.Children).To(HaveLen(1))
+		child := init.Children[0]
+		Expect(child.PID).To(Equal(PIDType(2)))
+		Expect(child.PPID).To(Equal(PIDType(1)))
+		Expect(child.Parent).To(BeIdenticalTo(init))
+		Expect(view.Process(2)).To(BeIdenticalTo(child))
+		Expect(view.Process(42)).To(BeNil())
+
+		ownpidns := allns.Processes[PIDType(os.Getpid())].Namespaces[PIDNS]
+		ownview := pidmap.View(ownpidns)
+		Expect(ownview.Process(initpid)).NotTo(BeNil())
+		Expect(ownview.Process(initpid).Namespace).To(BeIdenticalTo(pidns))
+		Expect(ownview.Process(initpid).PIDs).To(Equal(NamespacedPIDs{
+			{PIDNS: ownpidns, PID: initpid}, {PIDNS: pidns, PID: 1}}))
+		Expect(child.PIDs).To(Equal(NamespacedPIDs{{PIDNS: pidns, PID: 2}}))
+
+		pids := pidmap.ProcessPIDs(child.Process)
+		Expect(pids).To(HaveLen(2))
+		Expect(pids[0].PIDNS).To(BeIdenticalTo(ownpidns))
+		Expect(pids[1]).To(Equal(NamespacedPID{PIDNS: pidns, PID: 2}))
+		Expect(pidmap.ProcessPIDs(&Process{PID: -1})).To(BeNil())
+	})
+
+})
@@ -22,10 +22,15 @@ package lxkns
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"strconv"
 	"strings"
+
+	"github.com/thediveo/lxkns/ops"
+	"golang.org/x/sys/unix"
 )
 
 // PIDType expresses things more clearly. And no, that's not a "PidType" since
@@ -37,14 +42,21 @@ type PIDType int32
 // a specific Linux process. Well, the limitation comes from what we need for
 // namespace discovery to be useful.
 type Process struct {
-	PID        PIDType       // this process' identifier.
-	PPID       PIDType       // parent's process identifier.
-	Parent     *Process      // our parent's process description.
-	Children   []*Process    // child processes.
-	Name       string        // synthesized name of process.
-	Cmdline    []string      // command line of process.
-	Namespaces NamespacesSet // the 7 namespaces joined by this process.
-	Starttime  uint64        // Time of process start, since the Kernel boot epoch.
+	PID        PIDType           // this process' identifier.
+	PPID       PIDType           // parent's process identifier.
+	Parent     *Process          // our parent's process description.
+	Children   []*Process        // child processes.
+	Name       string            // synthesized name of process.
+	Cmdline    []string          // command line of process.
+	Namespaces NamespacesSet     // the 7 namespaces joined by this process.
+	Starttime  uint64            // Time of process start, since the Kernel boot epoch.
+	Labels     map[string]string // labels attached by decorators, or nil.
+	Status     *ProcessStatus    // credentials, capabilities, et cetera, only if discovered.
+	BootID     string            // boot ID of the system the process was discovered on.
+
+	procroot string   // proc filesystem this process was discovered from.
+	offline  bool     // discovered offline from a bundle.
+	pidfd    *os.File // process file descriptor, if opened.
 }
 
 // ProcessTable maps PIDs to their Process descriptions, allowing for quick
@@ -76,16 +88,26 @@ func (p *Process) Basename() (basename string) {
 	return
 }
 
+// SetLabel attaches a label with the specified name and value to this
+// process, replacing any existing label of the same name. SetLabel is meant to
+// be used by decorators.
+func (p *Process) SetLabel(name string, value string) {
+	if p.Labels == nil {
+		p.Labels = map[string]string{}
+	}
+	p.Labels[name] = value
+}
+
 // NewProcess returns a Process object describing certain properties of the
 // Linux process with the specified PID. In particular, the parent PID and the
 // name of the process, as well as the command line.
 func NewProcess(PID PIDType) (proc *Process) {
-	return newProcess(PID, "/proc")
+	return newProcess(PID, "/proc", bootID("/proc"))
 }
 
 // newProcess implements NewProcess and additionally allows for testing on
 // fake /proc "filesystems".
-func newProcess(PID PIDType, procroot string) (proc *Process) {
+func newProcess(PID PIDType, procroot string, bootid string) (proc *Process) {
 	procbase := procroot + "/" + strconv.Itoa(int(PID))
 	line, err := ioutil.ReadFile(procbase + "/stat")
 	if err != nil {
@@ -95,6 +117,8 @@ func newProcess(PID PIDType, procroot string) (proc *Process) {
 	if proc == nil {
 		return
 	}
+	proc.BootID = bootid
+	proc.procroot = procroot
 	// Also get the process command line, so later tools can decide to
 	// either go for the process name or the executable basename, et
 	// cetera.
@@ -176,9 +200,28 @@ func newProcessFromStatline(procstat string) (proc *Process) {
 // Valid checks for the same process to still be present in the OS process
 // table and then returns true, otherwise false. The validity check bases on
 // the start time of the process, so stale PIDs can be detected even if they
-// get reused after some time.
+// get reused after some time, as well as on the boot ID, so processes from
+// earlier system boots are never valid. The check uses the same proc
+// filesystem the process was discovered from. If the process has a process
+// file descriptor then this is used instead of the start time, see also
+// OpenPIDFD. Processes discovered offline from a bundle are never valid.
 func (p *Process) Valid() bool {
-	digitaltwin := NewProcess(p.PID)
+	if p.offline {
+		return false
+	}
+	procroot := p.procroot
+	if procroot == "" {
+		procroot = "/proc"
+	}
+	if p.BootID != "" && p.BootID != bootID(procroot) {
+		return false
+	}
+	if p.pidfd != nil {
+		// Only ESRCH tells us that the process is gone; EPERM tells us that
+		// the process is alive, but we aren't allowed to signal it.
+		return !errors.Is(ops.PidfdSendSignal(int(p.pidfd.Fd()), 0), unix.ESRCH)
+	}
+	digitaltwin := newProcess(p.PID, procroot, "")
 	return digitaltwin != nil && p.Starttime == digitaltwin.Starttime
 }
 
@@ -204,6 +247,7 @@ func newProcessTable(procroot string) (pt ProcessTable) {
 	}
 	// Phase I: discover all processes, together with some of their
 	// properties, such as name and PPID.
+	bootid := bootID(procroot)
 	pt = map[PIDType]*Process{}
 	for _, procentry := range procentries {
 		// Get the process PID as a number and then read its /proc/[PID]/stat
@@ -212,25 +256,68 @@ func newProcessTable(procroot string) (pt ProcessTable) {
 		if err != nil || pid == 0 {
 			continue
 		}
-		proc := newProcess(PIDType(pid), procroot)
+		proc := newProcess(PIDType(pid), procroot, bootid)
 		if proc == nil {
 			continue
 		}
 		pt[proc.PID] = proc
 	}
 	// Phase II: form a process object tree to speed up repeated traversals,
-	// which we'll need to run during namespace discovery. This is a simple
-	// optimization, just cutting map lookups at the expense of typed
-	// pointers. We're even so lazy as to not check for the PPID being
-	// present, as we'll get back a zero value anyway.
+	// which we'll need to run during namespace discovery.
+	pt.link()
+	// Phew: done.
+	return
+}
+
+// newProcessTableOf returns a process table with only the processes with the
+// specified PIDs, reading only their /proc/[PID] entries instead of scanning
+// all processes. Unknown PIDs are ignored. Processes get linked to their
+// parents and children only as long as these are in the table, too.
+func newProcessTableOf(procroot string, pids []PIDType) ProcessTable {
+	bootid := bootID(procroot)
+	pt := ProcessTable{}
+	for _, pid := range pids {
+		if _, ok := pt[pid]; ok || pid <= 0 {
+			continue
+		}
+		if proc := newProcess(pid, procroot, bootid); proc != nil {
+			pt[pid] = proc
+		}
+	}
+	pt.link()
+	return pt
+}
+
+// link forms the process object tree from the PPIDs of the processes in this
+// table. This is a simple optimization, just cutting map lookups at the
+// expense of typed pointers. We're even so lazy as to not check for the PPID
+// being present, as we'll get back a zero value anyway.
+func (pt ProcessTable) link() {
 	for _, proc := range pt {
 		if parent, ok := pt[proc.PPID]; ok {
 			proc.Parent = parent
 			parent.Children = append(parent.Children, proc)
 		}
 	}
-	// Phew: done.
-	return
+}
+
+// scope returns a process table with only the processes with the specified
+// PIDs and their descendants. Unknown PIDs are ignored. Please note that the
+// processes in the scoped table still reference their parent processes, as
+// well as any child processes which have terminated since, outside the scope.
+func (pt ProcessTable) scope(pids []PIDType) ProcessTable {
+	scoped := ProcessTable{}
+	for _, pid := range pids {
+		proc, ok := pt[pid]
+		if !ok {
+			continue
+		}
+		scoped[pid] = proc
+		for _, descendant := range pt.Descendants(proc) {
+			scoped[descendant.PID] = descendant
+		}
+	}
+	return scoped
 }
 
 // ProcessListByPID is a type alias for sorting slices of *Process by their
@@ -0,0 +1,185 @@
+// Identifies processes in a PID-reuse-safe manner, optionally holding on to
+// discovered processes using process file descriptors ("pidfds").
+
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// +build linux
+
+package lxkns
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/thediveo/lxkns/ops"
+	"golang.org/x/sys/unix"
+)
+
+// ErrProcessGone indicates that a process has terminated, or that its PID has
+// since been reused by another process.
+var ErrProcessGone = errors.New("lxkns: process is gone")
+
+// ErrNoPIDFD indicates that a process has no process file descriptor opened.
+var ErrNoPIDFD = errors.New("lxkns: process has no pidfd")
+
+// ErrForeignProcRoot indicates that a process has been discovered from a proc
+// filesystem other than the caller's /proc, so its PID might refer to a
+// different process in the caller's PID namespace.
+var ErrForeignProcRoot = errors.New("lxkns: process not discovered from /proc")
+
+// ProcessID identifies a process even across PID reuse, as well as across
+// system reboots, so it is suitable for storing outside lxkns. The PID alone
+// would be ambiguous, as PIDs get reused over time; the start time of the
+// process disambiguates between different processes with the same PID, and
+// the boot ID then disambiguates between start times of different system
+// boots.
+type ProcessID struct {
+	PID       PIDType // process identifier.
+	Starttime uint64  // time of process start, since the Kernel boot epoch.
+	BootID    string  // boot ID of the system the process ran on.
+}
+
+// String returns the process identity in textual form.
+func (id ProcessID) String() string {
+	return fmt.Sprintf("PID %d started at %d in boot %s",
+		id.PID, id.Starttime, id.BootID)
+}
+
+// ID returns the PID-reuse-safe identity of this process.
+func (p *Process) ID() ProcessID {
+	return ProcessID{PID: p.PID, Starttime: p.Starttime, BootID: p.BootID}
+}
+
+// ByID returns the process with the specified identity, or nil if there is no
+// such process in the process table. Processes with the same PID but
+// different start times or boot IDs aren't the process looked for.
+func (pt ProcessTable) ByID(id ProcessID) *Process {
+	if proc, ok := pt[id.PID]; ok && proc.ID() == id {
+		return proc
+	}
+	return nil
+}
+
+// OpenPIDFD opens a process file descriptor for this process, unless one is
+// already open. Afterwards, Valid and Signal are guaranteed to always refer to
+// the process as discovered, and never to some other process reusing its PID.
+// Returns ErrProcessGone if the process has already terminated or its PID has
+// been reused in the meantime. Please note that opening process file
+// descriptors requires a Linux kernel 5.3 or later. As PIDs are always taken
+// from the caller's PID namespace when opening process file descriptors,
+// OpenPIDFD returns ErrForeignProcRoot for processes discovered from another
+// proc filesystem than /proc, as well as for processes discovered offline
+// from a bundle.
+func (p *Process) OpenPIDFD() error {
+	if p.pidfd != nil {
+		return nil
+	}
+	if p.offline {
+		return fmt.Errorf("lxkns: cannot open pidfd for process %d from bundle: %w",
+			p.PID, ErrForeignProcRoot)
+	}
+	if p.procroot != "" && filepath.Clean(p.procroot) != "/proc" {
+		return fmt.Errorf("lxkns: cannot open pidfd for process %d from %s: %w",
+			p.PID, p.procroot, ErrForeignProcRoot)
+	}
+	fd, _, errno := unix.Syscall(unix.SYS_PIDFD_OPEN, uintptr(p.PID), 0, 0)
+	if errno != 0 {
+		if errno == unix.ESRCH {
+			return ErrProcessGone
+		}
+		return fmt.Errorf("lxkns: cannot open pidfd for process %d: %w", p.PID, errno)
+	}
+	pidfd := os.NewFile(fd, fmt.Sprintf("pidfd:%d", p.PID))
+	// Only now that we hold on to the process, we can make sure that it
+	// still is the same process we discovered, and not a newcomer reusing
+	// its PID.
+	if !p.Valid() {
+		pidfd.Close()
+		return ErrProcessGone
+	}
+	p.pidfd = pidfd
+	return nil
+}
+
+// PIDFD returns the process file descriptor of this process, or -1 if there
+// is none.
+func (p *Process) PIDFD() int {
+	if p.pidfd == nil {
+		return -1
+	}
+	return int(p.pidfd.Fd())
+}
+
+// ClosePIDFD closes the process file descriptor of this process, if any.
+func (p *Process) ClosePIDFD() error {
+	if p.pidfd == nil {
+		return nil
+	}
+	err := p.pidfd.Close()
+	p.pidfd = nil
+	return err
+}
+
+// Signal sends the specified signal to this process, using its process file
+// descriptor. Returns ErrNoPIDFD if no process file descriptor has been
+// opened, and ErrProcessGone if the process has terminated.
+func (p *Process) Signal(sig syscall.Signal) error {
+	if p.pidfd == nil {
+		return ErrNoPIDFD
+	}
+	if err := ops.PidfdSendSignal(int(p.pidfd.Fd()), sig); err != nil {
+		if errors.Is(err, unix.ESRCH) {
+			return ErrProcessGone
+		}
+		return fmt.Errorf("lxkns: cannot signal process %d: %w", p.PID, err)
+	}
+	return nil
+}
+
+// OpenPIDFDs opens process file descriptors for all processes in this process
+// table. Processes which have terminated in the meantime are skipped. Returns
+// the first other error encountered, such as when the Linux kernel doesn't
+// support process file descriptors.
+func (pt ProcessTable) OpenPIDFDs() error {
+	for _, proc := range pt {
+		if err := proc.OpenPIDFD(); err != nil && err != ErrProcessGone {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClosePIDFDs closes the process file descriptors of all processes in this
+// process table.
+func (pt ProcessTable) ClosePIDFDs() {
+	for _, proc := range pt {
+		_ = proc.ClosePIDFD()
+	}
+}
+
+// bootID returns the boot ID of the system with the proc filesystem mounted
+// at procroot, or "" if it cannot be determined.
+func bootID(procroot string) string {
+	id, err := ioutil.ReadFile(procroot + "/sys/kernel/random/boot_id")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(id))
+}
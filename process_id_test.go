@@ -0,0 +1,95 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package lxkns
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ProcessID", func() {
+
+	It("identifies processes", func() {
+		pt := newProcessTable("test/proctable/proc")
+		proc42 := pt[42]
+		id := proc42.ID()
+		Expect(id.PID).To(Equal(PIDType(42)))
+		Expect(id.Starttime).To(Equal(proc42.Starttime))
+		Expect(id.BootID).To(Equal("01234567-89ab-cdef-0123-456789abcdef"))
+		Expect(id.String()).To(ContainSubstring("PID 42"))
+		Expect(pt.ByID(id)).To(BeIdenticalTo(proc42))
+
+		reused := id
+		reused.Starttime++
+		Expect(pt.ByID(reused)).To(BeNil())
+		rebooted := id
+		rebooted.BootID = "rebooted"
+		Expect(pt.ByID(rebooted)).To(BeNil())
+		Expect(pt.ByID(ProcessID{PID: 666})).To(BeNil())
+	})
+
+	It("validates against the procfs the process was discovered from", func() {
+		proc42 := newProcessTable("test/proctable/proc")[42]
+		Expect(proc42.Valid()).To(BeTrue())
+		proc42.Starttime++
+		Expect(proc42.Valid()).To(BeFalse())
+		proc42.Starttime--
+		proc42.BootID = "rebooted"
+		Expect(proc42.Valid()).To(BeFalse())
+	})
+
+	It("refuses pidfds for processes from other proc filesystems", func() {
+		pt := newProcessTable("test/proctable/proc")
+		Expect(pt[42].OpenPIDFD()).To(MatchError(ErrForeignProcRoot))
+		Expect(pt[42].PIDFD()).To(Equal(-1))
+		Expect(pt.OpenPIDFDs()).To(MatchError(ErrForeignProcRoot))
+	})
+
+	It("holds on to processes using pidfds", func() {
+		sleepy := exec.Command("sleep", "60")
+		Expect(sleepy.Start()).To(Succeed())
+		defer func() {
+			_ = sleepy.Process.Kill()
+			_ = sleepy.Wait()
+		}()
+		opts := NoDiscovery
+		opts.SkipProcs = false
+		opts.WithPIDFDs = true
+		allns := Discover(opts)
+		defer allns.Processes.ClosePIDFDs()
+		Expect(allns.Diagnostics).To(BeEmpty())
+		Expect(allns.Processes[PIDType(os.Getpid())].BootID).NotTo(BeEmpty())
+
+		proc := allns.Processes[PIDType(sleepy.Process.Pid)]
+		Expect(proc).NotTo(BeNil())
+		Expect(proc.PIDFD()).To(BeNumerically(">=", 0))
+		Expect(proc.OpenPIDFD()).To(Succeed())
+		Expect(proc.Valid()).To(BeTrue())
+		Expect(proc.Signal(syscall.SIGKILL)).To(Succeed())
+		_ = sleepy.Wait()
+		Expect(proc.Valid()).To(BeFalse())
+		Expect(proc.Signal(syscall.SIGKILL)).To(Equal(ErrProcessGone))
+
+		Expect(proc.ClosePIDFD()).To(Succeed())
+		Expect(proc.PIDFD()).To(Equal(-1))
+		Expect(proc.Signal(0)).To(Equal(ErrNoPIDFD))
+		Expect(proc.OpenPIDFD()).To(Equal(ErrProcessGone))
+	})
+
+})
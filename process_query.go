@@ -0,0 +1,171 @@
+// Queries process tables for processes by name, user, namespaces, and
+// process tree relationships.
+
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// +build linux
+
+package lxkns
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The query methods of ProcessTable only rely on the PIDs and PPIDs of
+// processes, as well as on the types and identifiers of namespaces, but not
+// on the Parent and Children process object references, nor on the identity
+// of namespace objects. This way, they work on deserialized discovery results
+// as well as on live ones.
+
+// Sorted returns all processes of this process table, sorted by their PIDs
+// in ascending order.
+func (pt ProcessTable) Sorted() []*Process {
+	return pt.Filter(func(*Process) bool { return true })
+}
+
+// Filter returns the processes for which the specified filter function
+// returns true, sorted by their PIDs in ascending order.
+func (pt ProcessTable) Filter(filter func(proc *Process) bool) []*Process {
+	procs := []*Process{}
+	for _, proc := range pt {
+		if filter(proc) {
+			procs = append(procs, proc)
+		}
+	}
+	sort.Sort(ProcessListByPID(procs))
+	return procs
+}
+
+// ByName returns the processes with names matching the specified regular
+// expression, sorted by PIDs.
+func (pt ProcessTable) ByName(re *regexp.Regexp) []*Process {
+	return pt.Filter(func(proc *Process) bool {
+		return re.MatchString(proc.Name)
+	})
+}
+
+// ByBasename returns the processes with executable basenames matching the
+// specified regular expression, sorted by PIDs; see also Process.Basename.
+func (pt ProcessTable) ByBasename(re *regexp.Regexp) []*Process {
+	return pt.Filter(func(proc *Process) bool {
+		return re.MatchString(proc.Basename())
+	})
+}
+
+// ByCmdline returns the processes with command lines matching the specified
+// regular expression, sorted by PIDs. The command line arguments are joined
+// using single spaces before matching.
+func (pt ProcessTable) ByCmdline(re *regexp.Regexp) []*Process {
+	return pt.Filter(func(proc *Process) bool {
+		return re.MatchString(strings.Join(proc.Cmdline, " "))
+	})
+}
+
+// ByUID returns the processes with either the specified real or effective
+// user ID, sorted by PIDs. As user IDs are only known when the process status
+// has been discovered, processes without status never match; see also
+// DiscoverOpts.WithProcessStatus.
+func (pt ProcessTable) ByUID(uid uint32) []*Process {
+	return pt.Filter(func(proc *Process) bool {
+		return proc.Status != nil && (proc.Status.UID == uid || proc.Status.EUID == uid)
+	})
+}
+
+// InNamespace returns the processes joined to the specified namespace, sorted
+// by PIDs. In contrast to Namespace.Leaders, this returns all processes
+// joined to the namespace, not only the topmost ones.
+func (pt ProcessTable) InNamespace(ns Namespace) []*Process {
+	idx := TypeIndex(ns.Type())
+	if idx < 0 {
+		return []*Process{}
+	}
+	return pt.Filter(func(proc *Process) bool {
+		return sameNamespace(proc.Namespaces[idx], ns)
+	})
+}
+
+// SameNamespaces returns the processes joined to exactly the same namespaces
+// as the specified process, including this process itself, sorted by PIDs.
+func (pt ProcessTable) SameNamespaces(proc *Process) []*Process {
+	return pt.Filter(func(other *Process) bool {
+		return SameNamespaces(other.Namespaces, proc.Namespaces)
+	})
+}
+
+// Ancestors returns the ancestor processes of the specified process, starting
+// with its parent process and ending with the topmost ancestor in this process
+// table.
+func (pt ProcessTable) Ancestors(proc *Process) []*Process {
+	ancestors := []*Process{}
+	seen := map[PIDType]bool{proc.PID: true}
+	for {
+		parent, ok := pt[proc.PPID]
+		if !ok || seen[parent.PID] {
+			return ancestors
+		}
+		seen[parent.PID] = true
+		ancestors = append(ancestors, parent)
+		proc = parent
+	}
+}
+
+// Descendants returns the descendant processes of the specified process in
+// depth-first order, with siblings sorted by PIDs. The process itself is not
+// included.
+func (pt ProcessTable) Descendants(proc *Process) []*Process {
+	children := map[PIDType][]*Process{}
+	for _, p := range pt.Sorted() {
+		if p.PPID != p.PID {
+			children[p.PPID] = append(children[p.PPID], p)
+		}
+	}
+	descendants := []*Process{}
+	seen := map[PIDType]bool{proc.PID: true}
+	var descend func(pid PIDType)
+	descend = func(pid PIDType) {
+		for _, child := range children[pid] {
+			if seen[child.PID] {
+				continue
+			}
+			seen[child.PID] = true
+			descendants = append(descendants, child)
+			descend(child.PID)
+		}
+	}
+	descend(proc.PID)
+	return descendants
+}
+
+// SameNamespaces returns true if both sets of namespaces contain the same
+// namespaces, based on their types and identifiers.
+func SameNamespaces(a, b NamespacesSet) bool {
+	for idx := range a {
+		if !sameNamespace(a[idx], b[idx]) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameNamespace returns true if both namespaces have the same type and
+// identifier, or if both are nil.
+func sameNamespace(a, b Namespace) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Type() == b.Type() && a.ID() == b.ID()
+}
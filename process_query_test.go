@@ -0,0 +1,104 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package lxkns
+
+import (
+	"os"
+	"regexp"
+
+	"github.com/thediveo/lxkns/species"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ProcessTable queries", func() {
+
+	// A process table as if deserialized: without process object references
+	// and with separate namespace objects for the same namespaces.
+	var pt ProcessTable
+
+	BeforeEach(func() {
+		netns := func(id uint64) Namespace {
+			return NewNamespace(species.CLONE_NEWNET, species.NamespaceID{Dev: 1, Ino: id}, "")
+		}
+		pt = ProcessTable{}
+		for _, proc := range []*Process{
+			{PID: 1, PPID: 0, Name: "init", Cmdline: []string{"/sbin/init", "splash"}},
+			{PID: 42, PPID: 1, Name: "foo", Cmdline: []string{"/usr/bin/foo", "--bar"}},
+			{PID: 43, PPID: 42, Name: "bar", Cmdline: []string{"bar"}},
+			{PID: 44, PPID: 42, Name: "baz"},
+			{PID: 666, PPID: 43, Name: "foo"},
+		} {
+			pt[proc.PID] = proc
+		}
+		pt[1].Namespaces[NetNS] = netns(1)
+		pt[42].Namespaces[NetNS] = netns(1)
+		pt[43].Namespaces[NetNS] = netns(2)
+		pt[44].Namespaces[NetNS] = netns(1)
+		pt[666].Namespaces[NetNS] = netns(2)
+		pt[42].Status = &ProcessStatus{UID: 1000, EUID: 0}
+		pt[43].Status = &ProcessStatus{UID: 1000, EUID: 1000}
+	})
+
+	pids := func(procs []*Process) []PIDType {
+		pids := []PIDType{}
+		for _, proc := range procs {
+			pids = append(pids, proc.PID)
+		}
+		return pids
+	}
+
+	It("iterates in PID order", func() {
+		Expect(pids(pt.Sorted())).To(Equal([]PIDType{1, 42, 43, 44, 666}))
+		Expect(pids(ProcessTable{}.Sorted())).To(BeEmpty())
+	})
+
+	It("finds by names and command lines", func() {
+		Expect(pids(pt.ByName(regexp.MustCompile(`^foo$`)))).To(Equal([]PIDType{42, 666}))
+		Expect(pids(pt.ByBasename(regexp.MustCompile(`^(foo|init)$`)))).To(Equal([]PIDType{1, 42, 666}))
+		Expect(pids(pt.ByCmdline(regexp.MustCompile(`foo --bar`)))).To(Equal([]PIDType{42}))
+	})
+
+	It("finds by UIDs", func() {
+		Expect(pids(pt.ByUID(1000))).To(Equal([]PIDType{42, 43}))
+		Expect(pids(pt.ByUID(0))).To(Equal([]PIDType{42}))
+		Expect(pids(pt.ByUID(1))).To(BeEmpty())
+	})
+
+	It("finds by namespaces", func() {
+		netns := NewNamespace(species.CLONE_NEWNET, species.NamespaceID{Dev: 1, Ino: 2}, "")
+		Expect(pids(pt.InNamespace(netns))).To(Equal([]PIDType{43, 666}))
+		Expect(pids(pt.SameNamespaces(pt[42]))).To(Equal([]PIDType{1, 42, 44}))
+		Expect(SameNamespaces(pt[1].Namespaces, pt[43].Namespaces)).To(BeFalse())
+		Expect(SameNamespaces(NamespacesSet{}, NamespacesSet{})).To(BeTrue())
+	})
+
+	It("finds ancestors and descendants", func() {
+		Expect(pids(pt.Ancestors(pt[666]))).To(Equal([]PIDType{43, 42, 1}))
+		Expect(pids(pt.Ancestors(pt[1]))).To(BeEmpty())
+		Expect(pids(pt.Descendants(pt[1]))).To(Equal([]PIDType{42, 43, 666, 44}))
+		Expect(pids(pt.Descendants(pt[44]))).To(BeEmpty())
+	})
+
+	It("queries live process tables", func() {
+		allns := Discover(FullDiscovery)
+		me := allns.Processes[PIDType(os.Getpid())]
+		Expect(allns.Processes.Ancestors(me)[0]).To(BeIdenticalTo(me.Parent))
+		Expect(allns.Processes.SameNamespaces(me)).To(ContainElement(me))
+		Expect(allns.Processes.InNamespace(me.Namespaces[NetNS])).To(ContainElement(me))
+	})
+
+})
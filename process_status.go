@@ -0,0 +1,216 @@
+// Reads additional process details from the proc filesystem, such as
+// credentials and capabilities, beyond what namespace discovery needs.
+
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// +build linux
+
+package lxkns
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ProcessStatus describes the credentials, capabilities, and some further
+// state of a process, as read from the proc filesystem.
+type ProcessStatus struct {
+	State      ProcessState  // run state of the process.
+	UID        uint32        // real user ID.
+	EUID       uint32        // effective user ID.
+	GID        uint32        // real group ID.
+	EGID       uint32        // effective group ID.
+	Threads    int           // number of threads (tasks).
+	CapEff     CapabilitySet // effective capabilities.
+	CapPrm     CapabilitySet // permitted capabilities.
+	CapBnd     CapabilitySet // capabilities bounding set.
+	NoNewPrivs bool          // no_new_privs bit set?
+	Seccomp    SeccompMode   // seccomp mode of the process.
+	Exe        string        // path of the executable, if accessible.
+	Cwd        string        // path of the current working directory, if accessible.
+	Root       string        // path of the root directory, if accessible.
+}
+
+// ProcessState is the run state of a process, such as running, sleeping,
+// zombie, et cetera.
+type ProcessState byte
+
+// The run states of processes, as shown in /proc/[PID]/status.
+const (
+	ProcessRunning     ProcessState = 'R'
+	ProcessSleeping    ProcessState = 'S'
+	ProcessDiskSleep   ProcessState = 'D'
+	ProcessStopped     ProcessState = 'T'
+	ProcessTracingStop ProcessState = 't'
+	ProcessDead        ProcessState = 'X'
+	ProcessZombie      ProcessState = 'Z'
+	ProcessParked      ProcessState = 'P'
+	ProcessIdle        ProcessState = 'I'
+)
+
+// processStateNames maps process states to the names given to them by the
+// Linux kernel.
+var processStateNames = map[ProcessState]string{
+	ProcessRunning:     "running",
+	ProcessSleeping:    "sleeping",
+	ProcessDiskSleep:   "disk sleep",
+	ProcessStopped:     "stopped",
+	ProcessTracingStop: "tracing stop",
+	ProcessDead:        "dead",
+	ProcessZombie:      "zombie",
+	ProcessParked:      "parked",
+	ProcessIdle:        "idle",
+}
+
+// String returns the process state in the same format as the Linux kernel
+// does, such as "S (sleeping)".
+func (s ProcessState) String() string {
+	if name, ok := processStateNames[s]; ok {
+		return fmt.Sprintf("%c (%s)", s, name)
+	}
+	return fmt.Sprintf("%c", s)
+}
+
+// CapabilitySet is a set of Linux capabilities, with bit n representing
+// capability n, such as CAP_SYS_ADMIN (21).
+type CapabilitySet uint64
+
+// Has returns true if the capability set contains the specified capability.
+func (c CapabilitySet) Has(capability int) bool {
+	return capability >= 0 && capability < 64 && c&(1<<uint(capability)) != 0
+}
+
+// String returns the capability set in the same hexadecimal format as the
+// Linux kernel does.
+func (c CapabilitySet) String() string {
+	return fmt.Sprintf("%016x", uint64(c))
+}
+
+// SeccompMode is the seccomp mode of a process.
+type SeccompMode int
+
+// The seccomp modes of processes.
+const (
+	SeccompDisabled SeccompMode = iota // SECCOMP_MODE_DISABLED
+	SeccompStrict                      // SECCOMP_MODE_STRICT
+	SeccompFilter                      // SECCOMP_MODE_FILTER
+)
+
+// String returns a textual representation of the seccomp mode.
+func (m SeccompMode) String() string {
+	switch m {
+	case SeccompDisabled:
+		return "disabled"
+	case SeccompStrict:
+		return "strict"
+	case SeccompFilter:
+		return "filter"
+	}
+	return fmt.Sprintf("SeccompMode(%d)", int(m))
+}
+
+// NewProcessStatus returns the status details of the process with the
+// specified PID, read from the proc filesystem mounted at procroot; an empty
+// procroot defaults to "/proc". The paths of the executable, working and root
+// directories are left empty when they cannot be read, such as due to lack of
+// privileges.
+func NewProcessStatus(PID PIDType, procroot string) (*ProcessStatus, error) {
+	if procroot == "" {
+		procroot = "/proc"
+	}
+	procbase := procroot + "/" + strconv.Itoa(int(PID))
+	f, err := os.Open(procbase + "/status")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	status := &ProcessStatus{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		if err := status.parse(fields[0], strings.TrimSpace(fields[1])); err != nil {
+			return nil, fmt.Errorf("lxkns: invalid %s status of process %d: %w",
+				fields[0], PID, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	status.Exe, _ = os.Readlink(procbase + "/exe")
+	status.Cwd, _ = os.Readlink(procbase + "/cwd")
+	status.Root, _ = os.Readlink(procbase + "/root")
+	return status, nil
+}
+
+// parse parses a single field of a process status, ignoring fields of no
+// interest.
+func (s *ProcessStatus) parse(name string, value string) (err error) {
+	switch name {
+	case "State":
+		if value == "" {
+			return fmt.Errorf("empty state")
+		}
+		s.State = ProcessState(value[0])
+	case "Uid":
+		s.UID, s.EUID, err = ids(value)
+	case "Gid":
+		s.GID, s.EGID, err = ids(value)
+	case "Threads":
+		s.Threads, err = strconv.Atoi(value)
+	case "CapEff":
+		s.CapEff, err = capabilities(value)
+	case "CapPrm":
+		s.CapPrm, err = capabilities(value)
+	case "CapBnd":
+		s.CapBnd, err = capabilities(value)
+	case "NoNewPrivs":
+		s.NoNewPrivs = value == "1"
+	case "Seccomp":
+		var mode int
+		mode, err = strconv.Atoi(value)
+		s.Seccomp = SeccompMode(mode)
+	}
+	return
+}
+
+// ids returns the real and effective IDs from a "Uid:" or "Gid:" status
+// field, which lists the real, effective, saved set, and filesystem IDs.
+func ids(value string) (real uint32, effective uint32, err error) {
+	fields := strings.Fields(value)
+	if len(fields) < 2 {
+		return 0, 0, fmt.Errorf("missing IDs in %q", value)
+	}
+	r, err := strconv.ParseUint(fields[0], 10, 32)
+	if err != nil {
+		return
+	}
+	e, err := strconv.ParseUint(fields[1], 10, 32)
+	if err != nil {
+		return
+	}
+	return uint32(r), uint32(e), nil
+}
+
+// capabilities returns the capability set from a hexadecimal status field.
+func capabilities(value string) (CapabilitySet, error) {
+	caps, err := strconv.ParseUint(value, 16, 64)
+	return CapabilitySet(caps), err
+}
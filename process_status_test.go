@@ -0,0 +1,83 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package lxkns
+
+import (
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ProcessStatus", func() {
+
+	It("reads process status details", func() {
+		status, err := NewProcessStatus(42, "test/procstatus/proc")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*status).To(Equal(ProcessStatus{
+			State:      ProcessSleeping,
+			UID:        1000,
+			EUID:       0,
+			GID:        1001,
+			EGID:       1002,
+			Threads:    3,
+			CapEff:     1 << 21,
+			CapPrm:     0x3fffffffff,
+			CapBnd:     0x1ffffffffff,
+			NoNewPrivs: true,
+			Seccomp:    SeccompFilter,
+			Exe:        "/usr/bin/foo",
+			Cwd:        "/home/foo",
+			Root:       "/",
+		}))
+		Expect(status.CapEff.Has(21)).To(BeTrue())
+		Expect(status.CapEff.Has(0)).To(BeFalse())
+		Expect(status.CapEff.Has(64)).To(BeFalse())
+		Expect(status.CapEff.String()).To(Equal("0000000000200000"))
+		Expect(status.State.String()).To(Equal("S (sleeping)"))
+		Expect(ProcessState('?').String()).To(Equal("?"))
+		Expect(status.Seccomp.String()).To(Equal("filter"))
+		Expect(SeccompMode(42).String()).To(Equal("SeccompMode(42)"))
+	})
+
+	It("rejects invalid process status", func() {
+		_, err := NewProcessStatus(666, "test/procstatus/proc")
+		Expect(err).To(MatchError(ContainSubstring("invalid Uid status of process 666")))
+		_, err = NewProcessStatus(-1, "test/procstatus/proc")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("discovers process status only when asked to", func() {
+		opts := NoDiscovery
+		opts.SkipProcs = false
+		allns := Discover(opts)
+		me := allns.Processes[PIDType(os.Getpid())]
+		Expect(me.Status).To(BeNil())
+
+		opts.WithProcessStatus = true
+		allns = Discover(opts)
+		me = allns.Processes[PIDType(os.Getpid())]
+		Expect(me.Status).NotTo(BeNil())
+		Expect(me.Status.UID).To(Equal(uint32(os.Getuid())))
+		Expect(me.Status.EGID).To(Equal(uint32(os.Getegid())))
+		Expect(me.Status.State).NotTo(BeZero())
+		Expect(me.Status.Threads).To(BeNumerically(">", 1))
+		exe, _ := os.Executable()
+		Expect(me.Status.Exe).To(Equal(exe))
+		wd, _ := os.Getwd()
+		Expect(me.Status.Cwd).To(Equal(wd))
+	})
+
+})
@@ -46,12 +46,19 @@ var _ = Describe("Process", func() {
 		}
 	})
 
+	It("attaches labels", func() {
+		p := &Process{}
+		p.SetLabel("foo", "bar")
+		p.SetLabel("foo", "baz")
+		Expect(p.Labels).To(Equal(map[string]string{"foo": "baz"}))
+	})
+
 	It("cannot be created for non-existing process/PID", func() {
 		Expect(NewProcess(0)).To(BeNil())
 	})
 
 	It("skips broken process stat", func() {
-		Expect(newProcess(1, "test/proctable/kaputt")).To(BeNil())
+		Expect(newProcess(1, "test/proctable/kaputt", "")).To(BeNil())
 	})
 
 	It("properties are read from /proc/[PID]", func() {
@@ -80,25 +87,25 @@ var _ = Describe("Process", func() {
 	})
 
 	It("gets basename and command line", func() {
-		proc42 := newProcess(PIDType(42), "test/proctable/proc")
+		proc42 := newProcess(PIDType(42), "test/proctable/proc", "")
 		Expect(proc42.Cmdline).To(HaveLen(3))
 		Expect(proc42.Basename()).To(Equal("mumble.exe"))
 		Expect(proc42.Cmdline[2], "arg2")
 
 		// $0 doesn't contain any "/"
-		proc667 := newProcess(PIDType(667), "test/proctable/kaputt")
+		proc667 := newProcess(PIDType(667), "test/proctable/kaputt", "")
 		Expect(proc667.Basename()).To(Equal("mumble.exe"))
 	})
 
 	It("falls back on process name", func() {
 		// Please note that our synthetic PID 1 has no command line, but only
 		// a process name in its stat file.
-		proc1 := newProcess(PIDType(1), "test/proctable/proc")
+		proc1 := newProcess(PIDType(1), "test/proctable/proc", "")
 		Expect(proc1.Basename()).To(Equal("init"))
 	})
 
 	It("synthesizes basename if all else fails", func() {
-		proc := newProcess(PIDType(666), "test/proctable/kaputt")
+		proc := newProcess(PIDType(666), "test/proctable/kaputt", "")
 		Expect(proc.Basename()).To(Equal("process (666)"))
 	})
 
@@ -1,4 +1,6 @@
-// Simple wrapper for reexec.ForkReexec() which accepts lxkns Namespaces.
+// Forks and re-executes this process in order to run actions in different
+// Linux kernel namespaces, accepting lxkns Namespaces and reporting failures
+// in structured form.
 
 // Copyright 2020 Harald Albrecht.
 //
@@ -16,12 +18,124 @@
 
 package lxkns
 
-import "github.com/thediveo/gons/reexec"
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/thediveo/gons"
+	"github.com/thediveo/lxkns/species"
+)
+
+// DefaultReexecTimeout is the time a re-executed child process gets for
+// switching namespaces, running its action, and sending back its result,
+// unless specified otherwise.
+var DefaultReexecTimeout = 10 * time.Second
+
+// ReexecFailure classifies the ways in which a re-executed action can fail.
+type ReexecFailure int
+
+// The failure classes of re-executed actions.
+const (
+	ReexecStartFailure   ReexecFailure = iota // the child could not be started at all.
+	ReexecSetnsFailure                        // the child could not switch into the namespaces.
+	ReexecActionFailure                       // the action failed, such as by panicking.
+	ReexecDecodeFailure                       // the action's result could not be decoded.
+	ReexecTimeoutFailure                      // the child didn't terminate in time.
+)
+
+// String returns a human-readable description of a failure class.
+func (f ReexecFailure) String() string {
+	switch f {
+	case ReexecStartFailure:
+		return "cannot start child"
+	case ReexecSetnsFailure:
+		return "cannot switch namespaces"
+	case ReexecActionFailure:
+		return "action failed"
+	case ReexecDecodeFailure:
+		return "cannot decode result"
+	case ReexecTimeoutFailure:
+		return "timed out"
+	}
+	return fmt.Sprintf("ReexecFailure(%d)", int(f))
+}
+
+// ReexecError describes a failed re-execution of an action, giving the class
+// of failure as well as what the child process told us on stderr.
+type ReexecError struct {
+	Action string        // name of the action to be run in the re-executed child.
+	Kind   ReexecFailure // the class of failure.
+	Stderr string        // stderr output of the child, if any.
+	Err    error         // the underlying error, if any.
+}
+
+// Error returns a description of the failed re-execution, including the
+// child's stderr output, if any.
+func (e *ReexecError) Error() string {
+	msg := fmt.Sprintf("lxkns: re-executing action %q: %s", e.Action, e.Kind)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	if e.Stderr != "" {
+		msg += fmt.Sprintf(", child stderr: %q", e.Stderr)
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error.
+func (e *ReexecError) Unwrap() error { return e.Err }
+
+// Timeout returns true if the re-executed child didn't terminate in time.
+func (e *ReexecError) Timeout() bool { return e.Kind == ReexecTimeoutFailure }
+
+// reexecTimeout returns the time re-executed children get during a
+// discovery, as set in the discovery options.
+func reexecTimeout(result *DiscoveryResult) time.Duration {
+	if result.Options.ReexecTimeout <= 0 {
+		return DefaultReexecTimeout
+	}
+	return result.Options.ReexecTimeout
+}
+
+// reexecActionEnvVar tells a re-executed child which registered gons/reexec
+// action to run, as checked by reexec.CheckAction(). We re-execute children
+// ourselves instead of using gons' ForkReexecEnv, as we need to control the
+// child process in order to kill it when running late, to stream its stdin
+// and stdout, and to get its exit code and stderr output.
+const reexecActionEnvVar = "gons_reexec_action"
+
+// reexecSetnsExitCode is the exit code of a re-executed child which failed to
+// switch into the namespaces requested.
+const reexecSetnsExitCode = 3
+
+// Check early in a re-executed child whether gons failed to switch into the
+// namespaces requested. In this case, tell our parent via the child's exit
+// code, before gons' reexec.CheckAction() gets a chance to panic.
+func init() {
+	if os.Getenv(reexecActionEnvVar) == "" {
+		return
+	}
+	if err := gons.Status(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(reexecSetnsExitCode)
+	}
+}
 
 // ReexecIntoAction forks and then re-executes this process in order to run a
 // specific action (indicated by actionname) in a set of (different) Linux
 // kernel namespaces. The stdout result of running the action is then
-// deserialized as JSON into the specified result element.
+// deserialized as JSON into the specified result element. The child gets
+// DefaultReexecTimeout time to finish.
 func ReexecIntoAction(actionname string, namespaces []Namespace, result interface{}) (err error) {
 	return ReexecIntoActionEnv(actionname, namespaces, nil, result)
 }
@@ -30,12 +144,179 @@ func ReexecIntoAction(actionname string, namespaces []Namespace, result interfac
 // a specific action (indicated by actionname) in a set of (different) Linux
 // kernel namespaces. It also passes the additional environment variables
 // specified in envvars. The stdout result of running the action is then
-// deserialized as JSON into the specified result element.
+// deserialized as JSON into the specified result element. The child gets
+// DefaultReexecTimeout time to finish.
 func ReexecIntoActionEnv(actionname string, namespaces []Namespace, envvars []string, result interface{}) (err error) {
-	rexns := make([]reexec.Namespace, len(namespaces))
-	for idx := range namespaces {
-		rexns[idx].Type = "!" + namespaces[idx].Type().Name()
-		rexns[idx].Path = namespaces[idx].Ref()
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultReexecTimeout)
+	defer cancel()
+	return ReexecIntoActionContext(ctx, actionname, namespaces, envvars, result)
+}
+
+// ReexecIntoActionContext forks and then re-executes this process in order to
+// run a specific action (indicated by actionname) in a set of (different)
+// Linux kernel namespaces, passing the additional environment variables
+// specified in envvars. The stdout result of running the action is then
+// deserialized as JSON into the specified result element. If the context is
+// done before the child has terminated, then the child gets killed.
+//
+// Failures are reported as *ReexecError, telling apart children failing to
+// switch namespaces from actions failing and results failing to decode.
+//
+// Applications must call gons' reexec.CheckAction() early in their main(), as
+// otherwise the re-executed child would run the application instead of the
+// action.
+func ReexecIntoActionContext(ctx context.Context, actionname string, namespaces []Namespace, envvars []string, result interface{}) (err error) {
+	// Only decode the first JSON value, as under test the child might add
+	// some test runner chatter after the result.
+	return forkReexec(ctx, actionname, namespaces, envvars, nil,
+		func(r io.Reader) error {
+			return json.NewDecoder(r).Decode(result)
+		})
+}
+
+// forkReexec forks and re-executes this process in order to run the specified
+// action in the specified namespaces, passing the additional environment
+// variables to the child. The child reads its stdin from the specified
+// reader, if any, while its stdout is passed to the decode function as the
+// child produces its output. If the context is done before the child has
+// terminated, then the child gets killed.
+//
+// Under test, the child is told to not run any tests, but only the action.
+// Please note that coverage profile data of re-executed children isn't
+// gathered.
+func forkReexec(ctx context.Context, actionname string, namespaces []Namespace, envvars []string, stdin io.Reader, decode func(io.Reader) error) error {
+	// Safeguard against recursively re-executing ourselves: this happens when
+	// an application forgot to call reexec.CheckAction() and thus the child
+	// is running the application once more, instead of the action.
+	if os.Getenv(reexecActionEnvVar) != "" {
+		return &ReexecError{
+			Action: actionname,
+			Kind:   ReexecStartFailure,
+			Err:    errors.New("already running in a re-executed child"),
+		}
+	}
+	child := exec.Command("/proc/self/exe", testingArgs()...)
+	child.Env = append(os.Environ(), envvars...)
+	// Pass the namespaces the child should switch into via its environment,
+	// as documented by gons. The "!" tells gons to open all namespace
+	// references before switching any namespace, as the references are
+	// relative to our current mount namespace.
+	namespaces = enterOrder(namespaces)
+	order := make([]string, len(namespaces))
+	for idx, ns := range namespaces {
+		order[idx] = "!" + ns.Type().Name()
+		child.Env = append(child.Env,
+			fmt.Sprintf("gons_%s=%s", ns.Type().Name(), ns.Ref()))
+	}
+	child.Env = append(child.Env,
+		"gons_order="+strings.Join(order, ","),
+		reexecActionEnvVar+"="+actionname)
+	child.Stdin = stdin
+	var stderr bytes.Buffer
+	child.Stderr = &stderr
+	stdout, err := child.StdoutPipe()
+	if err != nil {
+		return &ReexecError{Action: actionname, Kind: ReexecStartFailure, Err: err}
+	}
+	if err := child.Start(); err != nil {
+		return &ReexecError{Action: actionname, Kind: ReexecStartFailure, Err: err}
+	}
+	// Decode the child's output as it flows in, but then drain the remaining
+	// output, as we must not wait for the child before having read all of it.
+	decoded := make(chan error, 1)
+	go func() {
+		err := decode(stdout)
+		_, _ = io.Copy(ioutil.Discard, stdout)
+		decoded <- err
+	}()
+	var decodeerr error
+	select {
+	case decodeerr = <-decoded:
+	case <-ctx.Done():
+		_ = child.Process.Kill()
+		decodeerr = <-decoded
+	}
+	// The child might still linger after having closed its stdout, so we
+	// might need to kill it while waiting for it.
+	waited := make(chan error, 1)
+	go func() {
+		waited <- child.Wait()
+	}()
+	var waiterr error
+	select {
+	case waiterr = <-waited:
+	case <-ctx.Done():
+		_ = child.Process.Kill()
+		waiterr = <-waited
+	}
+	if ctx.Err() != nil && waiterr != nil {
+		return &ReexecError{
+			Action: actionname,
+			Kind:   ReexecTimeoutFailure,
+			Stderr: stderr.String(),
+			Err:    ctx.Err(),
+		}
+	}
+	var exiterr *exec.ExitError
+	if errors.As(waiterr, &exiterr) && exiterr.ExitCode() == reexecSetnsExitCode {
+		return &ReexecError{
+			Action: actionname,
+			Kind:   ReexecSetnsFailure,
+			Stderr: stderr.String(),
+			Err:    errors.New(strings.TrimSpace(stderr.String())),
+		}
+	}
+	if waiterr != nil {
+		return &ReexecError{
+			Action: actionname,
+			Kind:   ReexecActionFailure,
+			Stderr: stderr.String(),
+			Err:    waiterr,
+		}
+	}
+	// If there's no result but some complaint on stderr, then the action
+	// failed without telling us via its exit code, such as when panicking
+	// under test.
+	if decodeerr != nil {
+		kind := ReexecDecodeFailure
+		if stderr.Len() != 0 {
+			kind = ReexecActionFailure
+		}
+		return &ReexecError{
+			Action: actionname,
+			Kind:   kind,
+			Stderr: stderr.String(),
+			Err:    decodeerr,
+		}
+	}
+	return nil
+}
+
+// enterOrder returns the namespaces in the order in which a re-executed child
+// needs to enter them: user namespaces come first, so that the child gains
+// the capabilities to enter the other namespaces owned by them. Otherwise,
+// the order of the namespaces is kept.
+func enterOrder(namespaces []Namespace) []Namespace {
+	ordered := make([]Namespace, 0, len(namespaces))
+	for _, ns := range namespaces {
+		if ns.Type() == species.CLONE_NEWUSER {
+			ordered = append(ordered, ns)
+		}
+	}
+	for _, ns := range namespaces {
+		if ns.Type() != species.CLONE_NEWUSER {
+			ordered = append(ordered, ns)
+		}
+	}
+	return ordered
+}
+
+// testingArgs returns the command line arguments for the re-executed child
+// when running under "go test": the child then must not run any tests, but
+// only the action.
+func testingArgs() []string {
+	if flag.Lookup("test.run") == nil {
+		return nil
 	}
-	return reexec.ForkReexecEnv(actionname, rexns, envvars, result)
+	return []string{"-test.run=^$"}
 }
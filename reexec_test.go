@@ -0,0 +1,114 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lxkns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thediveo/gons/reexec"
+	"github.com/thediveo/lxkns/species"
+)
+
+func init() {
+	reexec.Register("lxkns-test-answer", func() {
+		fmt.Println(`{"answer":42}`)
+	})
+	reexec.Register("lxkns-test-panic", func() {
+		panic("D'OH!")
+	})
+	reexec.Register("lxkns-test-garbage", func() {
+		fmt.Println("garbage")
+	})
+	reexec.Register("lxkns-test-sleep", func() {
+		time.Sleep(10 * time.Second)
+	})
+}
+
+var _ = Describe("reexec", func() {
+
+	var result struct {
+		Answer int `json:"answer"`
+	}
+
+	reexecError := func(err error) *ReexecError {
+		var rerr *ReexecError
+		ExpectWithOffset(1, errors.As(err, &rerr)).To(BeTrue(), "not a ReexecError: %v", err)
+		return rerr
+	}
+
+	It("runs an action", func() {
+		Expect(ReexecIntoAction("lxkns-test-answer", nil, &result)).To(Succeed())
+		Expect(result.Answer).To(Equal(42))
+	})
+
+	It("reports failing to switch namespaces", func() {
+		netns := NewNamespace(species.CLONE_NEWNET, species.NamespaceID{}, "/nowhere/ns/net")
+		err := ReexecIntoAction("lxkns-test-answer", []Namespace{netns}, &result)
+		rerr := reexecError(err)
+		Expect(rerr.Kind).To(Equal(ReexecSetnsFailure))
+		Expect(rerr.Action).To(Equal("lxkns-test-answer"))
+		Expect(rerr.Unwrap()).To(MatchError(ContainSubstring("/nowhere/ns/net")))
+		Expect(err.Error()).To(ContainSubstring("cannot switch namespaces"))
+	})
+
+	It("reports failing actions", func() {
+		rerr := reexecError(ReexecIntoAction("lxkns-test-panic", nil, &result))
+		Expect(rerr.Kind).To(Equal(ReexecActionFailure))
+		Expect(rerr.Stderr).To(ContainSubstring("D'OH!"))
+	})
+
+	It("reports unregistered actions", func() {
+		rerr := reexecError(ReexecIntoAction("lxkns-test-nada", nil, &result))
+		Expect(rerr.Kind).To(Equal(ReexecActionFailure))
+		Expect(rerr.Stderr).To(ContainSubstring("unregistered"))
+	})
+
+	It("refuses to re-execute re-executed children", func() {
+		defer os.Unsetenv(reexecActionEnvVar)
+		os.Setenv(reexecActionEnvVar, "lxkns-test-answer")
+		rerr := reexecError(ReexecIntoAction("lxkns-test-answer", nil, &result))
+		Expect(rerr.Kind).To(Equal(ReexecStartFailure))
+		Expect(rerr.Unwrap()).To(MatchError(ContainSubstring("re-executed child")))
+	})
+
+	It("reports undecodable results", func() {
+		rerr := reexecError(ReexecIntoAction("lxkns-test-garbage", nil, &result))
+		Expect(rerr.Kind).To(Equal(ReexecDecodeFailure))
+		Expect(rerr.Unwrap()).To(HaveOccurred())
+	})
+
+	It("kills children running late", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		rerr := reexecError(ReexecIntoActionContext(ctx, "lxkns-test-sleep", nil, nil, &result))
+		Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+		Expect(rerr.Kind).To(Equal(ReexecTimeoutFailure))
+		Expect(rerr.Timeout()).To(BeTrue())
+		Expect(errors.Is(rerr, context.DeadlineExceeded)).To(BeTrue())
+	})
+
+	It("describes failure classes", func() {
+		Expect(ReexecTimeoutFailure.String()).To(Equal("timed out"))
+		Expect(ReexecFailure(666).String()).To(Equal("ReexecFailure(666)"))
+	})
+
+})
@@ -0,0 +1,175 @@
+// Infers "sandboxes", such as containers, from processes sharing the same
+// namespaces.
+
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// +build linux
+
+package lxkns
+
+import (
+	"sort"
+
+	"github.com/thediveo/lxkns/species"
+)
+
+// Sandbox is a group of processes which are all joined to exactly the same
+// set of namespaces. Users rather tend to think in terms of containers,
+// instead of individual namespaces; sandboxes approximate containers without
+// needing to know about specific container engines.
+type Sandbox struct {
+	Name       string            // name of the sandbox.
+	Namespaces NamespacesSet     // the namespaces shared by all processes of this sandbox.
+	Processes  []*Process        // processes of this sandbox, sorted by PID.
+	Ealdorman  *Process          // most senior process of this sandbox.
+	Labels     map[string]string // labels of the namespaces and the ealdorman.
+}
+
+// SharedNamespace is a namespace shared between multiple sandboxes, such as a
+// network namespace shared between the containers of a Kubernetes pod.
+type SharedNamespace struct {
+	Namespace Namespace  // namespace shared.
+	Sandboxes []*Sandbox // sandboxes sharing the namespace.
+}
+
+// Sandboxes groups the processes of the specified process table into
+// sandboxes, with each sandbox consisting of the processes joined to exactly
+// the same namespaces. Processes without any namespace information, such as
+// when lacking privileges for discovering them, don't belong to any sandbox.
+// The sandboxes returned are sorted by the PIDs of their ealdormen.
+//
+// Sandboxes are named by the name label of their namespaces, if any, and
+// otherwise by the name of their ealdorman process. The labels of a sandbox
+// are the merged labels of its ealdorman process and of those namespaces not
+// shared with other sandboxes, such as container identifiers and systemd
+// units, as attached by decorators. The ealdorman's labels win over the
+// labels of the mount namespace, which in turn win over the labels of the
+// other namespaces.
+func Sandboxes(processes ProcessTable) []*Sandbox {
+	sandboxmap := map[[NamespaceTypesCount]species.NamespaceID]*Sandbox{}
+	for _, proc := range processes.Sorted() {
+		var key [NamespaceTypesCount]species.NamespaceID
+		known := false
+		for idx, ns := range proc.Namespaces {
+			if ns != nil {
+				key[idx] = ns.ID()
+				known = true
+			}
+		}
+		if !known {
+			continue
+		}
+		sandbox, ok := sandboxmap[key]
+		if !ok {
+			sandbox = &Sandbox{Namespaces: proc.Namespaces}
+			sandboxmap[key] = sandbox
+		}
+		sandbox.Processes = append(sandbox.Processes, proc)
+		if sandbox.Ealdorman == nil || proc.Starttime < sandbox.Ealdorman.Starttime {
+			sandbox.Ealdorman = proc
+		}
+	}
+	// Count the sandboxes joined to each namespace, as only the labels of
+	// namespaces not shared with other sandboxes identify a sandbox: the
+	// containers of a Kubernetes pod share the network and IPC namespaces of
+	// the pod's pause container, but must not take on its identity.
+	sharers := map[species.NamespaceID]int{}
+	for _, sandbox := range sandboxmap {
+		for _, ns := range sandbox.Namespaces {
+			if ns != nil {
+				sharers[ns.ID()]++
+			}
+		}
+	}
+	sandboxes := make([]*Sandbox, 0, len(sandboxmap))
+	for _, sandbox := range sandboxmap {
+		sandbox.Labels = map[string]string{}
+		merge := func(labels map[string]string) {
+			for name, value := range labels {
+				sandbox.Labels[name] = value
+			}
+		}
+		// The labels of the mount namespace take precedence over the labels
+		// of the other namespaces, and the labels of the ealdorman take
+		// precedence over all namespace labels.
+		for idx, ns := range sandbox.Namespaces {
+			if ns != nil && NamespaceTypeIndex(idx) != MountNS && sharers[ns.ID()] == 1 {
+				merge(ns.Labels())
+			}
+		}
+		if mntns := sandbox.Namespaces[MountNS]; mntns != nil && sharers[mntns.ID()] == 1 {
+			merge(mntns.Labels())
+		}
+		merge(sandbox.Ealdorman.Labels)
+		if name, ok := sandbox.Labels[NameLabel]; ok {
+			sandbox.Name = name
+		} else {
+			sandbox.Name = sandbox.Ealdorman.Basename()
+		}
+		sandboxes = append(sandboxes, sandbox)
+	}
+	sort.Slice(sandboxes, func(a, b int) bool {
+		return sandboxes[a].Ealdorman.PID < sandboxes[b].Ealdorman.PID
+	})
+	return sandboxes
+}
+
+// SharedNamespaces returns the namespaces shared between two or more of the
+// specified sandboxes, together with the sandboxes sharing them. The shared
+// namespaces are sorted first by type and then by identifier; the sharing
+// sandboxes keep their order.
+func SharedNamespaces(sandboxes []*Sandbox) []SharedNamespace {
+	sharers := map[species.NamespaceID]*SharedNamespace{}
+	for _, sandbox := range sandboxes {
+		for _, ns := range sandbox.Namespaces {
+			if ns == nil {
+				continue
+			}
+			shared, ok := sharers[ns.ID()]
+			if !ok {
+				shared = &SharedNamespace{Namespace: ns}
+				sharers[ns.ID()] = shared
+			}
+			shared.Sandboxes = append(shared.Sandboxes, sandbox)
+		}
+	}
+	sharednamespaces := []SharedNamespace{}
+	for _, shared := range sharers {
+		if len(shared.Sandboxes) > 1 {
+			sharednamespaces = append(sharednamespaces, *shared)
+		}
+	}
+	sort.Slice(sharednamespaces, func(a, b int) bool {
+		nsa, nsb := sharednamespaces[a].Namespace, sharednamespaces[b].Namespace
+		if nsa.Type() != nsb.Type() {
+			return TypeIndex(nsa.Type()) < TypeIndex(nsb.Type())
+		}
+		return nsa.ID().Ino < nsb.ID().Ino ||
+			(nsa.ID().Ino == nsb.ID().Ino && nsa.ID().Dev < nsb.ID().Dev)
+	})
+	return sharednamespaces
+}
+
+// SharedWith returns the namespaces this sandbox shares with the other
+// sandbox, ordered by namespace type.
+func (s *Sandbox) SharedWith(other *Sandbox) []Namespace {
+	shared := []Namespace{}
+	for idx, ns := range s.Namespaces {
+		if ns != nil && sameNamespace(ns, other.Namespaces[idx]) {
+			shared = append(shared, ns)
+		}
+	}
+	return shared
+}
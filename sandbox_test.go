@@ -0,0 +1,125 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package lxkns
+
+import (
+	"os"
+
+	"github.com/thediveo/lxkns/species"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sandboxes", func() {
+
+	It("groups processes into sandboxes", func() {
+		ns := func(nstype species.NamespaceType, id uint64) Namespace {
+			return NewNamespace(nstype, species.NamespaceID{Dev: 1, Ino: id}, "")
+		}
+		hostmnt, hostnet := ns(species.CLONE_NEWNS, 1), ns(species.CLONE_NEWNET, 2)
+		podnet := ns(species.CLONE_NEWNET, 3)
+		podmnt1, podmnt2 := ns(species.CLONE_NEWNS, 4), ns(species.CLONE_NEWNS, 5)
+		podmnt2.(NamespaceConfigurer).SetLabel(NameLabel, "sidecar")
+
+		pt := ProcessTable{}
+		for _, proc := range []*Process{
+			{PID: 1, Name: "init", Starttime: 1, Namespaces: NamespacesSet{MountNS: hostmnt, NetNS: hostnet}},
+			{PID: 2, Name: "kthreadd", Starttime: 1, Namespaces: NamespacesSet{MountNS: hostmnt, NetNS: hostnet}},
+			{PID: 43, Name: "app", Starttime: 20, Namespaces: NamespacesSet{MountNS: podmnt1, NetNS: podnet}},
+			{PID: 42, Name: "appinit", Starttime: 10, Namespaces: NamespacesSet{MountNS: podmnt1, NetNS: podnet}},
+			{PID: 44, Name: "proxy", Starttime: 30, Namespaces: NamespacesSet{MountNS: podmnt2, NetNS: podnet}},
+			{PID: 666, Name: "unknown"},
+		} {
+			pt[proc.PID] = proc
+		}
+		pt[1].SetLabel("foo", "bar")
+
+		sandboxes := Sandboxes(pt)
+		Expect(sandboxes).To(HaveLen(3))
+		host, app, sidecar := sandboxes[0], sandboxes[1], sandboxes[2]
+		Expect(host.Name).To(Equal("init"))
+		Expect(host.Ealdorman).To(BeIdenticalTo(pt[1]))
+		Expect(host.Processes).To(Equal([]*Process{pt[1], pt[2]}))
+		Expect(host.Labels).To(Equal(map[string]string{"foo": "bar"}))
+		Expect(app.Name).To(Equal("appinit"))
+		Expect(app.Ealdorman).To(BeIdenticalTo(pt[42]))
+		Expect(app.Processes).To(Equal([]*Process{pt[42], pt[43]}))
+		Expect(sidecar.Name).To(Equal("sidecar"))
+		Expect(sidecar.Namespaces[MountNS]).To(BeIdenticalTo(podmnt2))
+
+		Expect(app.SharedWith(sidecar)).To(Equal([]Namespace{podnet}))
+		Expect(app.SharedWith(host)).To(BeEmpty())
+		shared := SharedNamespaces(sandboxes)
+		Expect(shared).To(HaveLen(1))
+		Expect(shared[0].Namespace).To(BeIdenticalTo(podnet))
+		Expect(shared[0].Sandboxes).To(Equal([]*Sandbox{app, sidecar}))
+	})
+
+	It("doesn't give pod containers the identity of the pause container", func() {
+		ns := func(nstype species.NamespaceType, id uint64, labels map[string]string) Namespace {
+			ns := NewNamespace(nstype, species.NamespaceID{Dev: 1, Ino: id}, "")
+			for name, value := range labels {
+				ns.(NamespaceConfigurer).SetLabel(name, value)
+			}
+			return ns
+		}
+		pause := map[string]string{"oci/container-id": "pause", NameLabel: "pause"}
+		podnet := ns(species.CLONE_NEWNET, 1, pause)
+		podipc := ns(species.CLONE_NEWIPC, 2, pause)
+		pausemnt := ns(species.CLONE_NEWNS, 3, pause)
+		appmnt := ns(species.CLONE_NEWNS, 4, map[string]string{"oci/container-id": "app"})
+		apputs := ns(species.CLONE_NEWUTS, 5, map[string]string{NameLabel: "app-uts", "foo": "bar"})
+
+		pt := ProcessTable{}
+		for _, proc := range []*Process{
+			{PID: 10, Name: "pause", Starttime: 1,
+				Namespaces: NamespacesSet{MountNS: pausemnt, NetNS: podnet, IPCNS: podipc}},
+			{PID: 20, Name: "app", Starttime: 2,
+				Namespaces: NamespacesSet{MountNS: appmnt, NetNS: podnet, IPCNS: podipc, UTSNS: apputs}},
+		} {
+			pt[proc.PID] = proc
+		}
+		pt[20].SetLabel(NameLabel, "app")
+
+		sandboxes := Sandboxes(pt)
+		Expect(sandboxes).To(HaveLen(2))
+		pausebox, appbox := sandboxes[0], sandboxes[1]
+		Expect(pausebox.Name).To(Equal("pause"))
+		Expect(pausebox.Labels).To(Equal(pause))
+		Expect(appbox.Name).To(Equal("app"))
+		Expect(appbox.Labels).To(Equal(map[string]string{
+			"oci/container-id": "app",
+			NameLabel:          "app",
+			"foo":              "bar",
+		}))
+	})
+
+	It("finds its own sandbox", func() {
+		allns := Discover(FullDiscovery)
+		me := allns.Processes[PIDType(os.Getpid())]
+		var mysandbox *Sandbox
+		for _, sandbox := range Sandboxes(allns.Processes) {
+			for _, proc := range sandbox.Processes {
+				if proc == me {
+					mysandbox = sandbox
+				}
+			}
+		}
+		Expect(mysandbox).NotTo(BeNil())
+		Expect(SameNamespaces(mysandbox.Namespaces, me.Namespaces)).To(BeTrue())
+	})
+
+})
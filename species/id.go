@@ -131,7 +131,7 @@ func nsfsDev() uint64 {
 		if err := unix.Stat("/proc/self/ns/net", &stat); err != nil {
 			nsfsdev = 0
 		} else {
-			nsfsdev = stat.Dev
+			nsfsdev = uint64(stat.Dev)
 		}
 	}
 	return nsfsdev
@@ -0,0 +1,146 @@
+// Translates thread IDs between PID namespaces, as well as from thread IDs to
+// the processes the threads belong to.
+
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// +build linux
+
+package lxkns
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+)
+
+// namespacedTask is a task (thread) with its TIDs in different PID
+// namespaces, together with the process it belongs to.
+type namespacedTask struct {
+	tids NamespacedPIDs // bottom-up, same as for processes.
+	proc *Process
+}
+
+// TranslateTID translates a TID "tid" in PID namespace "from" to the
+// corresponding TID in PID namespace "to". Returns 0, if TID "tid" either
+// does not exist in namespace "from", or PID namespace "to" isn't either a
+// parent or child of PID namespace "from". The first translation of TIDs
+// scans the tasks of all processes mapped.
+func (pm *PIDMap) TranslateTID(tid PIDType, from Namespace, to Namespace) PIDType {
+	if task := pm.task(tid, from); task != nil {
+		for _, namespacedtid := range task.tids {
+			if namespacedtid.PIDNS == to {
+				return namespacedtid.PID
+			}
+		}
+	}
+	return 0
+}
+
+// NamespacedTIDs returns for a specific namespaced TID the list of all TIDs
+// the corresponding task has been given in different PID namespaces. Returns
+// nil if the TID doesn't exist in the specified PID namespace. The list is
+// ordered from the topmost PID namespace down to the leaf PID namespace the
+// task's process is joined to.
+func (pm *PIDMap) NamespacedTIDs(tid PIDType, from Namespace) NamespacedPIDs {
+	task := pm.task(tid, from)
+	if task == nil {
+		return nil
+	}
+	size := len(task.tids)
+	nstids := make([]NamespacedPID, size)
+	for idx, el := range task.tids {
+		nstids[size-1-idx] = el
+	}
+	return nstids
+}
+
+// TIDProcess returns the process the task with TID "tid" in PID namespace
+// "from" belongs to, or nil if there is no such task.
+func (pm *PIDMap) TIDProcess(tid PIDType, from Namespace) *Process {
+	if task := pm.task(tid, from); task != nil {
+		return task.proc
+	}
+	return nil
+}
+
+// task returns the task with the specified namespaced TID, or nil.
+func (pm *PIDMap) task(tid PIDType, from Namespace) *namespacedTask {
+	pm.tidsOnce.Do(pm.mapTasks)
+	return pm.tids[NamespacedPID{PID: tid, PIDNS: from}]
+}
+
+// mapTasks maps the TIDs of the tasks of all mapped processes. As the tasks
+// don't tell us their PID namespaces, we take them from their processes.
+// Tasks without an "NSpid:" field in their status can only be mapped when
+// their processes are joined to the topmost PID namespace.
+func (pm *PIDMap) mapTasks() {
+	pm.tids = map[NamespacedPID]*namespacedTask{}
+	if pm.offline {
+		return
+	}
+	procroot := pm.procroot
+	if procroot == "" {
+		procroot = "/proc"
+	}
+	for pid, namespacedpids := range pm.pids {
+		taskentries, err := ioutil.ReadDir(fmt.Sprintf("%s/%d/task", procroot, pid))
+		if err != nil {
+			continue
+		}
+		for _, taskentry := range taskentries {
+			tid, err := strconv.Atoi(taskentry.Name())
+			if err != nil {
+				continue
+			}
+			tids, err := NStid(pm.processes[pid], PIDType(tid), procroot)
+			if err != nil {
+				if len(namespacedpids) != 1 {
+					continue
+				}
+				tids = []PIDType{PIDType(tid)}
+			}
+			tidslen := len(tids)
+			if tidslen != len(namespacedpids) {
+				continue
+			}
+			task := &namespacedTask{
+				tids: make(NamespacedPIDs, tidslen),
+				proc: pm.processes[pid],
+			}
+			for idx, namespacedpid := range namespacedpids {
+				task.tids[idx] = NamespacedPID{
+					PIDNS: namespacedpid.PIDNS,
+					PID:   tids[tidslen-idx-1],
+				}
+			}
+			for _, namespacedtid := range task.tids {
+				pm.tids[namespacedtid] = task
+			}
+		}
+	}
+}
+
+// NStid returns the list of namespaced TIDs for the task with TID tid of
+// process proc, based on information from the proc filesystem mounted at
+// procroot (the "NSpid:" field of the task status); an empty procroot
+// defaults to "/proc". Similar to NSpid, the list is ordered from the
+// topmost PID namespace down to the PID namespace of the process.
+func NStid(proc *Process, tid PIDType, procroot string) (tids []PIDType, err error) {
+	if procroot == "" {
+		procroot = "/proc"
+	}
+	return nspid(fmt.Sprintf("%s/%d/task/%d/status", procroot, proc.PID, tid),
+		fmt.Sprintf("task %d of process %d", tid, proc.PID))
+}
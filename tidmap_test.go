@@ -0,0 +1,91 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package lxkns
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("maps TIDs", func() {
+
+	It("translates TIDs and finds their processes", func() {
+		// Start a copy of ourselves as the initial process of a new PID
+		// namespace; thanks to the Go runtime, it'll have multiple threads.
+		sleepy := exec.Command("/proc/self/exe")
+		sleepy.Env = append(os.Environ(), sleepyEnvVar+"=1")
+		sleepy.SysProcAttr = &syscall.SysProcAttr{Cloneflags: syscall.CLONE_NEWPID}
+		Expect(sleepy.Start()).To(Succeed())
+		defer func() {
+			_ = sleepy.Process.Kill()
+			_ = sleepy.Wait()
+		}()
+		sleepypid := PIDType(sleepy.Process.Pid)
+		var hosttid, localtid PIDType
+		Eventually(func() PIDType {
+			tasks, _ := ioutil.ReadDir(fmt.Sprintf("/proc/%d/task", sleepypid))
+			for _, task := range tasks {
+				tid, _ := strconv.Atoi(task.Name())
+				if PIDType(tid) != sleepypid {
+					hosttid = PIDType(tid)
+					tids, err := NStid(&Process{PID: sleepypid}, hosttid, "")
+					if err == nil && len(tids) == 2 {
+						localtid = tids[1]
+					}
+				}
+			}
+			return localtid
+		}).ShouldNot(BeZero())
+
+		opts := NoDiscovery
+		opts.SkipProcs = false
+		opts.SkipHierarchy = false
+		allns := Discover(opts)
+		pidmap := NewPIDMap(allns)
+		pidns := allns.Processes[sleepypid].Namespaces[PIDNS]
+		ownpidns := allns.Processes[PIDType(os.Getpid())].Namespaces[PIDNS]
+
+		Expect(pidmap.TranslateTID(hosttid, ownpidns, pidns)).To(Equal(localtid))
+		Expect(pidmap.TranslateTID(localtid, pidns, ownpidns)).To(Equal(hosttid))
+		Expect(pidmap.TranslateTID(1, pidns, ownpidns)).To(Equal(sleepypid))
+		Expect(pidmap.TranslateTID(hosttid, pidns, ownpidns)).To(BeZero())
+		Expect(pidmap.NamespacedTIDs(localtid, pidns)).To(Equal(NamespacedPIDs{
+			{PIDNS: ownpidns, PID: hosttid},
+			{PIDNS: pidns, PID: localtid},
+		}))
+		Expect(pidmap.NamespacedTIDs(-1, pidns)).To(BeNil())
+
+		Expect(pidmap.TIDProcess(localtid, pidns)).To(BeIdenticalTo(allns.Processes[sleepypid]))
+		Expect(pidmap.TIDProcess(hosttid, ownpidns)).To(BeIdenticalTo(allns.Processes[sleepypid]))
+		Expect(pidmap.TIDProcess(-1, ownpidns)).To(BeNil())
+	})
+
+	It("reports missing task NSpid elements", func() {
+		_, err := NStid(&Process{PID: 1}, 1, "test/pidmap/proc")
+		Expect(errors.Is(err, ErrNoNSpid)).To(BeTrue())
+		Expect(err).To(MatchError(ContainSubstring("task 1 of process 1")))
+		_, err = NStid(&Process{PID: -1}, -1, "")
+		Expect(err).To(HaveOccurred())
+	})
+
+})
@@ -0,0 +1,178 @@
+// Walks discovery results along the relations between namespaces and
+// processes, without needing to resort to reflection.
+
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// +build linux
+
+package lxkns
+
+import (
+	"errors"
+	"sort"
+)
+
+// WalkEdges selects the relations to follow when walking discovery results.
+// Multiple edges can be OR'ed together.
+type WalkEdges int
+
+// The relations between namespaces and processes that can be walked.
+const (
+	// From PID and user namespaces to their child namespaces.
+	WalkChildren WalkEdges = 1 << iota
+	// From user namespaces to the non-user namespaces they own.
+	WalkOwned
+	// From namespaces to their leader processes.
+	WalkLeaders
+	// From processes to their child processes.
+	WalkProcessChildren
+)
+
+// WalkNode is a namespace or process visited while walking.
+type WalkNode struct {
+	Namespace Namespace // namespace visited, or nil for a process.
+	Process   *Process  // process visited, or nil for a namespace.
+	Parent    *WalkNode // node this node was reached from, or nil for roots.
+	Edge      WalkEdges // edge this node was reached by, or 0 for roots.
+	Depth     int       // depth of this node, with roots having depth 0.
+}
+
+// WalkFunc is called for each node visited while walking.
+type WalkFunc func(node *WalkNode) error
+
+// SkipChildren can be returned from a pre-order WalkFunc in order to not
+// walk the children of the current node.
+var SkipChildren = errors.New("lxkns: skip children")
+
+// WalkOptions controls which edges to follow while walking, as well as the
+// callbacks to call on the nodes visited.
+type WalkOptions struct {
+	Edges WalkEdges // edges to follow.
+	Pre   WalkFunc  // called before visiting the children of a node; optional.
+	Post  WalkFunc  // called after visiting the children of a node; optional.
+}
+
+// Walk walks the specified root namespaces and the namespaces and processes
+// reachable from them along the edges selected in the walk options, in
+// depth-first order. Child namespaces are visited sorted by their IDs, owned
+// namespaces additionally grouped by type in lexical order, and processes are
+// visited sorted by their PIDs. For each node, its owned namespaces are
+// visited first, then its child namespaces, and finally its leader or child
+// processes.
+//
+// If the pre-order callback returns SkipChildren, then the children of the
+// current node are skipped, but the post-order callback is still called for
+// it. Any other error returned from either callback aborts the walk and is
+// returned from Walk.
+//
+// Please note that with multiple edges selected, the same namespace or
+// process might be visited multiple times, when it can be reached along
+// different edges, such as a PID namespace both as an owned namespace and as
+// a child namespace.
+func Walk(roots []Namespace, opts WalkOptions) error {
+	for _, ns := range SortNamespaces(roots) {
+		if err := walk(&WalkNode{Namespace: ns}, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WalkProcesses walks the specified root processes and the namespaces and
+// processes reachable from them, same as Walk.
+func WalkProcesses(roots []*Process, opts WalkOptions) error {
+	for _, proc := range sortedProcesses(roots) {
+		if err := walk(&WalkNode{Process: proc}, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walk visits the specified node and then recursively its children.
+func walk(node *WalkNode, opts WalkOptions) error {
+	skip := false
+	if opts.Pre != nil {
+		if err := opts.Pre(node); err == SkipChildren {
+			skip = true
+		} else if err != nil {
+			return err
+		}
+	}
+	if !skip {
+		for _, child := range node.children(opts.Edges) {
+			if err := walk(child, opts); err != nil {
+				return err
+			}
+		}
+	}
+	if opts.Post != nil {
+		if err := opts.Post(node); err != nil && err != SkipChildren {
+			return err
+		}
+	}
+	return nil
+}
+
+// children returns the child nodes of this node along the specified edges.
+func (n *WalkNode) children(edges WalkEdges) (children []*WalkNode) {
+	addns := func(ns Namespace, edge WalkEdges) {
+		children = append(children, &WalkNode{
+			Namespace: ns, Parent: n, Edge: edge, Depth: n.Depth + 1})
+	}
+	addproc := func(proc *Process, edge WalkEdges) {
+		children = append(children, &WalkNode{
+			Process: proc, Parent: n, Edge: edge, Depth: n.Depth + 1})
+	}
+	if n.Process != nil {
+		if edges&WalkProcessChildren != 0 {
+			for _, child := range sortedProcesses(n.Process.Children) {
+				addproc(child, WalkProcessChildren)
+			}
+		}
+		return
+	}
+	if edges&WalkOwned != 0 {
+		if owner, ok := n.Namespace.(Ownership); ok {
+			owned := owner.Ownings()
+			for _, nstype := range TypeIndexLexicalOrder {
+				for _, ns := range SortedNamespaces(owned[nstype]) {
+					addns(ns, WalkOwned)
+				}
+			}
+		}
+	}
+	if edges&WalkChildren != 0 {
+		if hns, ok := n.Namespace.(Hierarchy); ok {
+			for _, child := range SortChildNamespaces(hns.Children()) {
+				addns(child.(Namespace), WalkChildren)
+			}
+		}
+	}
+	if edges&WalkLeaders != 0 {
+		for _, leader := range sortedProcesses(n.Namespace.Leaders()) {
+			addproc(leader, WalkLeaders)
+		}
+	}
+	return
+}
+
+// sortedProcesses returns a copy of the specified processes, sorted by PIDs.
+func sortedProcesses(procs []*Process) []*Process {
+	sorted := make([]*Process, len(procs))
+	copy(sorted, procs)
+	sort.Sort(ProcessListByPID(sorted))
+	return sorted
+}
@@ -0,0 +1,154 @@
+// Copyright 2020 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package lxkns
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/thediveo/lxkns/species"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Walk", func() {
+
+	var u0 Namespace
+	var init, child *Process
+
+	BeforeEach(func() {
+		id := func(ino uint64) species.NamespaceID {
+			return species.NamespaceID{Dev: 1, Ino: ino}
+		}
+		u0 = NewNamespace(species.CLONE_NEWUSER, id(10), "")
+		u1 := NewNamespace(species.CLONE_NEWUSER, id(11), "")
+		u0.(HierarchyConfigurer).AddChild(u1.(Hierarchy))
+		usernsmap := NamespaceMap{u0.ID(): u0, u1.ID(): u1}
+		owned := func(nstype species.NamespaceType, ino uint64, owner Namespace) Namespace {
+			ns := NewNamespace(nstype, id(ino), "")
+			ns.(NamespaceConfigurer).SetOwner(owner.ID())
+			ns.(NamespaceConfigurer).ResolveOwner(usernsmap)
+			return ns
+		}
+		owned(species.CLONE_NEWNET, 20, u0)
+		p0 := owned(species.CLONE_NEWPID, 30, u0)
+		p1 := owned(species.CLONE_NEWPID, 31, u1)
+		p0.(HierarchyConfigurer).AddChild(p1.(Hierarchy))
+
+		init = &Process{PID: 1, Name: "init"}
+		child = &Process{PID: 42, PPID: 1, Name: "child", Parent: init}
+		init.Children = []*Process{child}
+		u0.(NamespaceConfigurer).AddLeader(init)
+	})
+
+	label := func(node *WalkNode) string {
+		if node.Process != nil {
+			return fmt.Sprintf("%d:%s", node.Depth, node.Process.Name)
+		}
+		return fmt.Sprintf("%d:%s", node.Depth, node.Namespace.(NamespaceStringer).TypeIDString())
+	}
+
+	walk := func(edges WalkEdges, prune func(*WalkNode) bool) (pre, post []string) {
+		Expect(Walk([]Namespace{u0}, WalkOptions{
+			Edges: edges,
+			Pre: func(node *WalkNode) error {
+				pre = append(pre, label(node))
+				if prune != nil && prune(node) {
+					return SkipChildren
+				}
+				return nil
+			},
+			Post: func(node *WalkNode) error {
+				post = append(post, label(node))
+				return nil
+			},
+		})).To(Succeed())
+		return
+	}
+
+	It("walks child namespaces", func() {
+		pre, post := walk(WalkChildren, nil)
+		Expect(pre).To(Equal([]string{"0:user:[10]", "1:user:[11]"}))
+		Expect(post).To(Equal([]string{"1:user:[11]", "0:user:[10]"}))
+	})
+
+	It("walks owned namespaces and leaders", func() {
+		pre, _ := walk(WalkChildren|WalkOwned|WalkLeaders|WalkProcessChildren, nil)
+		Expect(pre).To(Equal([]string{
+			"0:user:[10]",
+			"1:net:[20]", "1:pid:[30]", "2:pid:[31]",
+			"1:user:[11]", "2:pid:[31]",
+			"1:init", "2:child",
+		}))
+	})
+
+	It("prunes", func() {
+		pre, post := walk(WalkChildren|WalkOwned, func(node *WalkNode) bool {
+			return node.Edge == WalkOwned
+		})
+		Expect(pre).To(Equal([]string{
+			"0:user:[10]", "1:net:[20]", "1:pid:[30]", "1:user:[11]", "2:pid:[31]",
+		}))
+		Expect(post).To(HaveLen(len(pre)))
+	})
+
+	It("tracks parents and edges", func() {
+		var leader *WalkNode
+		Expect(Walk([]Namespace{u0}, WalkOptions{
+			Edges: WalkLeaders,
+			Pre: func(node *WalkNode) error {
+				if node.Process != nil {
+					leader = node
+				}
+				return nil
+			},
+		})).To(Succeed())
+		Expect(leader.Process).To(BeIdenticalTo(init))
+		Expect(leader.Edge).To(Equal(WalkLeaders))
+		Expect(leader.Parent.Namespace).To(BeIdenticalTo(u0))
+		Expect(leader.Parent.Edge).To(BeZero())
+	})
+
+	It("aborts on errors", func() {
+		boom := errors.New("boom")
+		count := 0
+		Expect(Walk([]Namespace{u0}, WalkOptions{
+			Edges: WalkChildren,
+			Pre: func(node *WalkNode) error {
+				count++
+				return boom
+			},
+		})).To(Equal(boom))
+		Expect(count).To(Equal(1))
+		Expect(Walk([]Namespace{u0}, WalkOptions{
+			Edges: WalkChildren,
+			Post:  func(node *WalkNode) error { return boom },
+		})).To(Equal(boom))
+	})
+
+	It("walks processes", func() {
+		names := []string{}
+		Expect(WalkProcesses([]*Process{child, init}, WalkOptions{
+			Edges: WalkProcessChildren,
+			Pre: func(node *WalkNode) error {
+				names = append(names, label(node))
+				return nil
+			},
+		})).To(Succeed())
+		Expect(names).To(Equal([]string{"0:init", "1:child", "0:child"}))
+	})
+
+})